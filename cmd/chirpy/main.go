@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/migrations"
+	"github.com/G0SU19O2/Chirpy/internal/profanity"
+	"github.com/G0SU19O2/Chirpy/internal/router"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("loading .env: %w", err)
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			return runMigrate(os.Args[2:])
+		case "backfill-timelines":
+			return runBackfillTimelines(os.Args[2:])
+		}
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := store.Open(cfg.DBURL)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	if cfg.MigrateOnStart {
+		if err := migrateUp(db); err != nil {
+			return err
+		}
+	}
+
+	cfg.Store = store.NewGormStore(db)
+	if err := loadProfanityWords(cfg); err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router.SetupRoutes(cfg),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Serving on port %s", cfg.Port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight requests and queued email", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown: %w", err)
+	}
+	// Requests can no longer queue email, so what is queued is all there is.
+	if err := cfg.MailQueue.Close(shutdownCtx); err != nil {
+		return fmt.Errorf("sending queued email: %w", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func migrateUp(db *gorm.DB) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	ran, err := migrator.Up(context.Background())
+	for _, m := range ran {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("migrating database: %w", err)
+	}
+	return nil
+}
+
+// loadProfanityWords adds the words stored through the admin API to the
+// filter built from PROFANITY_WORDS. A stored word's action wins.
+func loadProfanityWords(cfg *config.Config) error {
+	words, err := cfg.Store.ListProfanityWords(context.Background())
+	if err != nil {
+		return fmt.Errorf("loading profanity words: %w", err)
+	}
+	for _, word := range words {
+		rule := profanity.Rule{Word: word.Word, Action: profanity.Action(word.Action)}
+		if err := cfg.Profanity.Set(rule); err != nil {
+			log.Printf("Skipping stored profanity word %q: %v", word.Word, err)
+		}
+	}
+	return nil
+}
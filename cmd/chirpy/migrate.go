@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/migrations"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+const migrateUsage = `usage: chirpy migrate <command> [flags]
+
+commands:
+  up       apply every pending migration
+  down     revert the most recent migrations (-steps, default 1)
+  status   list migrations and whether they have been applied
+
+flags:
+`
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dbURL := fs.String("db-url", os.Getenv("DB_URL"), "database connection string (defaults to DB_URL)")
+	steps := fs.Int("steps", 1, "number of migrations to revert with down")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("migrate: missing command")
+	}
+	command := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *dbURL == "" {
+		return errors.New("migrate: DB_URL or -db-url is required")
+	}
+
+	db, err := store.Open(*dbURL)
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		ran, err := migrator.Up(ctx)
+		for _, m := range ran {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		if *steps < 1 {
+			return errors.New("migrate: -steps must be at least 1")
+		}
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("nothing to revert")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		fs.Usage()
+		return fmt.Errorf("migrate: unknown command %q", command)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+const backfillTimelinesUsage = `usage: chirpy backfill-timelines [flags]
+
+Fills every user's stored home timeline with the latest chirps of the
+accounts they follow. Run it after setting TIMELINE_FANOUT=write, since
+stored timelines only gain chirps posted while it is in effect.
+
+flags:
+`
+
+// backfillPerAuthor matches what following someone copies in.
+const backfillPerAuthor = 100
+
+func runBackfillTimelines(args []string) error {
+	fs := flag.NewFlagSet("backfill-timelines", flag.ContinueOnError)
+	dbURL := fs.String("db-url", os.Getenv("DB_URL"), "database connection string (defaults to DB_URL)")
+	perAuthor := fs.Int("per-author", backfillPerAuthor, "latest chirps to copy from each author")
+	maxFollowers := fs.Int("max-followers", envInt("TIMELINE_FANOUT_MAX_FOLLOWERS", config.DefaultTimelineFanoutMaxFollowers),
+		"skip authors with more followers than this (defaults to TIMELINE_FANOUT_MAX_FOLLOWERS)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), backfillTimelinesUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dbURL == "" {
+		return errors.New("backfill-timelines: DB_URL or -db-url is required")
+	}
+	if *perAuthor < 1 || *maxFollowers < 1 {
+		return errors.New("backfill-timelines: -per-author and -max-followers must be at least 1")
+	}
+
+	db, err := store.Open(*dbURL)
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	if err := store.NewGormStore(db).BackfillTimelines(context.Background(), *perAuthor, *maxFollowers); err != nil {
+		return fmt.Errorf("backfill-timelines: %w", err)
+	}
+	fmt.Println("timelines backfilled")
+	return nil
+}
+
+// envInt reads a whole number from the environment, falling back to def
+// when it is unset or malformed; config.Load reports the malformed case.
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+	return def
+}
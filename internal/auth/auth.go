@@ -1,16 +1,32 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenExpired          = errors.New("token has expired")
+	ErrTokenNotValidYet      = errors.New("token is not valid yet")
+	ErrTokenInvalidIssuer    = errors.New("token has an unexpected issuer")
+	ErrTokenInvalidAudience  = errors.New("token is not intended for this audience")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
 )
 
 func HashPassword(password string) (string, error) {
@@ -22,31 +38,106 @@ func CheckPassword(password string, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func MakeJWT(userID, tokenSecret string) (string, error) {
+// dummyPasswordHash stands in for the hash of a user who does not exist.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("no user has this password")
+	return hash
+})
+
+// CheckPasswordWithoutUser fails like CheckPassword does for a wrong
+// password, and takes as long, so a login for an unknown email address
+// cannot be told apart from one for a known address by timing it.
+func CheckPasswordWithoutUser(password string) error {
+	CheckPassword(password, dummyPasswordHash())
+	return bcrypt.ErrMismatchedHashAndPassword
+}
+
+// TokenPolicy is what an access token must claim to be accepted: who
+// issued it, who it is meant for, and how much clock skew between servers is
+// tolerated when checking its timestamps.
+type TokenPolicy struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// MFAChallengePolicy returns the policy of the short-lived tokens that
+// stand in for a password while a two-factor login waits for its code. Their
+// audience differs from access tokens', so neither is accepted as the other.
+func MFAChallengePolicy(policy TokenPolicy) TokenPolicy {
+	policy.Audience += "/mfa"
+	return policy
+}
+
+func MakeJWT(userID string, keys *KeySet, policy TokenPolicy, expiresIn time.Duration) (string, error) {
+	now := time.Now()
 	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		Issuer:    policy.Issuer,
+		Audience:  jwt.ClaimStrings{policy.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
 		Subject:   userID,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(tokenSecret))
+	signing := keys.signing
+	token := jwt.NewWithClaims(signing.method(), claims)
+	if signing.ID != "" {
+		token.Header["kid"] = signing.ID
+	}
+	return token.SignedString(signing.private)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (string, error) {
+// ValidateJWT checks an access token against keys and policy and returns its
+// subject. Failures are reported as one of the ErrToken* errors.
+func ValidateJWT(tokenString string, keys *KeySet, policy TokenPolicy) (string, error) {
 	claims := &jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(keys.algorithms()),
+		jwt.WithIssuer(policy.Issuer),
+		jwt.WithAudience(policy.Audience),
+		jwt.WithLeeway(policy.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		// A key only ever verifies its own algorithm, so an RSA public key
+		// can never be abused as an HMAC secret.
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.public, nil
 	})
 	if err != nil {
-		return "", err
+		return "", tokenError(err)
 	}
-	if !token.Valid {
-		return "", errors.New("invalid token")
+	if claims.Subject == "" {
+		return "", ErrTokenMalformed
 	}
 	return claims.Subject, nil
 }
 
+// tokenError maps the jwt library's errors onto ours so callers can tell
+// clients exactly why a token was refused without depending on the library.
+func tokenError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotValidYet
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrTokenInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrTokenInvalidAudience
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return ErrTokenSignatureInvalid
+	}
+	return ErrTokenMalformed
+}
+
 func GetBearerToken(headers http.Header) (string, error) {
 	token := headers.Get("Authorization")
 	if token == "" {
@@ -67,10 +158,73 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-func ValidateRefreshToken(db *gorm.DB, tokenStr string) (*models.RefreshToken, error) {
-	var refreshToken models.RefreshToken
-	result := db.Where("token = ?", tokenStr).First(&refreshToken)
-	if result.Error != nil {
+// NewRefreshToken builds an unsaved refresh token for userID. An empty
+// familyID starts a new family, as happens on login.
+func NewRefreshToken(userID uint, familyID string, ttl time.Duration) (*models.RefreshToken, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if familyID == "" {
+		if familyID, err = MakeRefreshToken(); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	return &models.RefreshToken{
+		Token:     token,
+		UserID:    userID,
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// RotateRefreshToken exchanges a live refresh token for a new one in the
+// same family and revokes the presented token. A token that was already
+// rotated should never be seen again; if it is, it has leaked, so every
+// token in its family is revoked and ErrRefreshTokenReused is returned.
+func RotateRefreshToken(ctx context.Context, tokens store.RefreshTokenStore, presented string, ttl time.Duration) (*models.RefreshToken, error) {
+	current, err := tokens.GetRefreshToken(ctx, presented)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if current.RevokedAt != nil {
+		if current.ReplacedBy != nil {
+			return nil, revokeFamily(ctx, tokens, current.FamilyID)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next, err := NewRefreshToken(current.UserID, current.FamilyID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if err := tokens.RotateRefreshToken(ctx, current, next); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			// Another request rotated the same token first.
+			return nil, revokeFamily(ctx, tokens, current.FamilyID)
+		}
+		return nil, err
+	}
+	return next, nil
+}
+
+func revokeFamily(ctx context.Context, tokens store.RefreshTokenStore, familyID string) error {
+	if err := tokens.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func ValidateRefreshToken(ctx context.Context, tokens store.RefreshTokenStore, tokenStr string) (*models.RefreshToken, error) {
+	refreshToken, err := tokens.GetRefreshToken(ctx, tokenStr)
+	if err != nil {
 		return nil, errors.New("invalid refresh token")
 	}
 
@@ -78,16 +232,56 @@ func ValidateRefreshToken(db *gorm.DB, tokenStr string) (*models.RefreshToken, e
 		return nil, errors.New("refresh token is invalid or expired")
 	}
 
-	return &refreshToken, nil
+	return refreshToken, nil
 }
 
-func RevokeRefreshToken(db *gorm.DB, token *models.RefreshToken) error {
+func RevokeRefreshToken(ctx context.Context, tokens store.RefreshTokenStore, token *models.RefreshToken) error {
 	now := time.Now()
 	token.RevokedAt = &now
 	token.UpdatedAt = now
 
-	result := db.Save(token)
-	return result.Error
+	return tokens.UpdateRefreshToken(ctx, token)
+}
+
+// HashToken returns the form single-use tokens such as password reset
+// tokens are stored in: the hex SHA-256 of the token. The tokens are 256
+// random bits, so a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewPasswordResetToken builds an unsaved reset token for userID and
+// returns it with the token to send the user, which is not kept.
+func NewPasswordResetToken(userID uint, ttl time.Duration) (string, *models.PasswordResetToken, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	return token, &models.PasswordResetToken{
+		TokenHash: HashToken(token),
+		UserID:    userID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, nil
+}
+
+// NewEmailVerificationToken builds an unsaved token proving userID reads
+// email and returns it with the token to send there.
+func NewEmailVerificationToken(userID uint, email string, ttl time.Duration) (string, *models.EmailVerificationToken, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	return token, &models.EmailVerificationToken{
+		TokenHash: HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, nil
 }
 
 func GetAPIKey(headers http.Header) (string, error) {
@@ -96,4 +290,4 @@ func GetAPIKey(headers http.Header) (string, error) {
 		return "", errors.New("API key is missing")
 	}
 	return apiKey, nil
-} 
+}
@@ -1,9 +1,15 @@
 package auth
 
 import (
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
+var testPolicy = TokenPolicy{Issuer: "chirpy", Audience: "chirpy", Leeway: 30 * time.Second}
+
 func TestHashAndCheckPassword(t *testing.T) {
 	password := "supersecret123"
 	hash, err := HashPassword(password)
@@ -24,11 +30,28 @@ func TestHashAndCheckPassword(t *testing.T) {
 	}
 }
 
+func TestCheckPasswordWithoutUser(t *testing.T) {
+	for _, password := range []string{"", "no user has this password", "supersecret123"} {
+		if err := CheckPasswordWithoutUser(password); err == nil {
+			t.Errorf("expected %q to be refused", password)
+		}
+	}
+}
+
+func hmacKeys(t *testing.T, secret string) *KeySet {
+	t.Helper()
+	keys, err := NewKeySet(NewHMACKey([]byte(secret)))
+	if err != nil {
+		t.Fatalf("NewKeySet returned error: %v", err)
+	}
+	return keys
+}
+
 func TestMakeAndValidateJWT(t *testing.T) {
 	userID := "123"
-	secret := "test-secret-key"
+	secret := hmacKeys(t, "test-secret-key")
 
-	token, err := MakeJWT(userID, secret)
+	token, err := MakeJWT(userID, secret, testPolicy, time.Hour)
 	if err != nil {
 		t.Fatalf("MakeJWT returned error: %v", err)
 	}
@@ -36,7 +59,7 @@ func TestMakeAndValidateJWT(t *testing.T) {
 		t.Error("Token should not be empty")
 	}
 
-	extractedUserID, err := ValidateJWT(token, secret)
+	extractedUserID, err := ValidateJWT(token, secret, testPolicy)
 	if err != nil {
 		t.Fatalf("ValidateJWT returned error: %v", err)
 	}
@@ -44,13 +67,110 @@ func TestMakeAndValidateJWT(t *testing.T) {
 		t.Errorf("Expected userID %s, got %s", userID, extractedUserID)
 	}
 
-	_, err = ValidateJWT(token, "wrong-secret")
+	_, err = ValidateJWT(token, hmacKeys(t, "wrong-secret"), testPolicy)
 	if err == nil {
 		t.Error("ValidateJWT should fail with wrong secret")
 	}
 
-	_, err = ValidateJWT("invalid-token", secret)
+	_, err = ValidateJWT("invalid-token", secret, testPolicy)
 	if err == nil {
 		t.Error("ValidateJWT should fail with invalid token")
 	}
 }
+
+func TestMFAChallengeTokensAreNotAccessTokens(t *testing.T) {
+	keys := hmacKeys(t, "test-secret-key")
+	mfaPolicy := MFAChallengePolicy(testPolicy)
+
+	challenge, err := MakeJWT("123", keys, mfaPolicy, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	if subject, err := ValidateJWT(challenge, keys, mfaPolicy); err != nil || subject != "123" {
+		t.Errorf("expected the challenge to validate for user 123, got %q, %v", subject, err)
+	}
+	if _, err := ValidateJWT(challenge, keys, testPolicy); !errors.Is(err, ErrTokenInvalidAudience) {
+		t.Errorf("expected a challenge to be refused as an access token, got %v", err)
+	}
+
+	access, err := MakeJWT("123", keys, testPolicy, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	if _, err := ValidateJWT(access, keys, mfaPolicy); !errors.Is(err, ErrTokenInvalidAudience) {
+		t.Errorf("expected an access token to be refused as a challenge, got %v", err)
+	}
+}
+
+func TestValidateJWTErrors(t *testing.T) {
+	keys := hmacKeys(t, "test-secret-key")
+	now := time.Now()
+
+	sign := func(claims jwt.RegisteredClaims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret-key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    testPolicy.Issuer,
+			Audience:  jwt.ClaimStrings{testPolicy.Audience},
+			Subject:   "123",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}
+	}
+
+	expired := valid()
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+	withinLeeway := valid()
+	withinLeeway.ExpiresAt = jwt.NewNumericDate(now.Add(-5 * time.Second))
+	noExpiry := valid()
+	noExpiry.ExpiresAt = nil
+	future := valid()
+	future.IssuedAt = jwt.NewNumericDate(now.Add(time.Hour))
+	wrongIssuer := valid()
+	wrongIssuer.Issuer = "someone-else"
+	wrongAudience := valid()
+	wrongAudience.Audience = jwt.ClaimStrings{"other-api"}
+	noAudience := valid()
+	noAudience.Audience = nil
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("wrong-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{"valid", sign(valid()), nil},
+		{"expired within leeway", sign(withinLeeway), nil},
+		{"expired", sign(expired), ErrTokenExpired},
+		{"missing expiry", sign(noExpiry), ErrTokenMalformed},
+		{"issued in the future", sign(future), ErrTokenNotValidYet},
+		{"wrong issuer", sign(wrongIssuer), ErrTokenInvalidIssuer},
+		{"wrong audience", sign(wrongAudience), ErrTokenInvalidAudience},
+		{"missing audience", sign(noAudience), ErrTokenMalformed},
+		{"alg none", unsigned, ErrTokenSignatureInvalid},
+		{"wrong secret", forged, ErrTokenSignatureInvalid},
+		{"garbage", "invalid-token", ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateJWT(tt.token, keys, testPolicy)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
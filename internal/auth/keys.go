@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	minRSAKeyBits = 2048
+)
+
+// Key is a JWT signing or verification key. HMAC keys have an empty ID and
+// are never published; asymmetric keys are identified by their RFC 7638
+// thumbprint, which is sent as the token's "kid" header.
+type Key struct {
+	ID        string
+	Algorithm string
+	private   crypto.PrivateKey
+	public    crypto.PublicKey
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// NewHMACKey wraps a shared secret for HS256.
+func NewHMACKey(secret []byte) *Key {
+	return &Key{Algorithm: AlgHS256, private: secret, public: secret}
+}
+
+// ParsePrivateKeyPEM reads an RSA (PKCS#1 or PKCS#8) or Ed25519 (PKCS#8)
+// private key. The algorithm follows from the key type.
+func ParsePrivateKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		k, err := newPublicKey(&key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		k.private = key
+		return k, nil
+	case ed25519.PrivateKey:
+		k, err := newPublicKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		k.private = key
+		return k, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", parsed)
+}
+
+// ParsePublicKeyPEM reads an RSA or Ed25519 public key (PKIX, or PKCS#1 for
+// RSA). Such keys can only verify tokens.
+func ParsePublicKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newPublicKey(parsed)
+}
+
+func newPublicKey(public crypto.PublicKey) (*Key, error) {
+	k := &Key{public: public}
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits, got %d", minRSAKeyBits, key.N.BitLen())
+		}
+		k.Algorithm = AlgRS256
+	case ed25519.PublicKey:
+		k.Algorithm = AlgEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+	thumbprint, err := k.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	k.ID = thumbprint
+	return k, nil
+}
+
+// JWK is the public half of a key as published in a JWKS document.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) jwk() (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch key := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.Algorithm,
+			N:         b64(key.N.Bytes()),
+			E:         b64(big.NewInt(int64(key.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.Algorithm,
+			Curve:     "Ed25519",
+			X:         b64(key),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint: the SHA-256 of the
+// required public members serialised in lexicographic order.
+func (k *Key) thumbprint() (string, error) {
+	jwk, ok := k.jwk()
+	if !ok {
+		return "", errors.New("key has no public JWK form")
+	}
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// KeySet holds the key new tokens are signed with plus every key tokens may
+// still be verified with, so signing keys can be rotated without logging
+// everyone out.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet builds a key set that signs with signing and additionally
+// accepts tokens signed by any of the verification keys.
+func NewKeySet(signing *Key, verification ...*Key) (*KeySet, error) {
+	if signing == nil || signing.private == nil {
+		return nil, errors.New("signing key must include a private key")
+	}
+	ks := &KeySet{signing: signing, keys: map[string]*Key{signing.ID: signing}}
+	for _, k := range verification {
+		if _, ok := ks.keys[k.ID]; ok {
+			// The same key listed twice, typically the signing key's own
+			// public half.
+			continue
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) lookup(kid string) (*Key, bool) {
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// algorithms lists every signing algorithm some key in the set verifies.
+func (ks *KeySet) algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, k := range ks.keys {
+		if !seen[k.Algorithm] {
+			seen[k.Algorithm] = true
+			algs = append(algs, k.Algorithm)
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// JWKS returns the public keys that downstream services need to verify
+// tokens. Shared HMAC secrets are never included.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	if jwk, ok := ks.signing.jwk(); ok {
+		set.Keys = append(set.Keys, jwk)
+	}
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		if id != ks.signing.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if jwk, ok := ks.keys[id].jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
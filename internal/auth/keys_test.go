@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func generateRSAKey(t *testing.T) (*Key, []byte) {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}))
+	if err != nil {
+		t.Fatalf("ParsePrivateKeyPEM returned error: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+}
+
+func generateEd25519Key(t *testing.T) (*Key, []byte) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	if err != nil {
+		t.Fatalf("ParsePrivateKeyPEM returned error: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+}
+
+func TestAsymmetricJWT(t *testing.T) {
+	rsaKey, _ := generateRSAKey(t)
+	edKey, _ := generateEd25519Key(t)
+
+	for _, key := range []*Key{rsaKey, edKey} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			keys, err := NewKeySet(key)
+			if err != nil {
+				t.Fatalf("NewKeySet returned error: %v", err)
+			}
+
+			token, err := MakeJWT("42", keys, testPolicy, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT returned error: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != key.Algorithm {
+				t.Errorf("expected kid %s and alg %s, got %v", key.ID, key.Algorithm, parsed.Header)
+			}
+
+			userID, err := ValidateJWT(token, keys, testPolicy)
+			if err != nil {
+				t.Fatalf("ValidateJWT returned error: %v", err)
+			}
+			if userID != "42" {
+				t.Errorf("expected userID 42, got %s", userID)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, oldPublicPEM := generateEd25519Key(t)
+	newKey, _ := generateRSAKey(t)
+
+	oldKeys, err := NewKeySet(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := MakeJWT("1", oldKeys, testPolicy, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retired, err := ParsePublicKeyPEM(oldPublicPEM)
+	if err != nil {
+		t.Fatalf("ParsePublicKeyPEM returned error: %v", err)
+	}
+	if retired.ID != oldKey.ID {
+		t.Errorf("expected public key to share the private key's id")
+	}
+	rotated, err := NewKeySet(newKey, retired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ValidateJWT(oldToken, rotated, testPolicy); err != nil {
+		t.Errorf("expected token signed with retired key to validate, got %v", err)
+	}
+	if _, err := ValidateJWT(oldToken, mustKeySet(t, newKey), testPolicy); err == nil {
+		t.Error("expected token signed with a dropped key to fail")
+	}
+
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != newKey.ID || jwks.Keys[1].KeyID != oldKey.ID {
+		t.Errorf("expected JWKS to list the signing key then the retired key, got %+v", jwks.Keys)
+	}
+}
+
+func TestValidateJWTRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, publicPEM := generateRSAKey(t)
+	keys := mustKeySet(t, rsaKey)
+
+	// Classic attack: sign an HS256 token using the published RSA public key
+	// as the HMAC secret.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	forged.Header["kid"] = rsaKey.ID
+	token, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ValidateJWT(token, keys, testPolicy); err == nil {
+		t.Error("expected HS256 token to be rejected by an RS256 key")
+	}
+}
+
+func TestValidateJWTRejectsUnknownKeyID(t *testing.T) {
+	signer, _ := generateEd25519Key(t)
+	other, _ := generateEd25519Key(t)
+
+	token, err := MakeJWT("1", mustKeySet(t, signer), testPolicy, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(token, mustKeySet(t, other), testPolicy); err == nil {
+		t.Error("expected token with unknown kid to be rejected")
+	}
+}
+
+func TestJWKSOmitsHMACKeys(t *testing.T) {
+	if jwks := hmacKeys(t, "secret").JWKS(); len(jwks.Keys) != 0 {
+		t.Errorf("expected no published keys for HMAC, got %+v", jwks.Keys)
+	}
+}
+
+func TestThumbprintMatchesRFC7638(t *testing.T) {
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := newPublicKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	if err != nil {
+		t.Fatalf("newPublicKey returned error: %v", err)
+	}
+	if key.ID != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("unexpected thumbprint %s", key.ID)
+	}
+}
+
+func mustKeySet(t *testing.T, signing *Key, verification ...*Key) *KeySet {
+	t.Helper()
+	keys, err := NewKeySet(signing, verification...)
+	if err != nil {
+		t.Fatalf("NewKeySet returned error: %v", err)
+	}
+	return keys
+}
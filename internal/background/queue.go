@@ -0,0 +1,80 @@
+// Package background runs work that outlives the request asking for it,
+// such as sending email, on a fixed pool of workers.
+package background
+
+import (
+	"context"
+	"sync"
+)
+
+// Queue holds up to a fixed number of jobs for its workers. A flood of
+// requests fills it up instead of starting a goroutine each, and Close
+// lets the server finish what was queued before it exits.
+type Queue struct {
+	jobs   chan func(context.Context)
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewQueue starts workers goroutines running jobs, with room for size
+// jobs waiting for one.
+func NewQueue(workers, size int) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{jobs: make(chan func(context.Context), size), ctx: ctx, cancel: cancel}
+	q.wg.Add(workers)
+	for range workers {
+		go func() {
+			defer q.wg.Done()
+			for job := range q.jobs {
+				job(q.ctx)
+			}
+		}()
+	}
+	return q
+}
+
+// Submit queues job, reporting false without running it if the queue is
+// full or closed. The context job is given is cancelled if Close gives up
+// waiting for it.
+func (q *Queue) Submit(job func(ctx context.Context)) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the queue taking jobs and waits for those already queued to
+// finish. If ctx is done first, the jobs' context is cancelled and Close
+// returns ctx's error without waiting any longer.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	defer q.cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
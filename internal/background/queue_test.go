@@ -0,0 +1,57 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestQueueRefusesJobsWhenFull(t *testing.T) {
+	q := NewQueue(1, 1)
+	started, release := make(chan struct{}), make(chan struct{})
+	var ran atomic.Int32
+
+	if !q.Submit(func(ctx context.Context) { close(started); <-release; ran.Add(1) }) {
+		t.Fatal("expected the first job to be accepted")
+	}
+	<-started
+	if !q.Submit(func(ctx context.Context) { ran.Add(1) }) {
+		t.Fatal("expected a job to wait while the worker is busy")
+	}
+	if q.Submit(func(ctx context.Context) { ran.Add(1) }) {
+		t.Error("expected a job beyond the queue's size to be refused")
+	}
+
+	close(release)
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if got := ran.Load(); got != 2 {
+		t.Errorf("expected Close to wait for both accepted jobs, %d ran", got)
+	}
+	if q.Submit(func(ctx context.Context) {}) {
+		t.Error("expected a closed queue to refuse jobs")
+	}
+}
+
+func TestQueueCloseGivesUp(t *testing.T) {
+	q := NewQueue(1, 1)
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	q.Submit(func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Close(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Close to give up with the context's error, got %v", err)
+	}
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the running job's context to be cancelled, got %v", err)
+	}
+}
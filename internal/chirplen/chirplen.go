@@ -0,0 +1,76 @@
+// Package chirplen measures chirp bodies the way their limit is counted.
+package chirplen
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// URLWeight is what a link counts for, however long it is, so pasting a
+// long address does not use up a chirp and a shortened one gains nothing.
+const URLWeight = 23
+
+// Count returns the length of body in user-perceived characters: an emoji
+// built from several code points, or a letter followed by combining
+// accents, counts once. Each http:// or https:// link counts URLWeight.
+func Count(body string) int {
+	count := 0
+	for {
+		start, end := nextURL(body)
+		if start < 0 {
+			return count + uniseg.GraphemeClusterCount(body)
+		}
+		count += uniseg.GraphemeClusterCount(body[:start]) + URLWeight
+		body = body[end:]
+	}
+}
+
+// nextURL finds the first link in s and returns its byte offsets, or -1
+// if there is none. A link starts with its scheme at the start of s or
+// after a character that could not be part of a word, runs to the next
+// space and does not include punctuation that ends a sentence after it.
+func nextURL(s string) (int, int) {
+	offset := 0
+	for {
+		i := indexScheme(s[offset:])
+		if i < 0 {
+			return -1, -1
+		}
+		start := offset + i
+		prev, _ := utf8.DecodeLastRuneInString(s[:start])
+		end := start + strings.IndexFunc(s[start:], unicode.IsSpace)
+		if end < start {
+			end = len(s)
+		}
+		end = start + len(strings.TrimRight(s[start:end], ".,;:!?'\")"))
+		schemeEnd := start + strings.Index(s[start:], "://") + len("://")
+		if (start == 0 || !isWordRune(prev)) && end > schemeEnd {
+			return start, end
+		}
+		offset = schemeEnd
+	}
+}
+
+// indexScheme returns the offset of the first "http://" or "https://" in
+// s, in any case, or -1. The scheme is ASCII, so this compares bytes and
+// the offset is valid in s itself.
+func indexScheme(s string) int {
+	for i := 0; i+len("http://") <= len(s); i++ {
+		rest := s[i:]
+		if hasPrefixFold(rest, "http://") || hasPrefixFold(rest, "https://") {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,46 @@
+package chirplen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"ascii", "hello world", 11},
+		{"empty", "", 0},
+		{"vietnamese precomposed", "Tiếng Việt", 10},
+		{"vietnamese combining marks", "Vie\u0323\u0302t", 4},
+		{"emoji", "🙂🙂", 2},
+		{"family emoji", "👨‍👩‍👧‍👦", 1},
+		{"flag", "🇻🇳", 1},
+		{"url", "see https://example.com/a/very/long/path?with=query", 4 + URLWeight},
+		{"short url", "http://x.co", URLWeight},
+		{"url in any case", "HTTPS://EXAMPLE.COM", URLWeight},
+		{"two urls", "http://a.io and https://b.io", URLWeight + 5 + URLWeight},
+		{"trailing punctuation", "read https://go.dev.", 5 + URLWeight + 1},
+		{"in parentheses", "(https://go.dev)", 1 + URLWeight + 1},
+		{"scheme only", "https://", 8},
+		{"inside a word", "xhttps://go.dev", 15},
+		{"url after unicode", "İhttps://go.dev", 15},
+		{"url after accented word", "Việt https://go.dev", 5 + URLWeight},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Count(tt.body); got != tt.expected {
+				t.Errorf("Count(%q) = %d, expected %d", tt.body, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCountLongURL(t *testing.T) {
+	body := "https://example.com/" + strings.Repeat("a", 500)
+	if got := Count(body); got != URLWeight {
+		t.Errorf("expected a long link to count %d, got %d", URLWeight, got)
+	}
+}
@@ -1,24 +1,164 @@
 package config
 
 import (
+	"log"
+	"net/netip"
 	"sync/atomic"
+	"time"
 
-	"gorm.io/gorm"
+	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/background"
+	"github.com/G0SU19O2/Chirpy/internal/mail"
+	"github.com/G0SU19O2/Chirpy/internal/password"
+	"github.com/G0SU19O2/Chirpy/internal/profanity"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+const (
+	PlatformDev  = "DEV"
+	PlatformProd = "PROD"
+)
+
+// Timeline fan-out strategies. On read, a timeline is assembled from the
+// follow graph when it is requested; on write, each chirp is copied into
+// its followers' stored timelines when it is posted, which keeps reads
+// cheap for users who follow many accounts.
+const (
+	FanoutOnRead  = "read"
+	FanoutOnWrite = "write"
+)
+
+// Mailers pick how email is delivered. The log and file mailers only
+// record messages, for local development.
+const (
+	MailerLog  = "log"
+	MailerFile = "file"
+	MailerSMTP = "smtp"
 )
 
 type Config struct {
-	FileserverHits atomic.Int32
-	DB             *gorm.DB
-	Platform       string
-	JWTSecret      string
-	PolkaAPIKey    string
+	FileserverHits  atomic.Int32
+	Store           store.Store
+	DBURL           string
+	Port            string
+	ShutdownTimeout time.Duration
+	MigrateOnStart  bool
+	Platform        string
+	JWTSecret       string
+	JWTKeys         *auth.KeySet
+	JWTPolicy       auth.TokenPolicy
+	PolkaAPIKey     string
+	// AdminAPIKey guards the admin API; when empty the admin API is off.
+	AdminAPIKey string
+
+	// AccessTokenTTL is used when a login does not ask for a lifetime;
+	// requested lifetimes are capped at AccessTokenMaxTTL.
+	AccessTokenTTL    time.Duration
+	AccessTokenMaxTTL time.Duration
+	RefreshTokenTTL   time.Duration
+
+	// ChirpMaxLength caps chirps, in characters as chirplen counts them;
+	// Chirpy Red members get ChirpyRedChirpMaxLength instead.
+	ChirpMaxLength          int
+	ChirpyRedChirpMaxLength int
+
+	// ChirpEditWindow is how long after posting an author may edit a chirp.
+	ChirpEditWindow time.Duration
+
+	// TimelineFanout is FanoutOnRead or FanoutOnWrite. With FanoutOnWrite,
+	// chirps by authors with more than TimelineFanoutMaxFollowers followers
+	// are not copied to each follower but read from the follow graph.
+	TimelineFanout             string
+	TimelineFanoutMaxFollowers int
+
+	// TrendingWindow is how far back trending hashtags are counted.
+	TrendingWindow time.Duration
+
+	// Profanity checks chirp bodies. Its word list starts from
+	// PROFANITY_WORDS and can be changed through the admin API.
+	Profanity *profanity.Filter
+
+	// Mailer sends account email such as password resets.
+	Mailer mail.Mailer
+	// MailQueue sends the email that goes out after its request has been
+	// answered. The server closes it on shutdown so queued email still goes
+	// out.
+	MailQueue *background.Queue
+	// PasswordResetTTL is how long a password reset token can be used.
+	PasswordResetTTL time.Duration
+	// EmailVerificationTTL is how long an email verification token can be
+	// used.
+	EmailVerificationTTL time.Duration
+	// RequireVerifiedEmail keeps users from chirping until they verify
+	// their email address.
+	RequireVerifiedEmail bool
+
+	// MFAChallengeTTL is how long a user with two-factor authentication has
+	// to enter a code after their password is accepted.
+	MFAChallengeTTL time.Duration
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string
+
+	// LoginMaxFailures and LoginIPMaxFailures are how many failed logins
+	// in a row an email address or IP address gets before it is locked
+	// out for LoginLockout. Each further failure doubles the lockout, up
+	// to LoginMaxLockout, and failures are forgotten LoginMaxLockout after
+	// the last one.
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginLockout       time.Duration
+	LoginMaxLockout    time.Duration
+	// TrustedProxies are the addresses whose X-Forwarded-For header is
+	// believed when working out which IP address a login came from.
+	TrustedProxies []netip.Prefix
+
+	// PasswordPolicy is what new passwords must satisfy.
+	PasswordPolicy password.Policy
 }
 
-func New(db *gorm.DB, platform string, jwtSecret string, polkaAPIKey string) *Config {
+func New(st store.Store, platform string, jwtSecret string, polkaAPIKey string) *Config {
+	keys, _ := auth.NewKeySet(auth.NewHMACKey([]byte(jwtSecret)))
+	rules, _ := profanity.ParseRules(DefaultProfanityWords)
+	filter, _ := profanity.NewFilter(rules...)
 	return &Config{
-		DB:       db,
-		Platform: platform,
+		Store:     st,
+		Platform:  platform,
 		JWTSecret: jwtSecret,
+		JWTKeys:   keys,
+		JWTPolicy: auth.TokenPolicy{
+			Issuer:   DefaultJWTIssuer,
+			Audience: DefaultJWTAudience,
+			Leeway:   DefaultJWTLeeway,
+		},
 		PolkaAPIKey: polkaAPIKey,
+
+		AccessTokenTTL:    DefaultAccessTokenTTL,
+		AccessTokenMaxTTL: DefaultAccessTokenMaxTTL,
+		RefreshTokenTTL:   DefaultRefreshTokenTTL,
+		ChirpEditWindow:   DefaultChirpEditWindow,
+		TimelineFanout:    FanoutOnRead,
+		TrendingWindow:    DefaultTrendingWindow,
+		Profanity:         filter,
+
+		TimelineFanoutMaxFollowers: DefaultTimelineFanoutMaxFollowers,
+
+		ChirpMaxLength:          DefaultChirpMaxLength,
+		ChirpyRedChirpMaxLength: DefaultChirpyRedChirpMaxLength,
+
+		Mailer:           &mail.LogMailer{From: DefaultMailFrom, Logger: log.Default()},
+		MailQueue:        background.NewQueue(DefaultMailWorkers, DefaultMailQueueSize),
+		PasswordResetTTL: DefaultPasswordResetTTL,
+
+		EmailVerificationTTL: DefaultEmailVerificationTTL,
+
+		MFAChallengeTTL: DefaultMFAChallengeTTL,
+		TOTPIssuer:      DefaultTOTPIssuer,
+
+		LoginMaxFailures:   DefaultLoginMaxFailures,
+		LoginIPMaxFailures: DefaultLoginIPMaxFailures,
+		LoginLockout:       DefaultLoginLockout,
+		LoginMaxLockout:    DefaultLoginMaxLockout,
+
+		PasswordPolicy: password.Policy{MinLength: DefaultPasswordMinLength, BlockCommon: true},
 	}
 }
@@ -0,0 +1,552 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/background"
+	"github.com/G0SU19O2/Chirpy/internal/mail"
+	"github.com/G0SU19O2/Chirpy/internal/password"
+	"github.com/G0SU19O2/Chirpy/internal/profanity"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultPort            = "8080"
+	DefaultShutdownTimeout = 10 * time.Second
+	MinJWTSecretLength     = 32
+
+	DefaultJWTIssuer   = "chirpy"
+	DefaultJWTAudience = "chirpy"
+	DefaultJWTLeeway   = 30 * time.Second
+	MaxJWTLeeway       = 5 * time.Minute
+
+	DefaultAccessTokenTTL    = time.Hour
+	DefaultAccessTokenMaxTTL = time.Hour
+	DefaultRefreshTokenTTL   = 60 * 24 * time.Hour
+
+	DefaultChirpMaxLength          = 140
+	DefaultChirpyRedChirpMaxLength = 280
+
+	DefaultChirpEditWindow = 15 * time.Minute
+	DefaultTrendingWindow  = 24 * time.Hour
+
+	DefaultTimelineFanoutMaxFollowers = 10000
+
+	DefaultProfanityWords = "kerfuffle,sharbert,fornax"
+
+	DefaultMailFrom         = "chirpy@localhost"
+	DefaultMailWorkers      = 2
+	DefaultMailQueueSize    = 100
+	DefaultPasswordResetTTL = time.Hour
+
+	DefaultEmailVerificationTTL = 24 * time.Hour
+
+	DefaultMFAChallengeTTL = 5 * time.Minute
+	DefaultTOTPIssuer      = "Chirpy"
+
+	DefaultLoginMaxFailures   = 5
+	DefaultLoginIPMaxFailures = 20
+	DefaultLoginLockout       = time.Minute
+	DefaultLoginMaxLockout    = time.Hour
+
+	DefaultPasswordMinLength = 8
+)
+
+// ValidationError lists every problem found in a configuration so they can
+// all be fixed in one go instead of one restart at a time.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// settings is the raw, string-typed form of the configuration as it appears
+// in files, environment variables and flags.
+type settings struct {
+	DBURL           string `yaml:"db_url" toml:"db_url"`
+	Port            string `yaml:"port" toml:"port"`
+	ShutdownTimeout string `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	MigrateOnStart  string `yaml:"migrate_on_start" toml:"migrate_on_start"`
+	Platform        string `yaml:"platform" toml:"platform"`
+	JWTSecret       string `yaml:"jwt_secret" toml:"jwt_secret"`
+	JWTPrivateKey   string `yaml:"jwt_private_key_file" toml:"jwt_private_key_file"`
+	JWTPublicKeys   string `yaml:"jwt_public_key_files" toml:"jwt_public_key_files"`
+	JWTIssuer       string `yaml:"jwt_issuer" toml:"jwt_issuer"`
+	JWTAudience     string `yaml:"jwt_audience" toml:"jwt_audience"`
+	JWTLeeway       string `yaml:"jwt_leeway" toml:"jwt_leeway"`
+	PolkaAPIKey     string `yaml:"polka_api_key" toml:"polka_api_key"`
+	AdminAPIKey     string `yaml:"admin_api_key" toml:"admin_api_key"`
+
+	AccessTokenTTL    string `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	AccessTokenMaxTTL string `yaml:"access_token_max_ttl" toml:"access_token_max_ttl"`
+	RefreshTokenTTL   string `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+
+	ChirpMaxLength          string `yaml:"chirp_max_length" toml:"chirp_max_length"`
+	ChirpyRedChirpMaxLength string `yaml:"chirpy_red_chirp_max_length" toml:"chirpy_red_chirp_max_length"`
+
+	ChirpEditWindow            string `yaml:"chirp_edit_window" toml:"chirp_edit_window"`
+	TimelineFanout             string `yaml:"timeline_fanout" toml:"timeline_fanout"`
+	TimelineFanoutMaxFollowers string `yaml:"timeline_fanout_max_followers" toml:"timeline_fanout_max_followers"`
+	TrendingWindow             string `yaml:"trending_window" toml:"trending_window"`
+	ProfanityWords             string `yaml:"profanity_words" toml:"profanity_words"`
+
+	Mailer        string `yaml:"mailer" toml:"mailer"`
+	MailFrom      string `yaml:"mail_from" toml:"mail_from"`
+	MailFile      string `yaml:"mail_file" toml:"mail_file"`
+	SMTPAddr      string `yaml:"smtp_addr" toml:"smtp_addr"`
+	SMTPUsername  string `yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword  string `yaml:"smtp_password" toml:"smtp_password"`
+	MailWorkers   string `yaml:"mail_workers" toml:"mail_workers"`
+	MailQueueSize string `yaml:"mail_queue_size" toml:"mail_queue_size"`
+
+	PasswordResetTTL string `yaml:"password_reset_ttl" toml:"password_reset_ttl"`
+
+	EmailVerificationTTL string `yaml:"email_verification_ttl" toml:"email_verification_ttl"`
+	RequireVerifiedEmail string `yaml:"require_verified_email" toml:"require_verified_email"`
+
+	MFAChallengeTTL string `yaml:"mfa_challenge_ttl" toml:"mfa_challenge_ttl"`
+	TOTPIssuer      string `yaml:"totp_issuer" toml:"totp_issuer"`
+
+	LoginMaxFailures   string `yaml:"login_max_failures" toml:"login_max_failures"`
+	LoginIPMaxFailures string `yaml:"login_ip_max_failures" toml:"login_ip_max_failures"`
+	LoginLockout       string `yaml:"login_lockout" toml:"login_lockout"`
+	LoginMaxLockout    string `yaml:"login_max_lockout" toml:"login_max_lockout"`
+	TrustedProxies     string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+
+	PasswordMinLength   string `yaml:"password_min_length" toml:"password_min_length"`
+	PasswordBlockCommon string `yaml:"password_block_common" toml:"password_block_common"`
+}
+
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value *string
+}
+
+// fields maps each setting to its environment variable and flag name.
+func (s *settings) fields() []setting {
+	return []setting{
+		{"DB_URL", "db-url", "database connection string", &s.DBURL},
+		{"PORT", "port", "HTTP listen port", &s.Port},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time to wait for in-flight requests on shutdown", &s.ShutdownTimeout},
+		{"MIGRATE_ON_START", "migrate-on-start", "apply pending migrations before serving", &s.MigrateOnStart},
+		{"PLATFORM", "platform", "DEV or PROD", &s.Platform},
+		{"JWT_SECRET", "jwt-secret", "HS256 secret used to sign access tokens", &s.JWTSecret},
+		{"JWT_PRIVATE_KEY_FILE", "jwt-private-key-file", "PEM RSA or Ed25519 key used to sign access tokens instead of JWT_SECRET", &s.JWTPrivateKey},
+		{"JWT_PUBLIC_KEY_FILES", "jwt-public-key-files", "comma-separated PEM public keys of retired signing keys that are still accepted", &s.JWTPublicKeys},
+		{"JWT_ISSUER", "jwt-issuer", "iss claim put in and required of access tokens", &s.JWTIssuer},
+		{"JWT_AUDIENCE", "jwt-audience", "aud claim put in and required of access tokens", &s.JWTAudience},
+		{"JWT_LEEWAY", "jwt-leeway", "clock skew tolerated when checking token timestamps", &s.JWTLeeway},
+		{"POLKA_API_KEY", "polka-api-key", "API key expected on Polka webhooks", &s.PolkaAPIKey},
+		{"ADMIN_API_KEY", "admin-api-key", "API key expected on admin API requests; the admin API is off without one", &s.AdminAPIKey},
+		{"ACCESS_TOKEN_TTL", "access-token-ttl", "access token lifetime when the client does not request one", &s.AccessTokenTTL},
+		{"ACCESS_TOKEN_MAX_TTL", "access-token-max-ttl", "longest access token lifetime a client may request", &s.AccessTokenMaxTTL},
+		{"REFRESH_TOKEN_TTL", "refresh-token-ttl", "refresh token lifetime", &s.RefreshTokenTTL},
+		{"CHIRP_MAX_LENGTH", "chirp-max-length", "longest chirp, in characters, most users may post", &s.ChirpMaxLength},
+		{"CHIRPY_RED_CHIRP_MAX_LENGTH", "chirpy-red-chirp-max-length", "longest chirp, in characters, Chirpy Red members may post", &s.ChirpyRedChirpMaxLength},
+		{"CHIRP_EDIT_WINDOW", "chirp-edit-window", "how long after posting a chirp can be edited", &s.ChirpEditWindow},
+		{"TIMELINE_FANOUT", "timeline-fanout", "build home timelines on read or precompute them on write", &s.TimelineFanout},
+		{"TIMELINE_FANOUT_MAX_FOLLOWERS", "timeline-fanout-max-followers", "most followers an author may have and still be copied into timelines on write", &s.TimelineFanoutMaxFollowers},
+		{"TRENDING_WINDOW", "trending-window", "how far back trending hashtags are counted", &s.TrendingWindow},
+		{"PROFANITY_WORDS", "profanity-words", "comma-separated words to filter, each optionally :mask, :reject or :flag", &s.ProfanityWords},
+		{"MAILER", "mailer", "how email is delivered: log, file or smtp", &s.Mailer},
+		{"MAIL_FROM", "mail-from", "sender address of outgoing email", &s.MailFrom},
+		{"MAIL_FILE", "mail-file", "file the file mailer appends email to", &s.MailFile},
+		{"SMTP_ADDR", "smtp-addr", "host:port of the SMTP server the smtp mailer sends through", &s.SMTPAddr},
+		{"SMTP_USERNAME", "smtp-username", "SMTP username; no authentication without one", &s.SMTPUsername},
+		{"SMTP_PASSWORD", "smtp-password", "SMTP password", &s.SMTPPassword},
+		{"MAIL_WORKERS", "mail-workers", "how many emails are sent at once after their requests are answered", &s.MailWorkers},
+		{"MAIL_QUEUE_SIZE", "mail-queue-size", "how many emails can wait to be sent before requests needing one are refused", &s.MailQueueSize},
+		{"PASSWORD_RESET_TTL", "password-reset-ttl", "how long a password reset token stays valid", &s.PasswordResetTTL},
+		{"EMAIL_VERIFICATION_TTL", "email-verification-ttl", "how long an email verification token stays valid", &s.EmailVerificationTTL},
+		{"REQUIRE_VERIFIED_EMAIL", "require-verified-email", "refuse to let users chirp until they verify their email address", &s.RequireVerifiedEmail},
+		{"MFA_CHALLENGE_TTL", "mfa-challenge-ttl", "how long a two-factor user has to enter a code after their password", &s.MFAChallengeTTL},
+		{"TOTP_ISSUER", "totp-issuer", "name authenticator apps show next to Chirpy accounts", &s.TOTPIssuer},
+		{"LOGIN_MAX_FAILURES", "login-max-failures", "failed logins in a row an email address is allowed before it is locked out", &s.LoginMaxFailures},
+		{"LOGIN_IP_MAX_FAILURES", "login-ip-max-failures", "failed logins in a row an IP address is allowed before it is locked out", &s.LoginIPMaxFailures},
+		{"LOGIN_LOCKOUT", "login-lockout", "first lockout after too many failed logins; each further failure doubles it", &s.LoginLockout},
+		{"LOGIN_MAX_LOCKOUT", "login-max-lockout", "longest lockout, and how long failed logins are remembered", &s.LoginMaxLockout},
+		{"TRUSTED_PROXIES", "trusted-proxies", "comma-separated IP addresses or CIDR ranges of proxies whose X-Forwarded-For is believed", &s.TrustedProxies},
+		{"PASSWORD_MIN_LENGTH", "password-min-length", "fewest characters a password may have", &s.PasswordMinLength},
+		{"PASSWORD_BLOCK_COMMON", "password-block-common", "refuse passwords on the bundled list of common passwords", &s.PasswordBlockCommon},
+	}
+}
+
+// Load builds a Config from, in increasing order of precedence, built-in
+// defaults, an optional YAML or TOML file (-config or CHIRPY_CONFIG),
+// environment variables and command-line flags. The result is validated and
+// a *ValidationError is returned if anything is wrong.
+func Load(args []string) (*Config, error) {
+	s := settings{
+		Port:            DefaultPort,
+		ShutdownTimeout: DefaultShutdownTimeout.String(),
+		MigrateOnStart:  "true",
+		JWTIssuer:       DefaultJWTIssuer,
+		JWTAudience:     DefaultJWTAudience,
+		JWTLeeway:       DefaultJWTLeeway.String(),
+
+		AccessTokenTTL:    DefaultAccessTokenTTL.String(),
+		AccessTokenMaxTTL: DefaultAccessTokenMaxTTL.String(),
+		RefreshTokenTTL:   DefaultRefreshTokenTTL.String(),
+
+		ChirpMaxLength:          strconv.Itoa(DefaultChirpMaxLength),
+		ChirpyRedChirpMaxLength: strconv.Itoa(DefaultChirpyRedChirpMaxLength),
+
+		ChirpEditWindow:            DefaultChirpEditWindow.String(),
+		TimelineFanout:             FanoutOnRead,
+		TimelineFanoutMaxFollowers: strconv.Itoa(DefaultTimelineFanoutMaxFollowers),
+		TrendingWindow:             DefaultTrendingWindow.String(),
+		ProfanityWords:             DefaultProfanityWords,
+
+		Mailer:           MailerLog,
+		MailFrom:         DefaultMailFrom,
+		MailWorkers:      strconv.Itoa(DefaultMailWorkers),
+		MailQueueSize:    strconv.Itoa(DefaultMailQueueSize),
+		PasswordResetTTL: DefaultPasswordResetTTL.String(),
+
+		EmailVerificationTTL: DefaultEmailVerificationTTL.String(),
+		RequireVerifiedEmail: "false",
+
+		MFAChallengeTTL: DefaultMFAChallengeTTL.String(),
+		TOTPIssuer:      DefaultTOTPIssuer,
+
+		LoginMaxFailures:   strconv.Itoa(DefaultLoginMaxFailures),
+		LoginIPMaxFailures: strconv.Itoa(DefaultLoginIPMaxFailures),
+		LoginLockout:       DefaultLoginLockout.String(),
+		LoginMaxLockout:    DefaultLoginMaxLockout.String(),
+
+		PasswordMinLength:   strconv.Itoa(DefaultPasswordMinLength),
+		PasswordBlockCommon: "true",
+	}
+
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CHIRPY_CONFIG"), "path to a YAML or TOML config file")
+	byFlag := make(map[string]*string)
+	for _, f := range s.fields() {
+		fs.String(f.flag, "", f.usage)
+		byFlag[f.flag] = f.value
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := readFile(*configFile, &s); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range s.fields() {
+		if v, ok := os.LookupEnv(f.env); ok && v != "" {
+			*f.value = v
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if target, ok := byFlag[f.Name]; ok {
+			*target = f.Value.String()
+		}
+	})
+
+	return s.build()
+}
+
+func readFile(path string, s *settings) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, s)
+	case ".toml":
+		err = toml.Unmarshal(data, s)
+	default:
+		return fmt.Errorf("unsupported config file extension %q (want .yaml, .yml or .toml)", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *settings) build() (*Config, error) {
+	var problems []string
+
+	cfg := &Config{
+		DBURL:       s.DBURL,
+		Port:        s.Port,
+		Platform:    strings.ToUpper(strings.TrimSpace(s.Platform)),
+		JWTSecret:   s.JWTSecret,
+		PolkaAPIKey: s.PolkaAPIKey,
+		AdminAPIKey: s.AdminAPIKey,
+	}
+
+	if cfg.DBURL == "" {
+		problems = append(problems, "DB_URL is required")
+	}
+
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be a number between 1 and 65535, got %q", cfg.Port))
+	}
+
+	cfg.ShutdownTimeout = parseDuration("SHUTDOWN_TIMEOUT", s.ShutdownTimeout, &problems)
+
+	migrateOnStart, err := strconv.ParseBool(s.MigrateOnStart)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("MIGRATE_ON_START must be true or false, got %q", s.MigrateOnStart))
+	}
+	cfg.MigrateOnStart = migrateOnStart
+
+	if cfg.Platform != PlatformDev && cfg.Platform != PlatformProd {
+		problems = append(problems, fmt.Sprintf("PLATFORM must be %s or %s, got %q", PlatformDev, PlatformProd, s.Platform))
+	}
+
+	cfg.JWTKeys = s.buildKeySet(&problems)
+	cfg.JWTPolicy = s.buildTokenPolicy(&problems)
+
+	if cfg.PolkaAPIKey == "" {
+		problems = append(problems, "POLKA_API_KEY is required")
+	}
+
+	cfg.AccessTokenTTL = parseDuration("ACCESS_TOKEN_TTL", s.AccessTokenTTL, &problems)
+	cfg.AccessTokenMaxTTL = parseDuration("ACCESS_TOKEN_MAX_TTL", s.AccessTokenMaxTTL, &problems)
+	cfg.RefreshTokenTTL = parseDuration("REFRESH_TOKEN_TTL", s.RefreshTokenTTL, &problems)
+	if cfg.AccessTokenTTL > 0 && cfg.AccessTokenMaxTTL > 0 && cfg.AccessTokenTTL > cfg.AccessTokenMaxTTL {
+		problems = append(problems, fmt.Sprintf("ACCESS_TOKEN_TTL (%s) must not exceed ACCESS_TOKEN_MAX_TTL (%s)", cfg.AccessTokenTTL, cfg.AccessTokenMaxTTL))
+	}
+
+	cfg.ChirpMaxLength = parseLength("CHIRP_MAX_LENGTH", s.ChirpMaxLength, &problems)
+	cfg.ChirpyRedChirpMaxLength = parseLength("CHIRPY_RED_CHIRP_MAX_LENGTH", s.ChirpyRedChirpMaxLength, &problems)
+
+	cfg.ChirpEditWindow = parseDuration("CHIRP_EDIT_WINDOW", s.ChirpEditWindow, &problems)
+
+	cfg.TimelineFanout = strings.ToLower(strings.TrimSpace(s.TimelineFanout))
+	if cfg.TimelineFanout != FanoutOnRead && cfg.TimelineFanout != FanoutOnWrite {
+		problems = append(problems, fmt.Sprintf("TIMELINE_FANOUT must be %s or %s, got %q", FanoutOnRead, FanoutOnWrite, s.TimelineFanout))
+	}
+	cfg.TimelineFanoutMaxFollowers = parseCount("TIMELINE_FANOUT_MAX_FOLLOWERS", s.TimelineFanoutMaxFollowers, &problems)
+
+	cfg.TrendingWindow = parseDuration("TRENDING_WINDOW", s.TrendingWindow, &problems)
+
+	rules, err := profanity.ParseRules(s.ProfanityWords)
+	if err == nil {
+		cfg.Profanity, err = profanity.NewFilter(rules...)
+	}
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("PROFANITY_WORDS: %v", err))
+	}
+
+	cfg.Mailer = s.buildMailer(&problems)
+	mailWorkers := parseCount("MAIL_WORKERS", s.MailWorkers, &problems)
+	mailQueueSize := parseCount("MAIL_QUEUE_SIZE", s.MailQueueSize, &problems)
+	cfg.PasswordResetTTL = parseDuration("PASSWORD_RESET_TTL", s.PasswordResetTTL, &problems)
+	cfg.EmailVerificationTTL = parseDuration("EMAIL_VERIFICATION_TTL", s.EmailVerificationTTL, &problems)
+
+	requireVerifiedEmail, err := strconv.ParseBool(s.RequireVerifiedEmail)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("REQUIRE_VERIFIED_EMAIL must be true or false, got %q", s.RequireVerifiedEmail))
+	}
+	cfg.RequireVerifiedEmail = requireVerifiedEmail
+
+	cfg.MFAChallengeTTL = parseDuration("MFA_CHALLENGE_TTL", s.MFAChallengeTTL, &problems)
+	cfg.TOTPIssuer = s.TOTPIssuer
+	if cfg.TOTPIssuer == "" || strings.Contains(cfg.TOTPIssuer, ":") {
+		problems = append(problems, fmt.Sprintf("TOTP_ISSUER must be non-empty and contain no colon, got %q", s.TOTPIssuer))
+	}
+
+	cfg.LoginMaxFailures = parseCount("LOGIN_MAX_FAILURES", s.LoginMaxFailures, &problems)
+	cfg.LoginIPMaxFailures = parseCount("LOGIN_IP_MAX_FAILURES", s.LoginIPMaxFailures, &problems)
+	cfg.LoginLockout = parseDuration("LOGIN_LOCKOUT", s.LoginLockout, &problems)
+	cfg.LoginMaxLockout = parseDuration("LOGIN_MAX_LOCKOUT", s.LoginMaxLockout, &problems)
+	if cfg.LoginLockout > 0 && cfg.LoginMaxLockout > 0 && cfg.LoginLockout > cfg.LoginMaxLockout {
+		problems = append(problems, fmt.Sprintf("LOGIN_LOCKOUT (%s) must not exceed LOGIN_MAX_LOCKOUT (%s)", cfg.LoginLockout, cfg.LoginMaxLockout))
+	}
+	cfg.TrustedProxies = parsePrefixes("TRUSTED_PROXIES", s.TrustedProxies, &problems)
+
+	cfg.PasswordPolicy.MinLength = parseLength("PASSWORD_MIN_LENGTH", s.PasswordMinLength, &problems)
+	if cfg.PasswordPolicy.MinLength > password.MaxBytes {
+		problems = append(problems, fmt.Sprintf("PASSWORD_MIN_LENGTH must be at most %d, got %q", password.MaxBytes, s.PasswordMinLength))
+	}
+	blockCommon, err := strconv.ParseBool(s.PasswordBlockCommon)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("PASSWORD_BLOCK_COMMON must be true or false, got %q", s.PasswordBlockCommon))
+	}
+	cfg.PasswordPolicy.BlockCommon = blockCommon
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	cfg.MailQueue = background.NewQueue(mailWorkers, mailQueueSize)
+	return cfg, nil
+}
+
+// buildKeySet signs with JWT_PRIVATE_KEY_FILE when set and JWT_SECRET
+// otherwise. When both are set the secret stays valid for verification so
+// tokens issued before switching to asymmetric keys keep working.
+func (s *settings) buildKeySet(problems *[]string) *auth.KeySet {
+	var signing *auth.Key
+	var verification []*auth.Key
+
+	if s.JWTSecret != "" {
+		if len(s.JWTSecret) < MinJWTSecretLength {
+			*problems = append(*problems, fmt.Sprintf("JWT_SECRET must be at least %d bytes, got %d", MinJWTSecretLength, len(s.JWTSecret)))
+		}
+		signing = auth.NewHMACKey([]byte(s.JWTSecret))
+	}
+
+	if s.JWTPrivateKey != "" {
+		key, err := readKeyFile(s.JWTPrivateKey, auth.ParsePrivateKeyPEM)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("JWT_PRIVATE_KEY_FILE: %v", err))
+		} else {
+			if signing != nil {
+				verification = append(verification, signing)
+			}
+			signing = key
+		}
+	}
+
+	for _, path := range strings.Split(s.JWTPublicKeys, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		key, err := readKeyFile(path, auth.ParsePublicKeyPEM)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("JWT_PUBLIC_KEY_FILES: %v", err))
+			continue
+		}
+		verification = append(verification, key)
+	}
+
+	if signing == nil {
+		if s.JWTPrivateKey == "" {
+			*problems = append(*problems, "JWT_SECRET or JWT_PRIVATE_KEY_FILE is required")
+		}
+		return nil
+	}
+	keys, err := auth.NewKeySet(signing, verification...)
+	if err != nil {
+		*problems = append(*problems, err.Error())
+	}
+	return keys
+}
+
+func (s *settings) buildTokenPolicy(problems *[]string) auth.TokenPolicy {
+	policy := auth.TokenPolicy{
+		Issuer:   strings.TrimSpace(s.JWTIssuer),
+		Audience: strings.TrimSpace(s.JWTAudience),
+	}
+	if policy.Issuer == "" {
+		*problems = append(*problems, "JWT_ISSUER must not be empty")
+	}
+	if policy.Audience == "" {
+		*problems = append(*problems, "JWT_AUDIENCE must not be empty")
+	}
+
+	leeway, err := time.ParseDuration(s.JWTLeeway)
+	switch {
+	case err != nil:
+		*problems = append(*problems, fmt.Sprintf("JWT_LEEWAY must be a duration such as 30s, got %q", s.JWTLeeway))
+	case leeway < 0 || leeway > MaxJWTLeeway:
+		*problems = append(*problems, fmt.Sprintf("JWT_LEEWAY must be between 0s and %s, got %s", MaxJWTLeeway, leeway))
+	}
+	policy.Leeway = leeway
+	return policy
+}
+
+func readKeyFile(path string, parse func([]byte) (*auth.Key, error)) (*auth.Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+func (s *settings) buildMailer(problems *[]string) mail.Mailer {
+	switch strings.ToLower(strings.TrimSpace(s.Mailer)) {
+	case MailerLog:
+		return &mail.LogMailer{From: s.MailFrom, Logger: log.Default()}
+	case MailerFile:
+		if s.MailFile == "" {
+			*problems = append(*problems, "MAIL_FILE is required when MAILER is file")
+			return nil
+		}
+		return &mail.FileMailer{From: s.MailFrom, Path: s.MailFile}
+	case MailerSMTP:
+		if s.SMTPAddr == "" {
+			*problems = append(*problems, "SMTP_ADDR is required when MAILER is smtp")
+			return nil
+		}
+		return mail.NewSMTPMailer(s.SMTPAddr, s.MailFrom, s.SMTPUsername, s.SMTPPassword)
+	}
+	*problems = append(*problems, fmt.Sprintf("MAILER must be %s, %s or %s, got %q", MailerLog, MailerFile, MailerSMTP, s.Mailer))
+	return nil
+}
+
+func parseDuration(key, value string, problems *[]string) time.Duration {
+	d, err := time.ParseDuration(value)
+	switch {
+	case err != nil:
+		*problems = append(*problems, fmt.Sprintf("%s must be a duration such as 10s, got %q", key, value))
+	case d <= 0:
+		*problems = append(*problems, fmt.Sprintf("%s must be positive", key))
+	}
+	return d
+}
+
+// parsePrefixes reads a comma-separated list of IP addresses and CIDR
+// ranges, a bare address standing for itself alone.
+func parsePrefixes(key, value string, problems *[]string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(field)
+			if addrErr != nil {
+				*problems = append(*problems, fmt.Sprintf("%s must list IP addresses or CIDR ranges, got %q", key, field))
+				continue
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+func parseCount(key, value string, problems *[]string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 1 {
+		*problems = append(*problems, fmt.Sprintf("%s must be a positive whole number, got %q", key, value))
+	}
+	return n
+}
+
+func parseLength(key, value string, problems *[]string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 1 {
+		*problems = append(*problems, fmt.Sprintf("%s must be a positive number of characters, got %q", key, value))
+	}
+	return n
+}
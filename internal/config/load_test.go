@@ -0,0 +1,271 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func setValidEnv(t *testing.T) {
+	t.Setenv("CHIRPY_CONFIG", "")
+	t.Setenv("DB_URL", "user:pass@tcp(localhost:3306)/chirpy")
+	t.Setenv("PORT", "")
+	t.Setenv("SHUTDOWN_TIMEOUT", "")
+	t.Setenv("MIGRATE_ON_START", "")
+	t.Setenv("PLATFORM", "DEV")
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("JWT_PRIVATE_KEY_FILE", "")
+	t.Setenv("JWT_PUBLIC_KEY_FILES", "")
+	t.Setenv("JWT_ISSUER", "")
+	t.Setenv("JWT_AUDIENCE", "")
+	t.Setenv("JWT_LEEWAY", "")
+	t.Setenv("POLKA_API_KEY", "polka-key")
+	t.Setenv("ACCESS_TOKEN_TTL", "")
+	t.Setenv("ACCESS_TOKEN_MAX_TTL", "")
+	t.Setenv("REFRESH_TOKEN_TTL", "")
+	t.Setenv("CHIRP_MAX_LENGTH", "")
+	t.Setenv("CHIRPY_RED_CHIRP_MAX_LENGTH", "")
+	t.Setenv("CHIRP_EDIT_WINDOW", "")
+	t.Setenv("TIMELINE_FANOUT", "")
+	t.Setenv("TIMELINE_FANOUT_MAX_FOLLOWERS", "")
+	t.Setenv("TRENDING_WINDOW", "")
+	t.Setenv("PROFANITY_WORDS", "")
+	t.Setenv("ADMIN_API_KEY", "")
+	t.Setenv("MAILER", "")
+	t.Setenv("MAIL_FROM", "")
+	t.Setenv("MAIL_FILE", "")
+	t.Setenv("SMTP_ADDR", "")
+	t.Setenv("SMTP_USERNAME", "")
+	t.Setenv("SMTP_PASSWORD", "")
+	t.Setenv("MAIL_WORKERS", "")
+	t.Setenv("MAIL_QUEUE_SIZE", "")
+	t.Setenv("PASSWORD_RESET_TTL", "")
+	t.Setenv("EMAIL_VERIFICATION_TTL", "")
+	t.Setenv("REQUIRE_VERIFIED_EMAIL", "")
+	t.Setenv("MFA_CHALLENGE_TTL", "")
+	t.Setenv("TOTP_ISSUER", "")
+	t.Setenv("LOGIN_MAX_FAILURES", "")
+	t.Setenv("LOGIN_IP_MAX_FAILURES", "")
+	t.Setenv("LOGIN_LOCKOUT", "")
+	t.Setenv("LOGIN_MAX_LOCKOUT", "")
+	t.Setenv("TRUSTED_PROXIES", "")
+	t.Setenv("PASSWORD_MIN_LENGTH", "")
+	t.Setenv("PASSWORD_BLOCK_COMMON", "")
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	setValidEnv(t)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Port != DefaultPort {
+		t.Errorf("expected default port %s, got %s", DefaultPort, cfg.Port)
+	}
+	if cfg.ShutdownTimeout != DefaultShutdownTimeout {
+		t.Errorf("expected default shutdown timeout %s, got %s", DefaultShutdownTimeout, cfg.ShutdownTimeout)
+	}
+	if cfg.Platform != PlatformDev {
+		t.Errorf("expected platform %s, got %s", PlatformDev, cfg.Platform)
+	}
+	if !cfg.MigrateOnStart {
+		t.Error("expected migrations to run on start by default")
+	}
+	if cfg.JWTSecret != testSecret {
+		t.Errorf("expected JWT secret from env, got %q", cfg.JWTSecret)
+	}
+	if cfg.TimelineFanout != FanoutOnRead {
+		t.Errorf("expected timelines to fan out on read by default, got %q", cfg.TimelineFanout)
+	}
+	if got := cfg.Profanity.Apply("what a kerfuffle").Text; got != "what a ****" {
+		t.Errorf("expected the default word list to mask kerfuffle, got %q", got)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("PORT", "9000")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chirpy.yaml")
+	content := "port: 7000\nshutdown_timeout: 30s\nplatform: prod\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load([]string{"-config", path, "-platform", "DEV"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Port != "9000" {
+		t.Errorf("expected env to override file port, got %s", cfg.Port)
+	}
+	if cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("expected shutdown timeout from file, got %s", cfg.ShutdownTimeout)
+	}
+	if cfg.Platform != PlatformDev {
+		t.Errorf("expected flag to override env and file platform, got %s", cfg.Platform)
+	}
+}
+
+func TestLoadTOMLFile(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("PLATFORM", "")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chirpy.toml")
+	content := "platform = \"PROD\"\nport = \"8081\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Platform != PlatformProd || cfg.Port != "8081" {
+		t.Errorf("expected values from TOML file, got platform=%s port=%s", cfg.Platform, cfg.Port)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("DB_URL", "")
+	t.Setenv("PORT", "http")
+	t.Setenv("SHUTDOWN_TIMEOUT", "-1s")
+	t.Setenv("PLATFORM", "STAGING")
+	t.Setenv("JWT_SECRET", "short")
+	t.Setenv("POLKA_API_KEY", "")
+	t.Setenv("CHIRP_MAX_LENGTH", "0")
+	t.Setenv("TIMELINE_FANOUT", "sideways")
+	t.Setenv("TRENDING_WINDOW", "0s")
+	t.Setenv("PROFANITY_WORDS", "kerfuffle:shout")
+	t.Setenv("MAILER", "smtp")
+	t.Setenv("REQUIRE_VERIFIED_EMAIL", "sometimes")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.internal")
+
+	_, err := Load(nil)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+
+	expected := []string{"DB_URL", "PORT", "SHUTDOWN_TIMEOUT", "PLATFORM", "JWT_SECRET", "POLKA_API_KEY", "CHIRP_MAX_LENGTH", "TIMELINE_FANOUT", "TRENDING_WINDOW", "PROFANITY_WORDS", "SMTP_ADDR", "REQUIRE_VERIFIED_EMAIL", "TRUSTED_PROXIES"}
+	if len(ve.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %d: %v", len(expected), len(ve.Problems), ve.Problems)
+	}
+	for i, key := range expected {
+		if !strings.HasPrefix(ve.Problems[i], key) {
+			t.Errorf("expected problem %d to be about %s, got %q", i, key, ve.Problems[i])
+		}
+	}
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("TRUSTED_PROXIES", "10.1.2.3/8, 192.0.2.1,2001:db8::/32")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	expected := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::/32"}
+	if len(cfg.TrustedProxies) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, cfg.TrustedProxies)
+	}
+	for i, prefix := range cfg.TrustedProxies {
+		if prefix.String() != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], prefix)
+		}
+	}
+}
+
+func TestLoadUnsupportedFileExtension(t *testing.T) {
+	setValidEnv(t)
+
+	path := filepath.Join(t.TempDir(), "chirpy.json")
+	if err := os.WriteFile(path, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load([]string{"-config", path}); err == nil {
+		t.Error("expected error for unsupported config file extension")
+	}
+}
+
+func TestLoadRejectsAccessTokenTTLAboveMaximum(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("ACCESS_TOKEN_TTL", "2h")
+	t.Setenv("ACCESS_TOKEN_MAX_TTL", "1h")
+
+	_, err := Load(nil)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Problems) != 1 || !strings.HasPrefix(ve.Problems[0], "ACCESS_TOKEN_TTL") {
+		t.Fatalf("expected a single ACCESS_TOKEN_TTL problem, got %v", err)
+	}
+}
+
+func TestLoadPrivateKeyFile(t *testing.T) {
+	setValidEnv(t)
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_PRIVATE_KEY_FILE", path)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	jwks := cfg.JWTKeys.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Algorithm != "EdDSA" {
+		t.Errorf("expected the Ed25519 key to be published, got %+v", jwks.Keys)
+	}
+
+	t.Setenv("JWT_PRIVATE_KEY_FILE", filepath.Join(t.TempDir(), "missing.pem"))
+	_, err = Load(nil)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Problems) != 1 || !strings.HasPrefix(ve.Problems[0], "JWT_PRIVATE_KEY_FILE") {
+		t.Fatalf("expected a single JWT_PRIVATE_KEY_FILE problem, got %v", err)
+	}
+}
+
+func TestLoadJWTPolicy(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("JWT_AUDIENCE", "chirpy-api")
+	t.Setenv("JWT_LEEWAY", "0s")
+
+	cfg, err := Load([]string{"-jwt-issuer", "https://chirpy.example.com"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.JWTPolicy.Issuer != "https://chirpy.example.com" || cfg.JWTPolicy.Audience != "chirpy-api" || cfg.JWTPolicy.Leeway != 0 {
+		t.Errorf("unexpected token policy %+v", cfg.JWTPolicy)
+	}
+
+	t.Setenv("JWT_LEEWAY", "1h")
+	_, err = Load(nil)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Problems) != 1 || !strings.HasPrefix(ve.Problems[0], "JWT_LEEWAY") {
+		t.Fatalf("expected a single JWT_LEEWAY problem, got %v", err)
+	}
+}
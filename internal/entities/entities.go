@@ -0,0 +1,157 @@
+// Package entities finds the #hashtags and @mentions in a chirp body.
+package entities
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+type Kind string
+
+const (
+	Hashtag Kind = "hashtag"
+	Mention Kind = "mention"
+)
+
+// MaxHashtagLength and MaxMentionLength cap the characters after the # or
+// @; anything longer is not treated as an entity at all.
+const (
+	MaxHashtagLength = 100
+	MaxMentionLength = 30
+)
+
+// Entity is a hashtag or mention in a body. Text is the tag or username
+// without its # or @, lower-cased so it can be compared. Start and End are
+// character offsets covering the whole entity including its # or @. They
+// count grapheme clusters, the user-perceived characters chirplen counts a
+// body's length in, so an emoji before an entity moves it by one.
+type Entity struct {
+	Kind  Kind
+	Text  string
+	Start int
+	End   int
+}
+
+// Extract returns the entities in body in the order they appear.
+//
+// A hashtag is # followed by letters, digits and underscores, at least one
+// of them a letter, so "#1" is not a tag. A mention is @ followed by ASCII
+// letters, digits and underscores. Either must start the body or follow a
+// character that could not be part of a word, which keeps the @ in an
+// email address or the # in "C#" from counting.
+func Extract(body string) []Entity {
+	var found []Entity
+	var prev rune
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRuneInString(body[i:])
+		if (r == '#' || r == '@') && !isWordRune(prev) {
+			kind, match := Hashtag, isWordRune
+			maxLength := MaxHashtagLength
+			if r == '@' {
+				kind, match, maxLength = Mention, isMentionRune, MaxMentionLength
+			}
+			name, length := scan(body[i+size:], match)
+			end := i + size + len(name)
+			if valid(kind, name, length, maxLength) && !followedByMarker(body[end:]) {
+				// Byte offsets until toCharOffsets converts them.
+				found = append(found, Entity{Kind: kind, Text: strings.ToLower(name), Start: i, End: end})
+				i = end
+				prev, _ = utf8.DecodeLastRuneInString(name)
+				continue
+			}
+		}
+		prev = r
+		i += size
+	}
+	toCharOffsets(body, found)
+	return found
+}
+
+// toCharOffsets turns the byte offsets of found into grapheme cluster
+// offsets. An entity that starts or ends inside a cluster, such as a
+// mention followed by a combining accent, is widened to cover it.
+func toCharOffsets(body string, found []Entity) {
+	if len(found) == 0 {
+		return
+	}
+	var starts []int
+	state := -1
+	for offset, rest := 0, body; rest != ""; {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		starts = append(starts, offset)
+		offset += len(cluster)
+	}
+	for i := range found {
+		found[i].Start = sort.SearchInts(starts, found[i].Start+1) - 1
+		found[i].End = sort.SearchInts(starts, found[i].End)
+	}
+}
+
+// Hashtags returns the distinct tags in body.
+func Hashtags(body string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, e := range Extract(body) {
+		if e.Kind == Hashtag && !seen[e.Text] {
+			seen[e.Text] = true
+			tags = append(tags, e.Text)
+		}
+	}
+	return tags
+}
+
+// NormalizeHashtag turns a tag as typed, with or without its #, into the
+// form Extract reports. It returns "" if tag is not a valid hashtag.
+func NormalizeHashtag(tag string) string {
+	tag = strings.TrimPrefix(tag, "#")
+	name, length := scan(tag, isWordRune)
+	if name != tag || !valid(Hashtag, name, length, MaxHashtagLength) {
+		return ""
+	}
+	return strings.ToLower(name)
+}
+
+// scan returns the longest prefix of s made of runes accepted by match and
+// its length in runes.
+func scan(s string, match func(rune) bool) (string, int) {
+	length := 0
+	for i, r := range s {
+		if !match(r) {
+			return s[:i], length
+		}
+		length++
+	}
+	return s, length
+}
+
+func valid(kind Kind, name string, length, maxLength int) bool {
+	if length == 0 || length > maxLength {
+		return false
+	}
+	if kind == Hashtag {
+		return strings.IndexFunc(name, unicode.IsLetter) >= 0
+	}
+	return true
+}
+
+// followedByMarker rejects "#one#two" and "@user@host", which are more
+// likely to be something else than two entities run together.
+func followedByMarker(rest string) bool {
+	r, _ := utf8.DecodeRuneInString(rest)
+	return r == '#' || r == '@'
+}
+
+// isWordRune accepts the characters a hashtag is made of, including the
+// combining marks some scripts need.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+func isMentionRune(r rune) bool {
+	return r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
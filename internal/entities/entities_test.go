@@ -0,0 +1,50 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []Entity
+	}{
+		{"none", "just words", nil},
+		{"hashtag", "Learning #GoLang today", []Entity{{Hashtag, "golang", 9, 16}}},
+		{"mention", "@Alice_1, hi", []Entity{{Mention, "alice_1", 0, 8}}},
+		{"offsets count characters", "Café #thé @bob", []Entity{{Hashtag, "thé", 5, 9}, {Mention, "bob", 10, 14}}},
+		{"offsets count graphemes", "👍🏽 Cafe\u0301 #go @bob", []Entity{{Hashtag, "go", 7, 10}, {Mention, "bob", 11, 15}}},
+		{"accent after a mention", "@bobe\u0301 hi", []Entity{{Mention, "bobe", 0, 5}}},
+		{"punctuation ends an entity", "(#go!)", []Entity{{Hashtag, "go", 1, 4}}},
+		{"numeric hashtag", "#1 fan", nil},
+		{"email address", "mail bob@example.com", nil},
+		{"inside a word", "C# and a#b", nil},
+		{"run together", "#one#two @a@b", nil},
+		{"bare markers", "# @ #_", nil},
+		{"repeated", "#go #GO", []Entity{{Hashtag, "go", 0, 3}, {Hashtag, "go", 4, 7}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Extract(tt.body); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	tests := map[string]string{
+		"GoLang":  "golang",
+		"#golang": "golang",
+		"go lang": "",
+		"123":     "",
+		"":        "",
+	}
+	for input, expected := range tests {
+		if got := NormalizeHashtag(input); got != expected {
+			t.Errorf("NormalizeHashtag(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
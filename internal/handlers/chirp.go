@@ -1,18 +1,23 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"sort"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/chirplen"
 	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/middleware"
 	"github.com/G0SU19O2/Chirpy/internal/models"
-	"gorm.io/gorm"
+	"github.com/G0SU19O2/Chirpy/internal/profanity"
+	"github.com/G0SU19O2/Chirpy/internal/search"
+	"github.com/G0SU19O2/Chirpy/internal/store"
 )
 
 func HandleDeleteChirp(cfg *config.Config) http.HandlerFunc {
@@ -23,21 +28,57 @@ func HandleDeleteChirp(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		token, err := auth.GetBearerToken(r.Header)
+		user, _ := middleware.UserFromContext(r.Context())
+
+		chirp, err := cfg.Store.GetChirpByID(r.Context(), chirpID)
 		if err != nil {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid token")
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusNotFound, "Chirp not found")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+			return
+		}
+
+		if chirp.UserID != user.ID {
+			RespondWithError(w, http.StatusUnauthorized, "You are not authorized to delete this chirp")
 			return
 		}
 
-		tokenUserId, err := auth.ValidateJWT(token, cfg.JWTSecret)
+		if err := cfg.Store.DeleteChirp(r.Context(), chirp.ID); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to delete chirp")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleEditChirp lets the author change a chirp's body while the edit
+// window is open. The previous body is kept as a revision.
+func HandleEditChirp(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := parseChirpIDFromPath(r)
 		if err != nil {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid token")
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		user, _ := middleware.UserFromContext(r.Context())
+
+		var req models.ChirpEditRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "invalid JSON format")
+			return
+		}
+		if err := validateChirpBody(req.Body, chirpMaxLength(cfg, user)); err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		chirp, err := findChirpByID(cfg.DB, chirpID)
+		chirp, err := cfg.Store.GetChirpByID(r.Context(), chirpID)
 		if err != nil {
-			if err == gorm.ErrRecordNotFound {
+			if errors.Is(err, store.ErrNotFound) {
 				RespondWithError(w, http.StatusNotFound, "Chirp not found")
 				return
 			}
@@ -45,17 +86,86 @@ func HandleDeleteChirp(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		if !isChirpOwner(tokenUserId, chirp.UserID) {
-			RespondWithError(w, http.StatusUnauthorized, "You are not authorized to delete this chirp")
+		if chirp.UserID != user.ID {
+			RespondWithError(w, http.StatusUnauthorized, "You are not authorized to edit this chirp")
 			return
 		}
 
-		if err := cfg.DB.Delete(&chirp).Error; err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Failed to delete chirp")
+		if chirp.RechirpOfID != nil {
+			RespondWithError(w, http.StatusBadRequest, "rechirps have no body to edit")
 			return
 		}
 
-		w.WriteHeader(http.StatusNoContent)
+		if time.Since(chirp.CreatedAt) > cfg.ChirpEditWindow {
+			RespondWithError(w, http.StatusForbidden, fmt.Sprintf("chirps can only be edited within %s of posting", cfg.ChirpEditWindow))
+			return
+		}
+
+		filtered, ok := filterChirpBody(w, cfg, req.Body)
+		if !ok {
+			return
+		}
+		if filtered.Text != chirp.Body {
+			if err := cfg.Store.EditChirp(r.Context(), chirp, filtered.Text); err != nil {
+				if errors.Is(err, store.ErrConflict) {
+					RespondWithError(w, http.StatusConflict, "Chirp was edited concurrently, fetch it and try again")
+					return
+				}
+				RespondWithError(w, http.StatusInternalServerError, "Failed to edit chirp")
+				return
+			}
+		}
+		if len(filtered.Flagged) > 0 && !chirp.Flagged {
+			if err := cfg.Store.SetChirpFlagged(r.Context(), chirp.ID, true); err != nil {
+				RespondWithError(w, http.StatusInternalServerError, "Failed to flag chirp for review")
+				return
+			}
+			chirp.Flagged = true
+		}
+
+		renderer, err := newChirpRenderer(r, cfg, *chirp)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, renderer.response(chirp))
+	}
+}
+
+// HandleListChirpRevisions returns the bodies a chirp had before its
+// edits, oldest first.
+func HandleListChirpRevisions(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := parseChirpIDFromPath(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := cfg.Store.GetChirpByID(r.Context(), chirpID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusNotFound, "Chirp not found")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+			return
+		}
+
+		revisions, err := cfg.Store.ListChirpRevisions(r.Context(), chirpID)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve revisions")
+			return
+		}
+
+		responses := make([]models.ChirpRevisionResponse, len(revisions))
+		for i, revision := range revisions {
+			responses[i] = models.ChirpRevisionResponse{
+				Id:         strconv.FormatUint(uint64(revision.ID), 10),
+				Body:       revision.Body,
+				ReplacedAt: revision.CreatedAt.Format(time.RFC3339),
+			}
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
 	}
 }
 
@@ -71,16 +181,6 @@ func parseChirpIDFromPath(r *http.Request) (uint, error) {
 	return uint(chirpID), nil
 }
 
-func findChirpByID(db *gorm.DB, chirpID uint) (*models.Chirp, error) {
-	var chirp models.Chirp
-	result := db.First(&chirp, chirpID)
-	return &chirp, result.Error
-}
-
-func isChirpOwner(tokenUserId string, chirpUserID uint) bool {
-	return tokenUserId == strconv.FormatUint(uint64(chirpUserID), 10)
-}
-
 func HandleGetChirpById(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		chirpIDStr := r.PathValue("chirpID")
@@ -93,109 +193,426 @@ func HandleGetChirpById(cfg *config.Config) http.HandlerFunc {
 			RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID format")
 			return
 		}
-		var chirp models.Chirp
-		result := cfg.DB.First(&chirp, uint(chirpID))
-		if result.Error != nil {
+		chirp, err := cfg.Store.GetChirpByID(r.Context(), uint(chirpID))
+		if err != nil {
 			RespondWithError(w, http.StatusNotFound, "Chirp not found")
 			return
 		}
-		response := buildChirpResponse(&chirp)
-		RespondWithJSON(w, http.StatusOK, response)
+		renderer, err := newChirpRenderer(r, cfg, *chirp)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, renderer.response(chirp))
 	}
 }
 
+const (
+	defaultChirpPageSize = 50
+	maxChirpPageSize     = 100
+)
+
+// HandleGetAllChirps lists chirps a page at a time. The body stays a plain
+// array; when more chirps follow, the next page's URL is sent in a Link
+// header and its cursor in X-Next-Cursor.
 func HandleGetAllChirps(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authorIDStr := r.URL.Query().Get("author_id")
-		sortOrder := r.URL.Query().Get("sort")
+		query := r.URL.Query()
+		filter := store.ChirpFilter{Descending: query.Get("sort") == "desc"}
 
-		query := cfg.DB
-		if authorIDStr != "" {
+		if authorIDStr := query.Get("author_id"); authorIDStr != "" {
 			authorID, err := strconv.ParseUint(authorIDStr, 10, 32)
 			if err != nil {
 				RespondWithError(w, http.StatusBadRequest, "Invalid author_id format")
 				return
 			}
-			query = query.Where("user_id = ?", uint(authorID))
+			filter.AuthorID = uint(authorID)
 		}
 
-		var chirps []models.Chirp
-		if err := query.Find(&chirps).Error; err != nil {
+		limit, after, ok := parsePage(w, query)
+		if !ok {
+			return
+		}
+		// One extra row tells us whether there is a next page.
+		filter.Limit = limit + 1
+		filter.After = after
+
+		chirps, err := cfg.Store.ListChirps(r.Context(), filter)
+		if err != nil {
 			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
 			return
 		}
 
+		if len(chirps) > limit {
+			chirps = chirps[:limit]
+			last := chirps[limit-1]
+			setNextPage(w, r, limit, store.ChirpCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
+
+		renderer, err := newChirpRenderer(r, cfg, chirps...)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
 		responses := make([]models.ChirpResponse, len(chirps))
 		for i, chirp := range chirps {
-			responses[i] = buildChirpResponse(&chirp)
+			responses[i] = renderer.response(&chirp)
 		}
 
-		sortResponses(responses, sortOrder)
-
 		RespondWithJSON(w, http.StatusOK, responses)
 	}
 }
 
-func sortResponses(responses []models.ChirpResponse, sortOrder string) {
-	if sortOrder == "desc" {
-		sort.Slice(responses, func(i, j int) bool {
-			return responses[i].CreatedAt > responses[j].CreatedAt
-		})
-	} else {
-		sort.Slice(responses, func(i, j int) bool {
-			return responses[i].CreatedAt < responses[j].CreatedAt
-		})
+// HandleSearchChirps finds chirps by content, most relevant first.
+func HandleSearchChirps(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		q, err := search.Parse(query.Get("q"))
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params := store.ChirpSearch{Query: q, Limit: defaultChirpPageSize}
+
+		if authorIDStr := query.Get("author_id"); authorIDStr != "" {
+			authorID, err := strconv.ParseUint(authorIDStr, 10, 32)
+			if err != nil {
+				RespondWithError(w, http.StatusBadRequest, "Invalid author_id format")
+				return
+			}
+			params.AuthorID = uint(authorID)
+		}
+
+		if limitStr := query.Get("limit"); limitStr != "" {
+			n, err := strconv.Atoi(limitStr)
+			if err != nil || n < 1 {
+				RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be a number between 1 and %d", maxChirpPageSize))
+				return
+			}
+			params.Limit = min(n, maxChirpPageSize)
+		}
+
+		matches, err := cfg.Store.SearchChirps(r.Context(), params)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to search chirps")
+			return
+		}
+
+		chirps := make([]models.Chirp, len(matches))
+		for i, match := range matches {
+			chirps[i] = match.Chirp
+		}
+		renderer, err := newChirpRenderer(r, cfg, chirps...)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+
+		results := make([]models.ChirpSearchResult, len(matches))
+		for i, match := range matches {
+			results[i] = models.ChirpSearchResult{
+				ChirpResponse: renderer.response(&match.Chirp),
+				Score:         match.Score,
+				Highlighted:   search.Highlight(match.Chirp.Body, q),
+			}
+		}
+		RespondWithJSON(w, http.StatusOK, results)
 	}
 }
 
-func HandleCreateChirp(cfg *config.Config) http.HandlerFunc {
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+	// threadRepliesPerChirp caps the replies shown below each chirp past
+	// the first level, and maxThreadChirps the replies in one response;
+	// anything cut is flagged with more_replies.
+	threadRepliesPerChirp = 10
+	maxThreadChirps       = 500
+)
+
+// HandleGetChirpThread returns a chirp with the chirps it replies to and
+// the replies below it, depth levels deep. The chirp's direct replies are
+// paged with the same cursor as GET /api/chirps; deeper levels are loaded
+// one query per level and capped at threadRepliesPerChirp each.
+func HandleGetChirpThread(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+		chirpID, err := parseChirpIDFromPath(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		query := r.URL.Query()
+		limit, after, ok := parsePage(w, query)
+		if !ok {
+			return
+		}
+
+		depth := defaultThreadDepth
+		if depthStr := query.Get("depth"); depthStr != "" {
+			n, err := strconv.Atoi(depthStr)
+			if err != nil || n < 1 {
+				RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("depth must be a number between 1 and %d", maxThreadDepth))
+				return
+			}
+			depth = min(n, maxThreadDepth)
+		}
+
+		chirp, err := cfg.Store.GetChirpByID(r.Context(), chirpID)
 		if err != nil {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid token")
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusNotFound, "Chirp not found")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
 			return
 		}
 
-		tokenUserId, err := auth.ValidateJWT(token, cfg.JWTSecret)
+		ancestors, err := cfg.Store.ListAncestors(r.Context(), chirp.ID)
 		if err != nil {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid token")
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve conversation")
 			return
 		}
 
-		req, err := parseChirpRequest(r)
+		direct, err := cfg.Store.ListReplies(r.Context(), store.ReplyFilter{
+			ParentIDs: []uint{chirp.ID},
+			After:     after,
+			Limit:     limit + 1,
+		})
 		if err != nil {
-			RespondWithError(w, http.StatusBadRequest, err.Error())
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve replies")
 			return
 		}
+		var nextCursor string
+		if len(direct) > limit {
+			direct = direct[:limit]
+			last := direct[limit-1]
+			nextCursor = encodeChirpCursor(store.ChirpCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
 
-		if err := validateChirpBody(req.Body); err != nil {
-			RespondWithError(w, http.StatusBadRequest, err.Error())
+		// Load the deeper levels one query each, asking only about chirps
+		// that have replies, until the depth or the budget runs out.
+		replies := make(map[uint][]models.Chirp)
+		loaded := append([]models.Chirp{}, direct...)
+		level := direct
+		for remaining := depth - 1; remaining > 0 && len(loaded) < maxThreadChirps; remaining-- {
+			var parentIDs []uint
+			for _, c := range level {
+				if c.ReplyCount > 0 {
+					parentIDs = append(parentIDs, c.ID)
+				}
+			}
+			if len(parentIDs) == 0 {
+				break
+			}
+			level, err = cfg.Store.ListReplies(r.Context(), store.ReplyFilter{
+				ParentIDs: parentIDs,
+				PerParent: threadRepliesPerChirp,
+				Limit:     maxThreadChirps - len(loaded),
+			})
+			if err != nil {
+				RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve replies")
+				return
+			}
+			for _, c := range level {
+				replies[*c.InReplyToID] = append(replies[*c.InReplyToID], c)
+			}
+			loaded = append(loaded, level...)
+		}
+
+		renderer, err := newChirpRenderer(r, cfg, append(append(loaded, ancestors...), *chirp)...)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
 			return
 		}
 
-		userID, err := parseUserID(req.UserId)
+		response := models.ThreadResponse{
+			Ancestors:  make([]models.ChirpResponse, len(ancestors)),
+			NextCursor: nextCursor,
+		}
+		for i := range ancestors {
+			response.Ancestors[i] = renderer.response(&ancestors[i])
+		}
+		response.Chirp = models.ThreadNode{
+			ChirpResponse: renderer.response(chirp),
+			Replies:       make([]models.ThreadNode, len(direct)),
+		}
+		for i := range direct {
+			response.Chirp.Replies[i] = renderer.threadNode(&direct[i], replies)
+		}
+		RespondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// threadNode renders chirp and whichever of its replies were loaded,
+// flagging it when some were left out.
+func (cr *chirpRenderer) threadNode(chirp *models.Chirp, replies map[uint][]models.Chirp) models.ThreadNode {
+	node := models.ThreadNode{
+		ChirpResponse: cr.response(chirp),
+		Replies:       make([]models.ThreadNode, len(replies[chirp.ID])),
+	}
+	for i := range replies[chirp.ID] {
+		node.Replies[i] = cr.threadNode(&replies[chirp.ID][i], replies)
+	}
+	node.MoreReplies = chirp.ReplyCount > len(node.Replies)
+	return node
+}
+
+// parsePage reads the limit and cursor parameters shared by the paged
+// listings. On failure it has already written the response.
+func parsePage(w http.ResponseWriter, query url.Values) (int, *store.ChirpCursor, bool) {
+	limit := defaultChirpPageSize
+	if limitStr := query.Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be a number between 1 and %d", maxChirpPageSize))
+			return 0, nil, false
+		}
+		limit = min(n, maxChirpPageSize)
+	}
+
+	var after *store.ChirpCursor
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		after, err = decodeChirpCursor(cursor)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return 0, nil, false
+		}
+	}
+	return limit, after, true
+}
+
+// setNextPage points the client at the page after next with the Link and
+// X-Next-Cursor headers.
+func setNextPage(w http.ResponseWriter, r *http.Request, limit int, next store.ChirpCursor) {
+	cursor := encodeChirpCursor(next)
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	query.Set("limit", strconv.Itoa(limit))
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()))
+	w.Header().Set("X-Next-Cursor", cursor)
+}
+
+type chirpCursor struct {
+	CreatedAt string `json:"t"`
+	ID        uint   `json:"id"`
+}
+
+// encodeChirpCursor makes an opaque page token. The timestamp keeps its
+// full precision and zone offset so it compares equal to the stored value.
+func encodeChirpCursor(c store.ChirpCursor) string {
+	data, _ := json.Marshal(chirpCursor{CreatedAt: c.CreatedAt.Format(time.RFC3339Nano), ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeChirpCursor(s string) (*store.ChirpCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c chirpCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if c.ID == 0 {
+		return nil, errors.New("cursor has no chirp id")
+	}
+	return &store.ChirpCursor{CreatedAt: createdAt, ID: c.ID}, nil
+}
+
+func HandleCreateChirp(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.UserFromContext(r.Context())
+
+		req, err := parseChirpRequest(r)
 		if err != nil {
 			RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if tokenUserId != strconv.FormatUint(uint64(userID), 10) {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid token")
+		if err := validateChirpBody(req.Body, chirpMaxLength(cfg, user)); err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
+		// user_id is optional now that the author comes from the token, but
+		// older clients still send it and it must not name someone else.
+		if req.UserId != "" {
+			userID, err := parseUserID(req.UserId)
+			if err != nil {
+				RespondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if userID != user.ID {
+				RespondWithError(w, http.StatusForbidden, "user_id does not match the authenticated user")
+				return
+			}
+		}
+
+		filtered, ok := filterChirpBody(w, cfg, req.Body)
+		if !ok {
+			return
+		}
 		chirp := &models.Chirp{
-			Body:   cleanProfanity(req.Body),
-			UserID: userID,
+			Body:    filtered.Text,
+			UserID:  user.ID,
+			Flagged: len(filtered.Flagged) > 0,
 		}
 
-		if err := cfg.DB.Create(chirp).Error; err != nil {
+		if req.InReplyToId != "" {
+			parentID, err := strconv.ParseUint(req.InReplyToId, 10, 32)
+			if err != nil {
+				RespondWithError(w, http.StatusBadRequest, "Invalid in_reply_to_id format")
+				return
+			}
+			parent, err := cfg.Store.GetChirpByID(r.Context(), uint(parentID))
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					RespondWithError(w, http.StatusBadRequest, "in_reply_to_id does not match an existing chirp")
+					return
+				}
+				RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+				return
+			}
+			chirp.InReplyToID = &parent.ID
+			chirp.ConversationID = parent.ConversationID
+		}
+
+		if req.QuoteOfId != "" {
+			quotedID, err := strconv.ParseUint(req.QuoteOfId, 10, 32)
+			if err != nil {
+				RespondWithError(w, http.StatusBadRequest, "Invalid quote_of_id format")
+				return
+			}
+			quoted, err := shareableChirp(r, cfg, uint(quotedID))
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					RespondWithError(w, http.StatusBadRequest, "quote_of_id does not match an existing chirp")
+					return
+				}
+				RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+				return
+			}
+			chirp.QuoteOfID = &quoted.ID
+		}
+
+		if err := cfg.Store.CreateChirp(r.Context(), chirp); err != nil {
 			RespondWithError(w, http.StatusInternalServerError, "Failed to create chirp")
 			return
 		}
+		deliverChirp(r, cfg, chirp)
 
-		response := buildChirpResponse(chirp)
-		RespondWithJSON(w, http.StatusCreated, response)
+		renderer, err := newChirpRenderer(r, cfg, *chirp)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+			return
+		}
+		RespondWithJSON(w, http.StatusCreated, renderer.response(chirp))
 	}
 }
 
@@ -210,20 +627,33 @@ func parseChirpRequest(r *http.Request) (*models.ChirpRequest, error) {
 	return &req, nil
 }
 
-func validateChirpBody(body string) error {
-	const maxChirpLength = 140
-
+// validateChirpBody checks body against maxLength, counted as chirplen
+// counts it. A chirp over the limit is reported with how many characters
+// it is over, so a client can tell how much to cut.
+func validateChirpBody(body string, maxLength int) error {
 	if strings.TrimSpace(body) == "" {
 		return fmt.Errorf("chirp body cannot be empty")
 	}
 
-	if len(body) > maxChirpLength {
-		return fmt.Errorf("chirp is too long (max %d characters)", maxChirpLength)
+	if over := chirplen.Count(body) - maxLength; over > 0 {
+		unit := "characters"
+		if over == 1 {
+			unit = "character"
+		}
+		return fmt.Errorf("chirp is %d %s over the %d-character limit", over, unit, maxLength)
 	}
 
 	return nil
 }
 
+// chirpMaxLength is the longest chirp user may post.
+func chirpMaxLength(cfg *config.Config, user *models.User) int {
+	if user.IsChirpyRed {
+		return cfg.ChirpyRedChirpMaxLength
+	}
+	return cfg.ChirpMaxLength
+}
+
 func parseUserID(userIDStr string) (uint, error) {
 	if userIDStr == "" {
 		return 0, fmt.Errorf("user ID is required")
@@ -242,27 +672,129 @@ func parseUserID(userIDStr string) (uint, error) {
 }
 
 func buildChirpResponse(chirp *models.Chirp) models.ChirpResponse {
-	return models.ChirpResponse{
-		Id:        strconv.FormatUint(uint64(chirp.ID), 10),
-		CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
-		Body:      chirp.Body,
-		UserId:    strconv.FormatUint(uint64(chirp.UserID), 10),
+	response := models.ChirpResponse{
+		Id:             strconv.FormatUint(uint64(chirp.ID), 10),
+		CreatedAt:      chirp.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      chirp.UpdatedAt.Format(time.RFC3339),
+		Body:           chirp.Body,
+		UserId:         strconv.FormatUint(uint64(chirp.UserID), 10),
+		Edited:         chirp.EditedAt != nil,
+		ConversationId: strconv.FormatUint(uint64(chirp.ConversationID), 10),
+		ReplyCount:     chirp.ReplyCount,
+		LikeCount:      chirp.LikeCount,
+		ShareCount:     chirp.ShareCount,
+		Entities: models.ChirpEntities{
+			Hashtags: []models.HashtagEntity{},
+			Mentions: []models.MentionEntity{},
+		},
+	}
+	if chirp.InReplyToID != nil {
+		response.InReplyToId = strconv.FormatUint(uint64(*chirp.InReplyToID), 10)
+	}
+	if chirp.RechirpOfID != nil {
+		response.RechirpOfId = strconv.FormatUint(uint64(*chirp.RechirpOfID), 10)
+	}
+	if chirp.QuoteOfID != nil {
+		response.QuoteOfId = strconv.FormatUint(uint64(*chirp.QuoteOfID), 10)
 	}
+	return response
 }
 
-func cleanProfanity(text string) string {
-	profaneWords := []string{"kerfuffle", "sharbert", "fornax"}
-	words := strings.Fields(text)
+// chirpRenderer builds the responses for a batch of chirps as seen by the
+// user making the request. It loads the chirps they rechirp or quote, their
+// entities and what the user liked up front, one query each.
+type chirpRenderer struct {
+	liked     map[uint]bool
+	originals map[uint]*models.Chirp
+	entities  map[uint]store.ChirpEntities
+}
 
-	for i, word := range words {
-		for _, profane := range profaneWords {
-			if strings.EqualFold(word, profane) {
-				words[i] = "****"
-				break
-			}
+func newChirpRenderer(r *http.Request, cfg *config.Config, chirps ...models.Chirp) (*chirpRenderer, error) {
+	cr := &chirpRenderer{originals: make(map[uint]*models.Chirp)}
+
+	var sharedIDs []uint
+	for _, chirp := range chirps {
+		if shared := chirp.SharedChirpID(); shared != nil {
+			sharedIDs = append(sharedIDs, *shared)
 		}
 	}
+	originals, err := cfg.Store.GetChirpsByIDs(r.Context(), sharedIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range originals {
+		cr.originals[originals[i].ID] = &originals[i]
+	}
+
+	ids := make([]uint, 0, len(chirps)+len(originals))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	for _, original := range originals {
+		ids = append(ids, original.ID)
+	}
+	cr.entities, err = cfg.Store.ListChirpEntities(r.Context(), ids)
+	if err != nil {
+		return nil, err
+	}
 
-	return strings.Join(words, " ")
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok || len(chirps) == 0 {
+		return cr, nil
+	}
+	liked, err := cfg.Store.LikedChirpIDs(r.Context(), user.ID, ids)
+	if err != nil {
+		return nil, err
+	}
+	cr.liked = liked
+	return cr, nil
+}
+
+func (cr *chirpRenderer) response(chirp *models.Chirp) models.ChirpResponse {
+	response := cr.single(chirp)
+	if shared := chirp.SharedChirpID(); shared != nil {
+		original, ok := cr.originals[*shared]
+		if !ok {
+			response.OriginalDeleted = true
+			return response
+		}
+		// Only one level is embedded; an original that is itself a quote
+		// still names what it quotes.
+		embedded := cr.single(original)
+		response.Original = &embedded
+	}
+	return response
+}
+
+// single renders chirp without embedding what it shares.
+func (cr *chirpRenderer) single(chirp *models.Chirp) models.ChirpResponse {
+	response := buildChirpResponse(chirp)
+	response.LikedByMe = cr.liked[chirp.ID]
+	found := cr.entities[chirp.ID]
+	for _, hashtag := range found.Hashtags {
+		response.Entities.Hashtags = append(response.Entities.Hashtags, models.HashtagEntity{
+			Tag:   hashtag.Tag,
+			Start: hashtag.StartOffset,
+			End:   hashtag.EndOffset,
+		})
+	}
+	for _, mention := range found.Mentions {
+		response.Entities.Mentions = append(response.Entities.Mentions, models.MentionEntity{
+			Username: mention.Username,
+			Start:    mention.StartOffset,
+			End:      mention.EndOffset,
+		})
+	}
+	return response
+}
+
+// filterChirpBody runs body through the profanity filter. When the body
+// uses a rejected word it has already written the response.
+func filterChirpBody(w http.ResponseWriter, cfg *config.Config, body string) (profanity.Result, bool) {
+	result := cfg.Profanity.Apply(body)
+	if len(result.Rejected) > 0 {
+		RespondWithError(w, http.StatusBadRequest, "chirp contains words that are not allowed: "+strings.Join(result.Rejected, ", "))
+		return result, false
+	}
+	return result, true
 }
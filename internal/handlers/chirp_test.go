@@ -39,18 +39,34 @@ func TestValidateChirpBody(t *testing.T) {
 			name:        "Too Long Chirp",
 			body:        strings.Repeat("a", 141), // 141 chars
 			expectError: true,
-			errorMsg:    "chirp is too long (max 140 characters)",
+			errorMsg:    "chirp is 1 character over the 140-character limit",
 		},
 		{
 			name:        "Max Length Chirp",
 			body:        strings.Repeat("a", 140), // 140 chars
 			expectError: false,
 		},
+		{
+			name:        "Max Length Emoji Chirp",
+			body:        strings.Repeat("👍🏽", 140), // 140 characters, 1120 bytes
+			expectError: false,
+		},
+		{
+			name:        "Long URL Counts Fixed Weight",
+			body:        strings.Repeat("a", 100) + " https://example.com/" + strings.Repeat("p", 100),
+			expectError: false,
+		},
+		{
+			name:        "Too Long Vietnamese Chirp",
+			body:        strings.Repeat("Việt ", 30), // 150 characters
+			expectError: true,
+			errorMsg:    "chirp is 10 characters over the 140-character limit",
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			err := validateChirpBody(tc.body)
+			err := validateChirpBody(tc.body, 140)
 
 			if tc.expectError {
 				if err == nil {
@@ -144,54 +160,6 @@ func TestParseUserID(t *testing.T) {
 	}
 }
 
-func TestCleanProfanity(t *testing.T) {
-	tests := []struct {
-		name     string
-		text     string
-		expected string
-	}{
-		{
-			name:     "No profanity",
-			text:     "This is a clean text",
-			expected: "This is a clean text",
-		},
-		{
-			name:     "Contains profanity",
-			text:     "This is kerfuffle and sharbert",
-			expected: "This is **** and ****",
-		},
-		{
-			name:     "Case insensitive",
-			text:     "This is KERFUFFLE and Sharbert",
-			expected: "This is **** and ****",
-		},
-		{
-			name:     "Mixed with other words",
-			text:     "kerfuffle start sharbert middle fornax end",
-			expected: "**** start **** middle **** end",
-		},
-		{
-			name:     "Only profanity",
-			text:     "kerfuffle",
-			expected: "****",
-		},
-		{
-			name:     "Empty string",
-			text:     "",
-			expected: "",
-		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			result := cleanProfanity(tc.text)
-			if result != tc.expected {
-				t.Errorf("expected '%s', got '%s'", tc.expected, result)
-			}
-		})
-	}
-}
-
 func TestBuildChirpResponse(t *testing.T) {
 	now := time.Now()
 	chirp := &models.Chirp{
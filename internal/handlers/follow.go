@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/middleware"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+// followBackfillSize is how many of a user's latest chirps are copied into
+// a new follower's stored timeline when timelines fan out on write.
+const followBackfillSize = 100
+
+// HandleFollowUser makes the authenticated user follow another. Following
+// someone twice changes nothing.
+func HandleFollowUser(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		followee, ok := userFromPath(w, r, cfg)
+		if !ok {
+			return
+		}
+		user, _ := middleware.UserFromContext(r.Context())
+		if followee.ID == user.ID {
+			RespondWithError(w, http.StatusBadRequest, "You cannot follow yourself")
+			return
+		}
+
+		if err := cfg.Store.Follow(r.Context(), user.ID, followee.ID); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to follow user")
+			return
+		}
+		if cfg.TimelineFanout == config.FanoutOnWrite {
+			if err := cfg.Store.BackfillTimeline(r.Context(), user.ID, followee.ID, followBackfillSize); err != nil {
+				RespondWithError(w, http.StatusInternalServerError, "Failed to update timeline")
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleUnfollowUser stops the authenticated user following another, if
+// they were.
+func HandleUnfollowUser(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		followee, ok := userFromPath(w, r, cfg)
+		if !ok {
+			return
+		}
+		user, _ := middleware.UserFromContext(r.Context())
+
+		followers, err := cfg.Store.Unfollow(r.Context(), user.ID, followee.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to unfollow user")
+			return
+		}
+		if cfg.TimelineFanout == config.FanoutOnWrite {
+			if err := cfg.Store.PruneTimeline(r.Context(), user.ID, followee.ID); err != nil {
+				RespondWithError(w, http.StatusInternalServerError, "Failed to update timeline")
+				return
+			}
+			// Back at the cap, the followee's chirps stop being merged
+			// into timelines on read, so those posted while they were over
+			// it are copied in.
+			if followers == cfg.TimelineFanoutMaxFollowers {
+				if err := cfg.Store.BackfillFollowerTimelines(r.Context(), followee.ID, followBackfillSize); err != nil {
+					RespondWithError(w, http.StatusInternalServerError, "Failed to update timeline")
+					return
+				}
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListFollowers lists who follows a user, most recent first.
+func HandleListFollowers(cfg *config.Config) http.HandlerFunc {
+	return handleListFollows(cfg, true)
+}
+
+// HandleListFollowing lists who a user follows, most recent first.
+func HandleListFollowing(cfg *config.Config) http.HandlerFunc {
+	return handleListFollows(cfg, false)
+}
+
+func handleListFollows(cfg *config.Config, followers bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromPath(w, r, cfg)
+		if !ok {
+			return
+		}
+		limit, after, ok := parsePage(w, r.URL.Query())
+		if !ok {
+			return
+		}
+
+		list := cfg.Store.ListFollowing
+		if followers {
+			list = cfg.Store.ListFollowers
+		}
+		users, err := list(r.Context(), store.FollowFilter{UserID: user.ID, After: after, Limit: limit + 1})
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve follows")
+			return
+		}
+
+		if len(users) > limit {
+			users = users[:limit]
+			last := users[limit-1]
+			setNextPage(w, r, limit, store.ChirpCursor{CreatedAt: last.FollowedAt, ID: last.User.ID})
+		}
+
+		responses := make([]models.FollowResponse, len(users))
+		for i, u := range users {
+			responses[i] = models.FollowResponse{
+				UserId:     strconv.FormatUint(uint64(u.User.ID), 10),
+				FollowedAt: u.FollowedAt.Format(time.RFC3339),
+			}
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
+	}
+}
+
+// HandleTimeline lists the chirps of the authenticated user and everyone
+// they follow, newest first, paged like GET /api/chirps.
+func HandleTimeline(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.UserFromContext(r.Context())
+
+		limit, after, ok := parsePage(w, r.URL.Query())
+		if !ok {
+			return
+		}
+		filter := store.TimelineFilter{UserID: user.ID, After: after, Limit: limit + 1}
+		if cfg.TimelineFanout == config.FanoutOnWrite {
+			filter.Precomputed = true
+			filter.FanoutMaxFollowers = cfg.TimelineFanoutMaxFollowers
+		}
+		chirps, err := cfg.Store.ListTimeline(r.Context(), filter)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve timeline")
+			return
+		}
+
+		if len(chirps) > limit {
+			chirps = chirps[:limit]
+			last := chirps[limit-1]
+			setNextPage(w, r, limit, store.ChirpCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
+
+		renderer, err := newChirpRenderer(r, cfg, chirps...)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+		responses := make([]models.ChirpResponse, len(chirps))
+		for i, chirp := range chirps {
+			responses[i] = renderer.response(&chirp)
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
+	}
+}
+
+// deliverChirp copies a new chirp into its readers' stored timelines when
+// timelines fan out on write, unless its author has so many followers that
+// their chirps are merged in on read instead. The chirp is already saved, so a failure is
+// logged rather than failing the request.
+func deliverChirp(r *http.Request, cfg *config.Config, chirp *models.Chirp) {
+	if cfg.TimelineFanout != config.FanoutOnWrite {
+		return
+	}
+	if err := cfg.Store.DeliverChirp(r.Context(), chirp, cfg.TimelineFanoutMaxFollowers); err != nil {
+		log.Printf("delivering chirp %d to timelines: %v", chirp.ID, err)
+	}
+}
+
+// userFromPath loads the user named by the userID path value. On failure
+// it has already written the response.
+func userFromPath(w http.ResponseWriter, r *http.Request, cfg *config.Config) (*models.User, bool) {
+	userID, err := parseUserID(r.PathValue("userID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	user, err := cfg.Store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			RespondWithError(w, http.StatusNotFound, "User not found")
+			return nil, false
+		}
+		RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return nil, false
+	}
+	return user, true
+}
@@ -56,7 +56,7 @@ func TestHandleCreateChipWithMocks(t *testing.T) {
 				if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
 					t.Fatalf("Failed to decode error response: %v", err)
 				}
-				if errorResp.Error != "chirp is too long (max 140 characters)" {
+				if errorResp.Error != "chirp is 1 character over the 140-character limit" {
 					t.Errorf("expected error message about chirp length, got '%s'", errorResp.Error)
 				}
 			},
@@ -70,7 +70,7 @@ func TestHandleCreateChipWithMocks(t *testing.T) {
 
 			chirpReq, err := parseChirpRequest(req)
 			if err == nil {
-				err = validateChirpBody(chirpReq.Body)
+				err = validateChirpBody(chirpReq.Body, 140)
 				if err == nil {
 					_, err = parseUserID(chirpReq.UserId)
 				}
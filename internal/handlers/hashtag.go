@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/entities"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+const (
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 50
+)
+
+// HandleListHashtagChirps lists the chirps using a hashtag, newest first,
+// paged like GET /api/chirps. The tag may be given with or without its #
+// and in any case.
+func HandleListHashtagChirps(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := entities.NormalizeHashtag(r.PathValue("tag"))
+		if tag == "" {
+			RespondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+			return
+		}
+
+		limit, after, ok := parsePage(w, r.URL.Query())
+		if !ok {
+			return
+		}
+		chirps, err := cfg.Store.ListHashtagChirps(r.Context(), store.HashtagFilter{Tag: tag, After: after, Limit: limit + 1})
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+
+		if len(chirps) > limit {
+			chirps = chirps[:limit]
+			last := chirps[limit-1]
+			setNextPage(w, r, limit, store.ChirpCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
+
+		renderer, err := newChirpRenderer(r, cfg, chirps...)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+		responses := make([]models.ChirpResponse, len(chirps))
+		for i, chirp := range chirps {
+			responses[i] = renderer.response(&chirp)
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
+	}
+}
+
+// HandleTrendingHashtags ranks the hashtags of chirps posted within the
+// trending window by how many chirps used them.
+func HandleTrendingHashtags(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultTrendingLimit
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			n, err := strconv.Atoi(limitStr)
+			if err != nil || n < 1 {
+				RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be a number between 1 and %d", maxTrendingLimit))
+				return
+			}
+			limit = min(n, maxTrendingLimit)
+		}
+
+		trending, err := cfg.Store.TrendingHashtags(r.Context(), time.Now().Add(-cfg.TrendingWindow), limit)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve trending hashtags")
+			return
+		}
+
+		responses := make([]models.TrendingHashtagResponse, len(trending))
+		for i, t := range trending {
+			responses[i] = models.TrendingHashtagResponse{Tag: t.Tag, ChirpCount: t.ChirpCount}
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
+	}
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+)
+
+func HandleJWKS(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		RespondWithJSON(w, http.StatusOK, cfg.JWTKeys.JWKS())
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/middleware"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+// HandleLikeChirp likes a chirp for the authenticated user. Liking a chirp
+// that is already liked changes nothing.
+func HandleLikeChirp(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := parseChirpIDFromPath(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		user, _ := middleware.UserFromContext(r.Context())
+
+		if err := cfg.Store.LikeChirp(r.Context(), user.ID, chirpID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusNotFound, "Chirp not found")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to like chirp")
+			return
+		}
+		respondWithLikeState(w, r, cfg, chirpID, true)
+	}
+}
+
+// HandleUnlikeChirp removes the authenticated user's like, if there is one.
+func HandleUnlikeChirp(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := parseChirpIDFromPath(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		user, _ := middleware.UserFromContext(r.Context())
+
+		if err := cfg.Store.UnlikeChirp(r.Context(), user.ID, chirpID); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to unlike chirp")
+			return
+		}
+		respondWithLikeState(w, r, cfg, chirpID, false)
+	}
+}
+
+// respondWithLikeState answers a like or unlike with the chirp's new count.
+func respondWithLikeState(w http.ResponseWriter, r *http.Request, cfg *config.Config, chirpID uint, liked bool) {
+	chirp, err := cfg.Store.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+	renderer, err := newChirpRenderer(r, cfg, *chirp)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+		return
+	}
+	response := renderer.response(chirp)
+	response.LikedByMe = liked
+	RespondWithJSON(w, http.StatusOK, response)
+}
+
+// HandleListUserLikes lists the chirps a user liked, most recent like
+// first, paged like GET /api/chirps.
+func HandleListUserLikes(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromPath(w, r, cfg)
+		if !ok {
+			return
+		}
+
+		limit, after, ok := parsePage(w, r.URL.Query())
+		if !ok {
+			return
+		}
+		likes, err := cfg.Store.ListLikedChirps(r.Context(), store.LikeFilter{UserID: user.ID, After: after, Limit: limit + 1})
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve likes")
+			return
+		}
+
+		if len(likes) > limit {
+			likes = likes[:limit]
+			last := likes[limit-1]
+			setNextPage(w, r, limit, store.ChirpCursor{CreatedAt: last.LikedAt, ID: last.Chirp.ID})
+		}
+
+		chirps := make([]models.Chirp, len(likes))
+		for i, like := range likes {
+			chirps[i] = like.Chirp
+		}
+		renderer, err := newChirpRenderer(r, cfg, chirps...)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+
+		responses := make([]models.LikedChirpResponse, len(likes))
+		for i, like := range likes {
+			responses[i] = models.LikedChirpResponse{
+				ChirpResponse: renderer.response(&like.Chirp),
+				LikedAt:       like.LikedAt.Format(time.RFC3339),
+			}
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
+	}
+}
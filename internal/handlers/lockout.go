@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+// loginLimit is one subject failed logins are counted against.
+type loginLimit struct {
+	scope       string
+	subject     string
+	maxFailures int
+	// failures is the subject's count with this attempt in it, filled in
+	// by reserveLoginAttempt.
+	failures int
+}
+
+// loginLimits returns what a login for email from r counts against: the
+// email address, whether or not it has an account, and the client's IP
+// address.
+func loginLimits(cfg *config.Config, r *http.Request, email string) []loginLimit {
+	return append(accountLimits(cfg, email), loginLimit{scope: models.LoginScopeIP, subject: clientIP(cfg, r), maxFailures: cfg.LoginIPMaxFailures})
+}
+
+// accountLimits returns the limit for email alone. Signed-in users checking
+// a two-factor code count against it, so a stolen access token does not
+// get a fresh allowance of guesses.
+func accountLimits(cfg *config.Config, email string) []loginLimit {
+	return []loginLimit{{scope: models.LoginScopeAccount, subject: normalizeLoginEmail(email), maxFailures: cfg.LoginMaxFailures}}
+}
+
+// normalizeLoginEmail keeps differently written forms of an address from
+// getting separate allowances.
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP returns the IP address r came from. That is the connection's
+// address unless it belongs to one of cfg.TrustedProxies, in which case
+// X-Forwarded-For is read from the right, past any further trusted
+// proxies. Entries left of the first untrusted one could have been written
+// by the client, so they are never believed.
+func clientIP(cfg *config.Config, r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && trustedProxy(cfg, addr); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+	}
+	return addr.String()
+}
+
+func trustedProxy(cfg *config.Config, addr netip.Addr) bool {
+	for _, prefix := range cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockoutDuration is how long a subject is locked out after failures
+// failed logins in a row: nothing below maxFailures, then cfg.LoginLockout,
+// doubling with each further failure up to cfg.LoginMaxLockout.
+func lockoutDuration(cfg *config.Config, failures, maxFailures int) time.Duration {
+	if failures < maxFailures {
+		return 0
+	}
+	lockout := cfg.LoginLockout
+	for i := maxFailures; i < failures && lockout < cfg.LoginMaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, cfg.LoginMaxLockout)
+}
+
+// reserveLoginAttempt counts an attempt against each of limits before the
+// password or code is checked, and answers the request with a 429 if any
+// of them is locked out or has no attempts left, reporting whether it did.
+// Counting first means guesses sent in parallel cannot all pass the check
+// before any of them is counted: each subject gets at most its allowance
+// checked at once, or one attempt once a lockout has run out. Refused
+// requests never reach bcrypt, so guessing costs the server next to
+// nothing.
+func reserveLoginAttempt(w http.ResponseWriter, r *http.Request, cfg *config.Config, limits []loginLimit, now time.Time) bool {
+	ctx := r.Context()
+	// A subject whose lockout has run out gets one more attempt even
+	// though it is past its allowance.
+	allowed := make([]int, len(limits))
+	var wait time.Duration
+	for i, limit := range limits {
+		attempt, err := cfg.Store.GetLoginAttempt(ctx, limit.scope, limit.subject)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+			return true
+		}
+		if attempt.LockedUntil != nil {
+			wait = max(wait, attempt.LockedUntil.Sub(now))
+			allowed[i] = attempt.Failures + 1
+		}
+	}
+
+	if wait <= 0 {
+		for i := range limits {
+			limit := &limits[i]
+			attempt, err := cfg.Store.RecordLoginFailure(ctx, limit.scope, limit.subject, now, now.Add(-cfg.LoginMaxLockout))
+			if err != nil {
+				RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+				return true
+			}
+			limit.failures = attempt.Failures
+			if limit.failures <= max(limit.maxFailures, allowed[i]) {
+				continue
+			}
+			// Other attempts got in first and are still being checked.
+			// This one is refused as if it had failed.
+			lockout := lockoutDuration(cfg, limit.failures, limit.maxFailures)
+			if err := cfg.Store.LockLogin(ctx, limit.scope, limit.subject, now.Add(lockout)); err != nil {
+				RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+				return true
+			}
+			wait = max(wait, lockout)
+		}
+	}
+	if wait <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	RespondWithError(w, http.StatusTooManyRequests, "too many failed login attempts, try again later")
+	return true
+}
+
+// lockFailedLogin locks out each of limits whose reserved attempt, now
+// known to have failed, was one too many.
+func lockFailedLogin(ctx context.Context, cfg *config.Config, limits []loginLimit, now time.Time) error {
+	for _, limit := range limits {
+		if lockout := lockoutDuration(cfg, limit.failures, limit.maxFailures); lockout > 0 {
+			if err := cfg.Store.LockLogin(ctx, limit.scope, limit.subject, now.Add(lockout)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseLoginAttempt gives back the attempts reserved for a step that
+// succeeded. Once the login is complete the email address's failures are
+// forgotten, and the IP address also gets back one earlier failure, so the
+// typos of everyone behind a shared address do not add up to a lockout
+// while a run of failures from it still does. Until then, such as after a
+// correct password with a code still to come, nothing else is forgiven.
+func releaseLoginAttempt(ctx context.Context, cfg *config.Config, limits []loginLimit, complete bool) error {
+	for _, limit := range limits {
+		var err error
+		switch {
+		case complete && limit.scope == models.LoginScopeAccount:
+			err = cfg.Store.ClearLoginAttempts(ctx, limit.scope, limit.subject)
+			if errors.Is(err, store.ErrNotFound) {
+				err = nil
+			}
+		case complete:
+			err = cfg.Store.ForgiveLoginFailures(ctx, limit.scope, limit.subject, 2)
+		default:
+			err = cfg.Store.ForgiveLoginFailures(ctx, limit.scope, limit.subject, 1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondWithLoginFailure settles a failed login against limits and
+// answers it with message.
+func respondWithLoginFailure(w http.ResponseWriter, r *http.Request, cfg *config.Config, limits []loginLimit, now time.Time, message string) {
+	if err := lockFailedLogin(r.Context(), cfg, limits, now); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+	RespondWithError(w, http.StatusUnauthorized, message)
+}
+
+// respondWithCodeFailure settles a wrong two-factor code from a signed-in
+// user against limits, like a failed login, and answers it with status.
+func respondWithCodeFailure(w http.ResponseWriter, r *http.Request, cfg *config.Config, limits []loginLimit, now time.Time, status int) {
+	if err := lockFailedLogin(r.Context(), cfg, limits, now); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to check code")
+		return
+	}
+	RespondWithError(w, status, "invalid two-factor code")
+}
+
+// HandleListLoginLockouts lists the email and IP addresses that are
+// locked out of logging in, longest lockout first.
+func HandleListLoginLockouts(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		attempts, err := cfg.Store.ListLoginLockouts(r.Context(), time.Now())
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to list lockouts")
+			return
+		}
+		responses := make([]models.LoginLockoutResponse, len(attempts))
+		for i, attempt := range attempts {
+			responses[i] = models.LoginLockoutResponse{
+				Scope:       attempt.Scope,
+				Subject:     attempt.Subject,
+				Failures:    attempt.Failures,
+				LockedUntil: attempt.LockedUntil.Format(time.RFC3339),
+			}
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
+	}
+}
+
+// HandleClearLoginLockout lifts a lockout and forgets the failed logins
+// behind it, so the email or IP address starts with a full allowance.
+func HandleClearLoginLockout(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, subject := r.PathValue("scope"), r.PathValue("subject")
+		switch scope {
+		case models.LoginScopeAccount:
+			subject = normalizeLoginEmail(subject)
+		case models.LoginScopeIP:
+		default:
+			RespondWithError(w, http.StatusBadRequest, "scope must be account or ip")
+			return
+		}
+
+		if err := cfg.Store.ClearLoginAttempts(r.Context(), scope, subject); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusNotFound, "no failed logins on record")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to clear lockout")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/middleware"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+	"github.com/G0SU19O2/Chirpy/internal/totp"
+)
+
+const (
+	// totpSkew is how many time steps either side of now a code is
+	// accepted from, allowing for clock drift and typing time.
+	totpSkew = 1
+	// recoveryCodeCount is how many recovery codes enabling TOTP returns.
+	recoveryCodeCount = 10
+)
+
+// respondWithMFAChallenge answers a correct password from a user with TOTP
+// enabled with a token to exchange, along with a code, at POST
+// /api/login/mfa.
+func respondWithMFAChallenge(w http.ResponseWriter, cfg *config.Config, user *models.User) {
+	policy := auth.MFAChallengePolicy(cfg.JWTPolicy)
+	token, err := auth.MakeJWT(strconv.FormatUint(uint64(user.ID), 10), cfg.JWTKeys, policy, cfg.MFAChallengeTTL)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Could not create token")
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int(cfg.MFAChallengeTTL / time.Second),
+	})
+}
+
+// checkSecondFactor reports whether code is a TOTP code or recovery code
+// of credential's user that has not been used before, using it up if so.
+func checkSecondFactor(ctx context.Context, cfg *config.Config, credential *models.TOTPCredential, code string) (bool, error) {
+	if step, ok := totp.Validate(credential.Secret, code, time.Now(), totpSkew); ok {
+		err := cfg.Store.UseTOTPStep(ctx, credential.UserID, step)
+		if errors.Is(err, store.ErrConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	normalized := totp.NormalizeRecoveryCode(code)
+	if normalized == "" {
+		return false, nil
+	}
+	err := cfg.Store.UseRecoveryCode(ctx, credential.UserID, auth.HashToken(normalized))
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// HandleEnrollTOTP starts setting up TOTP for the caller with a new secret
+// for their authenticator app. Logins do not ask for codes until the
+// enrollment is confirmed, and enrolling again replaces an unconfirmed
+// secret.
+func HandleEnrollTOTP(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.UserFromContext(r.Context())
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to generate secret")
+			return
+		}
+		if err := cfg.Store.SaveTOTPCredential(r.Context(), &models.TOTPCredential{UserID: user.ID, Secret: secret}); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				RespondWithError(w, http.StatusConflict, "two-factor authentication is already enabled")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to save secret")
+			return
+		}
+
+		uri := totp.URI(cfg.TOTPIssuer, user.Email, secret)
+		qrCode, err := totp.QRCode(uri)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to render QR code")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, models.TOTPEnrollmentResponse{
+			Secret: secret,
+			URI:    uri,
+			QRCode: qrCode,
+		})
+	}
+}
+
+// HandleConfirmTOTP enables TOTP once the caller shows a code from their
+// app, and returns their recovery codes. They are only ever shown here.
+func HandleConfirmTOTP(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.UserFromContext(r.Context())
+
+		var req models.MFACodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		credential, err := cfg.Store.GetTOTPCredential(r.Context(), user.ID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusConflict, "start enrollment before confirming it")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to load secret")
+			return
+		}
+		if credential.EnabledAt != nil {
+			RespondWithError(w, http.StatusConflict, "two-factor authentication is already enabled")
+			return
+		}
+		now := time.Now()
+		limits := accountLimits(cfg, user.Email)
+		if reserveLoginAttempt(w, r, cfg, limits, now) {
+			return
+		}
+		step, ok := totp.Validate(credential.Secret, req.Code, now, totpSkew)
+		if !ok {
+			respondWithCodeFailure(w, r, cfg, limits, now, http.StatusBadRequest)
+			return
+		}
+		if err := releaseLoginAttempt(r.Context(), cfg, limits, false); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to check code")
+			return
+		}
+
+		codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+			return
+		}
+		hashes := make([]string, len(codes))
+		for i, code := range codes {
+			hashes[i] = auth.HashToken(code)
+		}
+		if err := cfg.Store.EnableTOTP(r.Context(), user.ID, step, hashes); err != nil {
+			switch {
+			case errors.Is(err, store.ErrConflict):
+				RespondWithError(w, http.StatusConflict, "two-factor authentication is already enabled")
+			case errors.Is(err, store.ErrNotFound):
+				RespondWithError(w, http.StatusConflict, "start enrollment before confirming it")
+			default:
+				RespondWithError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+			}
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// HandleDisableTOTP turns TOTP off for the caller. It takes a code as well
+// as the access token so a stolen token cannot remove the second factor,
+// and wrong codes count against the account like failed logins.
+func HandleDisableTOTP(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.UserFromContext(r.Context())
+
+		var req models.MFACodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		credential, err := cfg.Store.GetTOTPCredential(r.Context(), user.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to load secret")
+			return
+		}
+		if err != nil || credential.EnabledAt == nil {
+			RespondWithError(w, http.StatusNotFound, "two-factor authentication is not enabled")
+			return
+		}
+		now := time.Now()
+		limits := accountLimits(cfg, user.Email)
+		if reserveLoginAttempt(w, r, cfg, limits, now) {
+			return
+		}
+		ok, err := checkSecondFactor(r.Context(), cfg, credential, req.Code)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to check code")
+			return
+		}
+		if !ok {
+			respondWithCodeFailure(w, r, cfg, limits, now, http.StatusForbidden)
+			return
+		}
+		if err := releaseLoginAttempt(r.Context(), cfg, limits, false); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to check code")
+			return
+		}
+
+		if err := cfg.Store.DeleteTOTP(r.Context(), user.ID); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleLoginMFA completes a login that HandleLoginUser answered with an
+// MFA challenge, issuing tokens for a valid TOTP or recovery code.
+func HandleLoginMFA(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.MFALoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		subject, err := auth.ValidateJWT(req.MFAToken, cfg.JWTKeys, auth.MFAChallengePolicy(cfg.JWTPolicy))
+		if err != nil {
+			RespondWithError(w, http.StatusUnauthorized, "MFA token is invalid or expired")
+			return
+		}
+		userID, err := strconv.ParseUint(subject, 10, 32)
+		if err != nil {
+			RespondWithError(w, http.StatusUnauthorized, "MFA token is invalid or expired")
+			return
+		}
+		user, err := cfg.Store.GetUserByID(r.Context(), uint(userID))
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusUnauthorized, "MFA token is invalid or expired")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+			return
+		}
+
+		// Wrong codes count against the same limits as wrong passwords,
+		// which keeps the million possible codes from being tried in turn.
+		now := time.Now()
+		limits := loginLimits(cfg, r, user.Email)
+		if reserveLoginAttempt(w, r, cfg, limits, now) {
+			return
+		}
+
+		credential, err := cfg.Store.GetTOTPCredential(r.Context(), user.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+			return
+		}
+		// Two-factor authentication was turned off since the challenge was
+		// issued; the password alone is enough again.
+		if err != nil || credential.EnabledAt == nil {
+			respondWithLogin(w, r, cfg, user, limits, req.ExpiresInSeconds)
+			return
+		}
+		ok, err := checkSecondFactor(r.Context(), cfg, credential, req.Code)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to check code")
+			return
+		}
+		if !ok {
+			respondWithLoginFailure(w, r, cfg, limits, now, "invalid two-factor code")
+			return
+		}
+		respondWithLogin(w, r, cfg, user, limits, req.ExpiresInSeconds)
+	}
+}
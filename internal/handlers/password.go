@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/mail"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+// checkPasswordPolicy answers the request with every rule password fails
+// for the account with email, reporting whether it is acceptable.
+func checkPasswordPolicy(w http.ResponseWriter, cfg *config.Config, password, email string) bool {
+	violations := cfg.PasswordPolicy.Check(password, email)
+	if len(violations) == 0 {
+		return true
+	}
+	resp := models.PasswordPolicyErrorResponse{
+		Error:      "password does not meet the requirements",
+		Violations: make([]models.PasswordViolation, len(violations)),
+	}
+	for i, v := range violations {
+		resp.Violations[i] = models.PasswordViolation{Rule: string(v.Rule), Message: v.Message}
+	}
+	RespondWithJSON(w, http.StatusBadRequest, resp)
+	return false
+}
+
+// HandleRequestPasswordReset emails a reset token to the address given if
+// it belongs to a user. The response is 202 either way, so the endpoint
+// cannot be used to find out who has an account.
+func HandleRequestPasswordReset(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.PasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if strings.TrimSpace(req.Email) == "" {
+			RespondWithError(w, http.StatusBadRequest, "email is required")
+			return
+		}
+
+		// Looking the address up and mailing it happen after the response,
+		// so an address with an account takes no longer to answer than one
+		// without. A full queue refuses every address alike.
+		queued := cfg.MailQueue.Submit(func(ctx context.Context) {
+			sendPasswordReset(ctx, cfg, req.Email)
+		})
+		if !queued {
+			RespondWithError(w, http.StatusServiceUnavailable, "too many password reset requests, try again later")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// sendPasswordReset mails a reset token to email if it belongs to a user.
+// The caller has already been answered, so failures are only logged.
+func sendPasswordReset(ctx context.Context, cfg *config.Config, email string) {
+	user, err := cfg.Store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("looking up password reset address: %v", err)
+		}
+		return
+	}
+
+	token, reset, err := auth.NewPasswordResetToken(user.ID, cfg.PasswordResetTTL)
+	if err == nil {
+		err = cfg.Store.CreatePasswordResetToken(ctx, reset)
+	}
+	if err != nil {
+		log.Printf("creating password reset token for user %d: %v", user.ID, err)
+		return
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"To choose a new one, send this token to POST /api/password-reset/confirm within %s:\n\n%s\n\n"+
+			"If it was not you, ignore this email. Your password has not changed.\n",
+			cfg.PasswordResetTTL, token),
+	}
+	if err := cfg.Mailer.Send(ctx, msg); err != nil {
+		log.Printf("sending password reset to user %d: %v", user.ID, err)
+	}
+}
+
+// HandleConfirmPasswordReset sets a new password with a reset token. The
+// token is used up, along with any others the user was sent, and every
+// refresh token of the user is revoked so stolen sessions end. The token's
+// user is looked up first, so the new password can be checked against
+// their email address.
+func HandleConfirmPasswordReset(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.PasswordResetConfirmRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.Token == "" {
+			RespondWithError(w, http.StatusBadRequest, "token is required")
+			return
+		}
+		tokenHash := auth.HashToken(req.Token)
+		user, err := cfg.Store.GetPasswordResetUser(r.Context(), tokenHash)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusBadRequest, "reset token is invalid or expired")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to reset password")
+			return
+		}
+		if !checkPasswordPolicy(w, cfg, req.Password, user.Email) {
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(req.Password)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to hash password")
+			return
+		}
+		if _, err := cfg.Store.ResetPassword(r.Context(), tokenHash, hashedPassword); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusBadRequest, "reset token is invalid or expired")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to reset password")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
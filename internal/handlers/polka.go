@@ -34,14 +34,14 @@ func HandleWebHook(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		var user models.User
-		if err := cfg.DB.First(&user, uint(userID)).Error; err != nil {
+		user, err := cfg.Store.GetUserByID(r.Context(), uint(userID))
+		if err != nil {
 			RespondWithError(w, http.StatusUnauthorized, "User not found")
 			return
 		}
 
 		user.IsChirpyRed = true
-		if err := cfg.DB.Save(&user).Error; err != nil {
+		if err := cfg.Store.UpdateUser(r.Context(), user); err != nil {
 			RespondWithError(w, http.StatusInternalServerError, "Failed to update user")
 			return
 		}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/profanity"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+// HandleListProfanityWords lists every word the filter acts on, from
+// configuration and from the admin API, sorted by word.
+func HandleListProfanityWords(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules := cfg.Profanity.Rules()
+		responses := make([]models.ProfanityWordResponse, len(rules))
+		for i, rule := range rules {
+			responses[i] = models.ProfanityWordResponse{Word: rule.Word, Action: string(rule.Action)}
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
+	}
+}
+
+// HandleSetProfanityWord adds a word to the filter or changes its action.
+// The word is stored so it survives a restart.
+func HandleSetProfanityWord(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		word := profanity.NormalizeWord(r.PathValue("word"))
+		if word == "" {
+			RespondWithError(w, http.StatusBadRequest, profanity.ErrInvalidWord.Error())
+			return
+		}
+
+		var req models.ProfanityWordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "invalid JSON format")
+			return
+		}
+		action, err := profanity.ParseAction(req.Action)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := cfg.Store.SaveProfanityWord(r.Context(), &models.ProfanityWord{Word: word, Action: string(action)}); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to save word")
+			return
+		}
+		if err := cfg.Profanity.Set(profanity.Rule{Word: word, Action: action}); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to update filter")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, models.ProfanityWordResponse{Word: word, Action: string(action)})
+	}
+}
+
+// HandleDeleteProfanityWord takes a word off the filter. A word listed in
+// PROFANITY_WORDS comes back on the next restart.
+func HandleDeleteProfanityWord(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		word := profanity.NormalizeWord(r.PathValue("word"))
+		if word == "" {
+			RespondWithError(w, http.StatusBadRequest, profanity.ErrInvalidWord.Error())
+			return
+		}
+		if err := cfg.Store.DeleteProfanityWord(r.Context(), word); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to delete word")
+			return
+		}
+		cfg.Profanity.Remove(word)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListFlaggedChirps lists the chirps held for review, oldest first,
+// paged like GET /api/chirps.
+func HandleListFlaggedChirps(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, after, ok := parsePage(w, r.URL.Query())
+		if !ok {
+			return
+		}
+		chirps, err := cfg.Store.ListChirps(r.Context(), store.ChirpFilter{Flagged: true, After: after, Limit: limit + 1})
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+
+		if len(chirps) > limit {
+			chirps = chirps[:limit]
+			last := chirps[limit-1]
+			setNextPage(w, r, limit, store.ChirpCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
+
+		renderer, err := newChirpRenderer(r, cfg, chirps...)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirps")
+			return
+		}
+		responses := make([]models.ChirpResponse, len(chirps))
+		for i, chirp := range chirps {
+			responses[i] = renderer.response(&chirp)
+		}
+		RespondWithJSON(w, http.StatusOK, responses)
+	}
+}
+
+// HandleReviewChirp settles a flagged chirp, either approving it or
+// deleting it.
+func HandleReviewChirp(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := parseChirpIDFromPath(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var req models.ChirpReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "invalid JSON format")
+			return
+		}
+
+		switch req.Decision {
+		case "approve":
+			err = cfg.Store.SetChirpFlagged(r.Context(), chirpID, false)
+		case "remove":
+			err = cfg.Store.DeleteChirp(r.Context(), chirpID)
+		default:
+			RespondWithError(w, http.StatusBadRequest, `decision must be "approve" or "remove"`)
+			return
+		}
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusNotFound, "Chirp not found")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to review chirp")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
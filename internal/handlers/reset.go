@@ -4,8 +4,6 @@ import (
 	"net/http"
 
 	"github.com/G0SU19O2/Chirpy/internal/config"
-	"github.com/G0SU19O2/Chirpy/internal/models"
-	"gorm.io/gorm"
 )
 
 func HandleReset(cfg *config.Config) http.HandlerFunc {
@@ -14,8 +12,7 @@ func HandleReset(cfg *config.Config) http.HandlerFunc {
 			RespondWithError(w, http.StatusForbidden, "Forbidden")
 			return
 		}
-		result := cfg.DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.User{})
-		if result.Error != nil {
+		if err := cfg.Store.DeleteAllUsers(r.Context()); err != nil {
 			RespondWithError(w, http.StatusInternalServerError, "Cannot remove users")
 			return
 		}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/middleware"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+// HandleRechirp reposts a chirp as the authenticated user. Rechirping the
+// same chirp again returns the existing rechirp.
+func HandleRechirp(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := parseChirpIDFromPath(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		user, _ := middleware.UserFromContext(r.Context())
+
+		original, err := shareableChirp(r, cfg, chirpID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusNotFound, "Chirp not found")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+			return
+		}
+
+		status := http.StatusOK
+		rechirp, err := cfg.Store.GetRechirp(r.Context(), user.ID, original.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			rechirp = &models.Chirp{UserID: user.ID, RechirpOfID: &original.ID}
+			err = cfg.Store.CreateChirp(r.Context(), rechirp)
+			status = http.StatusCreated
+			if errors.Is(err, store.ErrDuplicate) {
+				// A concurrent request rechirped it first.
+				rechirp, err = cfg.Store.GetRechirp(r.Context(), user.ID, original.ID)
+				status = http.StatusOK
+			}
+		}
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to rechirp")
+			return
+		}
+		if status == http.StatusCreated {
+			deliverChirp(r, cfg, rechirp)
+		}
+
+		renderer, err := newChirpRenderer(r, cfg, *rechirp)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve chirp")
+			return
+		}
+		RespondWithJSON(w, status, renderer.response(rechirp))
+	}
+}
+
+// HandleUndoRechirp deletes the authenticated user's rechirp of a chirp,
+// if there is one.
+func HandleUndoRechirp(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := parseChirpIDFromPath(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		user, _ := middleware.UserFromContext(r.Context())
+
+		rechirp, err := cfg.Store.GetRechirp(r.Context(), user.ID, chirpID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve rechirp")
+			return
+		}
+		if err := cfg.Store.DeleteChirp(r.Context(), rechirp.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to delete rechirp")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// shareableChirp loads the chirp a rechirp or quote of id should point at.
+// Sharing a rechirp shares what it reposted.
+func shareableChirp(r *http.Request, cfg *config.Config, id uint) (*models.Chirp, error) {
+	chirp, err := cfg.Store.GetChirpByID(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if chirp.RechirpOfID != nil {
+		return cfg.Store.GetChirpByID(r.Context(), *chirp.RechirpOfID)
+	}
+	return chirp, nil
+}
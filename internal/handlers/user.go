@@ -1,25 +1,28 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/G0SU19O2/Chirpy/internal/auth"
 	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/middleware"
 	"github.com/G0SU19O2/Chirpy/internal/models"
-	"gorm.io/gorm"
+	"github.com/G0SU19O2/Chirpy/internal/store"
 )
 
-func createUser(db *gorm.DB, email string, password string) (*models.User, error) {
+func createUser(ctx context.Context, users store.UserStore, email string, password string) (*models.User, error) {
 	hash, err := auth.HashPassword(password)
 	if err != nil {
 		return nil, err
 	}
 	user := &models.User{Email: email, HashedPassword: hash}
-	result := db.Create(user)
-	return user, result.Error
+	return user, users.CreateUser(ctx, user)
 }
 
 func userToResponse(user *models.User, token string, refreshToken string) models.UserResponse {
@@ -30,22 +33,31 @@ func userToResponse(user *models.User, token string, refreshToken string) models
 		Email:        user.Email,
 		Token:        token,
 		RefreshToken: refreshToken,
+		IsChirpyRed:  user.IsChirpyRed,
+
+		EmailVerified: user.EmailVerifiedAt != nil,
+	}
+}
+
+// accessTokenLifetime honors the lifetime a client asked for at login,
+// falling back to the configured default and never exceeding the maximum.
+func accessTokenLifetime(cfg *config.Config, requestedSeconds int) time.Duration {
+	if requestedSeconds <= 0 {
+		return cfg.AccessTokenTTL
 	}
+	requested := time.Duration(requestedSeconds) * time.Second
+	if requested > cfg.AccessTokenMaxTTL {
+		return cfg.AccessTokenMaxTTL
+	}
+	return requested
 }
 
-func createRefreshToken(db *gorm.DB, userID uint) (*models.RefreshToken, error) {
-	token, err := auth.MakeRefreshToken()
+func createRefreshToken(ctx context.Context, tokens store.RefreshTokenStore, userID uint, ttl time.Duration) (*models.RefreshToken, error) {
+	refreshToken, err := auth.NewRefreshToken(userID, "", ttl)
 	if err != nil {
 		return nil, err
 	}
-	refreshToken := &models.RefreshToken{
-		Token:     token,
-		UserID:    userID,
-		ExpiresAt: time.Now().Add(60 * time.Second),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-	return refreshToken, db.Create(refreshToken).Error
+	return refreshToken, tokens.CreateRefreshToken(ctx, refreshToken)
 }
 
 func HandleCreateUser(cfg *config.Config) http.HandlerFunc {
@@ -56,11 +68,23 @@ func HandleCreateUser(cfg *config.Config) http.HandlerFunc {
 			RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
 			return
 		}
-		user, err := createUser(cfg.DB, req.Email, req.Password)
+		if !checkPasswordPolicy(w, cfg, req.Password, req.Email) {
+			return
+		}
+		user, err := createUser(r.Context(), cfg.Store, req.Email, req.Password)
 		if err != nil {
-			RespondWithError(w, http.StatusBadRequest, "Something wrong")
+			if errors.Is(err, store.ErrDuplicate) {
+				RespondWithError(w, http.StatusConflict, "email is already in use")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to create user")
 			return
 		}
+		// The account exists either way; a lost email can be sent again
+		// through POST /api/email-verification/request.
+		if err := sendEmailVerification(r, cfg, user); err != nil {
+			log.Printf("sending email verification to user %d: %v", user.ID, err)
+		}
 		resp := userToResponse(user, "", "")
 		RespondWithJSON(w, http.StatusCreated, resp)
 	}
@@ -76,35 +100,67 @@ func HandleLoginUser(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		var user models.User
-		result := cfg.DB.Where("email = ?", req.Email).First(&user)
-		if result.Error != nil {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid email or password")
+		now := time.Now()
+		limits := loginLimits(cfg, r, req.Email)
+		if reserveLoginAttempt(w, r, cfg, limits, now) {
 			return
 		}
 
-		if err := auth.CheckPassword(req.Password, user.HashedPassword); err != nil {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid email or password")
+		user, err := cfg.Store.GetUserByEmail(r.Context(), req.Email)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+				return
+			}
+			auth.CheckPasswordWithoutUser(req.Password)
+			respondWithLoginFailure(w, r, cfg, limits, now, "Invalid email or password")
 			return
 		}
 
-		expiresIn := req.ExpiresInSeconds
-		if expiresIn <= 0 || expiresIn > 3600 {
-			expiresIn = 3600
+		if err := auth.CheckPassword(req.Password, user.HashedPassword); err != nil {
+			respondWithLoginFailure(w, r, cfg, limits, now, "Invalid email or password")
+			return
 		}
-		token, err := auth.MakeJWT(strconv.FormatUint(uint64(user.ID), 10), cfg.JWTSecret)
-		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not create token")
+
+		credential, err := cfg.Store.GetTOTPCredential(r.Context(), user.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
 			return
 		}
-		refreshToken, err := createRefreshToken(cfg.DB, user.ID)
-		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not create refresh token")
+		if err == nil && credential.EnabledAt != nil {
+			if err := releaseLoginAttempt(r.Context(), cfg, limits, false); err != nil {
+				RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+				return
+			}
+			respondWithMFAChallenge(w, cfg, user)
 			return
 		}
-		resp := userToResponse(&user, token, refreshToken.Token)
-		RespondWithJSON(w, http.StatusOK, resp)
+		respondWithLogin(w, r, cfg, user, limits, req.ExpiresInSeconds)
+	}
+}
+
+// respondWithLogin issues user a new access and refresh token, completing
+// a login, and releases the attempt reserved against limits. A user with
+// two-factor authentication only gets here with the code as well as the
+// password, so knowing the password alone does not reset the count.
+func respondWithLogin(w http.ResponseWriter, r *http.Request, cfg *config.Config, user *models.User, limits []loginLimit, requestedSeconds int) {
+	if err := releaseLoginAttempt(r.Context(), cfg, limits, true); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+	expiresIn := accessTokenLifetime(cfg, requestedSeconds)
+	token, err := auth.MakeJWT(strconv.FormatUint(uint64(user.ID), 10), cfg.JWTKeys, cfg.JWTPolicy, expiresIn)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Could not create token")
+		return
+	}
+	refreshToken, err := createRefreshToken(r.Context(), cfg.Store, user.ID, cfg.RefreshTokenTTL)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Could not create refresh token")
+		return
 	}
+	resp := userToResponse(user, token, refreshToken.Token)
+	RespondWithJSON(w, http.StatusOK, resp)
 }
 
 func HandleRefreshToken(cfg *config.Config) http.HandlerFunc {
@@ -115,26 +171,29 @@ func HandleRefreshToken(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		refreshToken, err := auth.ValidateRefreshToken(cfg.DB, token)
+		refreshToken, err := auth.RotateRefreshToken(r.Context(), cfg.Store, token, cfg.RefreshTokenTTL)
 		if err != nil {
-			RespondWithError(w, http.StatusUnauthorized, err.Error())
+			if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+				RespondWithError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Could not rotate refresh token")
 			return
 		}
 
-		var user models.User
-		result := cfg.DB.First(&user, refreshToken.UserID)
-		if result.Error != nil {
+		user, err := cfg.Store.GetUserByID(r.Context(), refreshToken.UserID)
+		if err != nil {
 			RespondWithError(w, http.StatusUnauthorized, "User not found")
 			return
 		}
 
-		newToken, err := auth.MakeJWT(strconv.FormatUint(uint64(user.ID), 10), cfg.JWTSecret)
+		newToken, err := auth.MakeJWT(strconv.FormatUint(uint64(user.ID), 10), cfg.JWTKeys, cfg.JWTPolicy, cfg.AccessTokenTTL)
 		if err != nil {
 			RespondWithError(w, http.StatusInternalServerError, "Could not create new token")
 			return
 		}
 
-		resp := map[string]string{"token": newToken}
+		resp := map[string]string{"token": newToken, "refresh_token": refreshToken.Token}
 		RespondWithJSON(w, http.StatusOK, resp)
 	}
 }
@@ -147,13 +206,13 @@ func HandleRevokeToken(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		refreshToken, err := auth.ValidateRefreshToken(cfg.DB, token)
+		refreshToken, err := auth.ValidateRefreshToken(r.Context(), cfg.Store, token)
 		if err != nil {
 			RespondWithError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
 
-		if err := auth.RevokeRefreshToken(cfg.DB, refreshToken); err != nil {
+		if err := auth.RevokeRefreshToken(r.Context(), cfg.Store, refreshToken); err != nil {
 			RespondWithError(w, http.StatusInternalServerError, "Failed to revoke token")
 			return
 		}
@@ -164,23 +223,7 @@ func HandleRevokeToken(cfg *config.Config) http.HandlerFunc {
 
 func HandleUpdateUser(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid token")
-			return
-		}
-
-		tokenUserId, err := auth.ValidateJWT(token, cfg.JWTSecret)
-		if err != nil {
-			RespondWithError(w, http.StatusUnauthorized, "Invalid token")
-			return
-		}
-
-		var user models.User
-		if err := cfg.DB.First(&user, tokenUserId).Error; err != nil {
-			RespondWithError(w, http.StatusUnauthorized, "User not found")
-			return
-		}
+		user, _ := middleware.UserFromContext(r.Context())
 
 		var req models.UserUpdateRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -188,8 +231,18 @@ func HandleUpdateUser(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
+		email := user.Email
 		if req.Email != "" {
-			user.Email = req.Email
+			email = req.Email
+		}
+		if req.Password != "" && !checkPasswordPolicy(w, cfg, req.Password, email) {
+			return
+		}
+
+		emailChanged := email != user.Email
+		if emailChanged {
+			user.Email = email
+			user.EmailVerifiedAt = nil
 		}
 
 		if req.Password != "" {
@@ -201,12 +254,21 @@ func HandleUpdateUser(cfg *config.Config) http.HandlerFunc {
 			user.HashedPassword = hashedPassword
 		}
 
-		if err := cfg.DB.Save(&user).Error; err != nil {
+		if err := cfg.Store.UpdateUser(r.Context(), user); err != nil {
+			if errors.Is(err, store.ErrDuplicate) {
+				RespondWithError(w, http.StatusConflict, "email is already in use")
+				return
+			}
 			RespondWithError(w, http.StatusInternalServerError, "Failed to update user")
 			return
 		}
+		if emailChanged {
+			if err := sendEmailVerification(r, cfg, user); err != nil {
+				log.Printf("sending email verification to user %d: %v", user.ID, err)
+			}
+		}
 
-		resp := userToResponse(&user, "", "")
+		resp := userToResponse(user, "", "")
 		RespondWithJSON(w, http.StatusOK, resp)
 	}
-}
\ No newline at end of file
+}
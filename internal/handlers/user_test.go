@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/config"
+)
+
+func TestAccessTokenLifetime(t *testing.T) {
+	cfg := &config.Config{
+		AccessTokenTTL:    15 * time.Minute,
+		AccessTokenMaxTTL: time.Hour,
+	}
+
+	tests := []struct {
+		name             string
+		requestedSeconds int
+		expected         time.Duration
+	}{
+		{name: "Not requested", requestedSeconds: 0, expected: 15 * time.Minute},
+		{name: "Negative", requestedSeconds: -5, expected: 15 * time.Minute},
+		{name: "Shorter than default", requestedSeconds: 60, expected: time.Minute},
+		{name: "Longer than default", requestedSeconds: 1800, expected: 30 * time.Minute},
+		{name: "At maximum", requestedSeconds: 3600, expected: time.Hour},
+		{name: "Above maximum", requestedSeconds: 86400, expected: time.Hour},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := accessTokenLifetime(cfg, tc.requestedSeconds); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	cfg := &config.Config{
+		LoginLockout:    time.Minute,
+		LoginMaxLockout: 10 * time.Minute,
+	}
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 1, expected: 0},
+		{failures: 4, expected: 0},
+		{failures: 5, expected: time.Minute},
+		{failures: 6, expected: 2 * time.Minute},
+		{failures: 8, expected: 8 * time.Minute},
+		{failures: 9, expected: 10 * time.Minute},
+		{failures: 1000, expected: 10 * time.Minute},
+	}
+
+	for _, tc := range tests {
+		if got := lockoutDuration(cfg, tc.failures, 5); got != tc.expected {
+			t.Errorf("after %d failures expected %s, got %s", tc.failures, tc.expected, got)
+		}
+	}
+}
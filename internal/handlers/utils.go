@@ -20,4 +20,4 @@ func RespondWithJSON(w http.ResponseWriter, statusCode int, payload interface{})
 
 	w.WriteHeader(statusCode)
 	w.Write(data)
-}
\ No newline at end of file
+}
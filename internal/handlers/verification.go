@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/mail"
+	"github.com/G0SU19O2/Chirpy/internal/middleware"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+// sendEmailVerification emails user a token proving they read their
+// current address.
+func sendEmailVerification(r *http.Request, cfg *config.Config, user *models.User) error {
+	token, verification, err := auth.NewEmailVerificationToken(user.ID, user.Email, cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Store.CreateEmailVerificationToken(r.Context(), verification); err != nil {
+		return err
+	}
+	return cfg.Mailer.Send(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("To confirm this address belongs to your Chirpy account, send this token to "+
+			"POST /api/email-verification/confirm within %s:\n\n%s\n\n"+
+			"If you did not sign up or change your address, ignore this email.\n",
+			cfg.EmailVerificationTTL, token),
+	})
+}
+
+// HandleRequestEmailVerification sends the caller a new verification
+// token, for when the first one expired or never arrived.
+func HandleRequestEmailVerification(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.UserFromContext(r.Context())
+		if user.EmailVerifiedAt != nil {
+			RespondWithError(w, http.StatusConflict, "email is already verified")
+			return
+		}
+		if err := sendEmailVerification(r, cfg, user); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to send verification email")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// HandleConfirmEmailVerification marks the address a token was sent to as
+// verified. The token alone is enough, so the link works from a device the
+// user is not logged in on.
+func HandleConfirmEmailVerification(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.EmailVerificationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.Token == "" {
+			RespondWithError(w, http.StatusBadRequest, "token is required")
+			return
+		}
+
+		if _, err := cfg.Store.VerifyEmail(r.Context(), auth.HashToken(req.Token)); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				RespondWithError(w, http.StatusBadRequest, "verification token is invalid or expired")
+				return
+			}
+			RespondWithError(w, http.StatusInternalServerError, "Failed to verify email")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
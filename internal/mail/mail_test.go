@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := &FileMailer{From: "chirpy@example.com", Path: path}
+
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		if err := m.Send(context.Background(), Message{To: to, Subject: "Réinitialiser", Body: "line one\nline two"}); err != nil {
+			t.Fatalf("Send returned error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{"To: a@example.com\r\n", "To: b@example.com\r\n", "From: chirpy@example.com\r\n", "Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n", "line one\r\nline two\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestRejectsHeaderInjection(t *testing.T) {
+	m := &FileMailer{From: "chirpy@example.com", Path: filepath.Join(t.TempDir(), "mail.log")}
+	msg := Message{To: "a@example.com\r\nBcc: victim@example.com", Subject: "hi", Body: "hi"}
+	if err := m.Send(context.Background(), msg); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+}
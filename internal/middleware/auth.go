@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+type contextKey int
+
+const userKey contextKey = iota
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFromContext returns the user RequireUser or OptionalUser
+// authenticated for this request.
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userKey).(*models.User)
+	return user, ok && user != nil
+}
+
+// RequireUser rejects requests without a valid access token and otherwise
+// loads the token's user into the request context.
+func RequireUser(cfg *config.Config) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			token, err := auth.GetBearerToken(r.Header)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				respondWithError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			user, ok := loadUser(cfg, w, r, token)
+			if !ok {
+				return
+			}
+			next(w, r.WithContext(WithUser(r.Context(), user)))
+		}
+	}
+}
+
+// OptionalUser lets anonymous requests through but otherwise behaves like
+// RequireUser, so a token that is sent must still be valid.
+func OptionalUser(cfg *config.Config) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next(w, r)
+				return
+			}
+			RequireUser(cfg)(next)(w, r)
+		}
+	}
+}
+
+// loadUser validates token and loads its user. On failure it has already
+// written the response.
+func loadUser(cfg *config.Config, w http.ResponseWriter, r *http.Request, token string) (*models.User, bool) {
+	subject, err := auth.ValidateJWT(token, cfg.JWTKeys, cfg.JWTPolicy)
+	if err != nil {
+		respondWithTokenError(w, err)
+		return nil, false
+	}
+	userID, err := strconv.ParseUint(subject, 10, 32)
+	if err != nil {
+		respondWithTokenError(w, auth.ErrTokenMalformed)
+		return nil, false
+	}
+
+	user, err := cfg.Store.GetUserByID(r.Context(), uint(userID))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			respondWithError(w, http.StatusUnauthorized, "user no longer exists")
+			return nil, false
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to load user")
+		return nil, false
+	}
+	return user, true
+}
+
+// RequireVerifiedEmail refuses users who have not verified their email
+// address while REQUIRE_VERIFIED_EMAIL is on. It must run after
+// RequireUser.
+func RequireVerifiedEmail(cfg *config.Config) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				respondWithError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			if cfg.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+				respondWithError(w, http.StatusForbidden, "verify your email address before chirping")
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// RequireAdminKey only lets through requests whose Authorization header is
+// the admin API key. Without a key configured every request is refused.
+func RequireAdminKey(cfg *config.Config) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if cfg.AdminAPIKey == "" {
+				respondWithError(w, http.StatusForbidden, "admin API is disabled")
+				return
+			}
+			apiKey, err := auth.GetAPIKey(r.Header)
+			if err != nil || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.AdminAPIKey)) != 1 {
+				respondWithError(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// respondWithTokenError rejects a request whose access token failed
+// validation, telling the client why as RFC 6750 asks.
+func respondWithTokenError(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, err.Error()))
+	respondWithError(w, http.StatusUnauthorized, err.Error())
+}
+
+func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message})
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+)
+
+func TestRequireUser(t *testing.T) {
+	cfg := config.New(store.NewMemoryStore(), config.PlatformDev, "0123456789abcdef0123456789abcdef", "polka-key")
+	regular := &models.User{Email: "regular@example.com"}
+	if err := cfg.Store.CreateUser(context.Background(), regular); err != nil {
+		t.Fatal(err)
+	}
+	tokenFor := func(subject string) string {
+		token, err := auth.MakeJWT(subject, cfg.JWTKeys, cfg.JWTPolicy, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+	userID := func(u *models.User) string { return strconv.FormatUint(uint64(u.ID), 10) }
+
+	var seen *models.User
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		authorization string
+		status        int
+		user          *models.User
+	}{
+		{"no token", RequireUser(cfg)(ok), "", http.StatusUnauthorized, nil},
+		{"garbage token", RequireUser(cfg)(ok), "Bearer nope", http.StatusUnauthorized, nil},
+		{"unknown user", RequireUser(cfg)(ok), tokenFor("999"), http.StatusUnauthorized, nil},
+		{"non-numeric subject", RequireUser(cfg)(ok), tokenFor("walt"), http.StatusUnauthorized, nil},
+		{"valid token", RequireUser(cfg)(ok), tokenFor(userID(regular)), http.StatusNoContent, regular},
+		{"optional without token", OptionalUser(cfg)(ok), "", http.StatusNoContent, nil},
+		{"optional with token", OptionalUser(cfg)(ok), tokenFor(userID(regular)), http.StatusNoContent, regular},
+		{"optional with garbage token", OptionalUser(cfg)(ok), "Bearer nope", http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.user != nil && (seen == nil || seen.ID != tt.user.ID) {
+				t.Errorf("expected user %d in context, got %+v", tt.user.ID, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestEveryDialectHasTheSameMigrations(t *testing.T) {
+	sqliteMigrations, err := load("sqlite")
+	if err != nil {
+		t.Fatalf("loading sqlite migrations: %v", err)
+	}
+	for _, dialect := range []string{"mysql", "postgres"} {
+		migrations, err := load(dialect)
+		if err != nil {
+			t.Fatalf("loading %s migrations: %v", dialect, err)
+		}
+		if len(migrations) != len(sqliteMigrations) {
+			t.Fatalf("expected %d %s migrations, got %d", len(sqliteMigrations), dialect, len(migrations))
+		}
+		for i, m := range migrations {
+			if m.Version != sqliteMigrations[i].Version || m.Name != sqliteMigrations[i].Name {
+				t.Errorf("%s migration %04d_%s does not match sqlite %04d_%s",
+					dialect, m.Version, m.Name, sqliteMigrations[i].Version, sqliteMigrations[i].Name)
+			}
+		}
+	}
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "chirpy.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	total := len(migrator.Migrations())
+
+	ran, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	if len(ran) != total {
+		t.Errorf("expected %d migrations to run, got %d", total, len(ran))
+	}
+	for _, table := range []string{"users", "chirps", "refresh_tokens"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("expected table %s to exist", table)
+		}
+	}
+
+	ran, err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("second Up returned error: %v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("expected second Up to be a no-op, ran %d", len(ran))
+	}
+
+	reverted, err := migrator.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("Down returned error: %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != migrator.Migrations()[total-1].Version {
+		t.Fatalf("expected the latest migration to be reverted, got %+v", reverted)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+	for i, s := range statuses {
+		pending := s.AppliedAt == nil
+		if pending != (i == total-1) {
+			t.Errorf("migration %04d_%s: unexpected pending=%v", s.Version, s.Name, pending)
+		}
+	}
+
+	if _, err := migrator.Down(ctx, total); err != nil {
+		t.Fatalf("Down returned error: %v", err)
+	}
+	if db.Migrator().HasTable("users") {
+		t.Error("expected users table to be dropped")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- comment\nCREATE TABLE a (\n    id INTEGER\n);\n\nCREATE INDEX i ON a (id);\n"
+	statements := splitStatements(script)
+	if len(statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d: %q", len(statements), statements)
+	}
+	if statements[1] != "CREATE INDEX i ON a (id);" {
+		t.Errorf("unexpected statement %q", statements[1])
+	}
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    email VARCHAR(255) NULL,
+    hashed_password LONGTEXT NOT NULL,
+    is_chirpy_red BOOLEAN DEFAULT FALSE,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_users_email (email),
+    INDEX idx_users_deleted_at (deleted_at)
+);
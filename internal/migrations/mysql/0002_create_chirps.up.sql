@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS chirps (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    body LONGTEXT NOT NULL,
+    user_id BIGINT UNSIGNED NULL,
+    PRIMARY KEY (id),
+    INDEX idx_chirps_deleted_at (deleted_at),
+    INDEX idx_chirps_user_id (user_id),
+    CONSTRAINT fk_chirps_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
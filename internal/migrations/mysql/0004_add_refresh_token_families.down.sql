@@ -0,0 +1,3 @@
+DROP INDEX idx_refresh_tokens_family_id ON refresh_tokens;
+ALTER TABLE refresh_tokens DROP COLUMN replaced_by;
+ALTER TABLE refresh_tokens DROP COLUMN family_id;
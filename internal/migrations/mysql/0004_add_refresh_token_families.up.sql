@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens ADD COLUMN family_id VARCHAR(64) NULL;
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by VARCHAR(255) NULL;
+UPDATE refresh_tokens SET family_id = token WHERE family_id IS NULL;
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
@@ -0,0 +1,2 @@
+DROP INDEX idx_chirps_user_id_created_at_id ON chirps;
+DROP INDEX idx_chirps_created_at_id ON chirps;
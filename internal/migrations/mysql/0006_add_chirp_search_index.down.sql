@@ -0,0 +1 @@
+DROP INDEX idx_chirps_body_search ON chirps;
@@ -0,0 +1 @@
+CREATE FULLTEXT INDEX idx_chirps_body_search ON chirps (body);
@@ -0,0 +1,10 @@
+ALTER TABLE chirps ADD COLUMN edited_at DATETIME(3) NULL;
+CREATE TABLE IF NOT EXISTS chirp_revisions (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    created_at DATETIME(3) NULL,
+    chirp_id BIGINT UNSIGNED NOT NULL,
+    body LONGTEXT NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_chirp_revisions_chirp_id (chirp_id),
+    CONSTRAINT fk_chirp_revisions_chirp FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
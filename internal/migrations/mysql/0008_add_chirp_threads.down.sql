@@ -0,0 +1,6 @@
+ALTER TABLE chirps DROP FOREIGN KEY fk_chirps_in_reply_to;
+DROP INDEX idx_chirps_conversation_id ON chirps;
+DROP INDEX idx_chirps_in_reply_to_id ON chirps;
+ALTER TABLE chirps DROP COLUMN reply_count;
+ALTER TABLE chirps DROP COLUMN conversation_id;
+ALTER TABLE chirps DROP COLUMN in_reply_to_id;
@@ -0,0 +1,7 @@
+ALTER TABLE chirps ADD COLUMN in_reply_to_id BIGINT UNSIGNED NULL;
+ALTER TABLE chirps ADD COLUMN conversation_id BIGINT UNSIGNED NULL;
+ALTER TABLE chirps ADD COLUMN reply_count BIGINT NOT NULL DEFAULT 0;
+UPDATE chirps SET conversation_id = id WHERE conversation_id IS NULL;
+CREATE INDEX idx_chirps_in_reply_to_id ON chirps (in_reply_to_id);
+CREATE INDEX idx_chirps_conversation_id ON chirps (conversation_id, created_at, id);
+ALTER TABLE chirps ADD CONSTRAINT fk_chirps_in_reply_to FOREIGN KEY (in_reply_to_id) REFERENCES chirps (id) ON DELETE SET NULL;
@@ -0,0 +1,11 @@
+ALTER TABLE chirps ADD COLUMN like_count BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS chirp_likes (
+    user_id BIGINT UNSIGNED NOT NULL,
+    chirp_id BIGINT UNSIGNED NOT NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (user_id, chirp_id),
+    INDEX idx_chirp_likes_user_id_created_at (user_id, created_at, chirp_id),
+    INDEX idx_chirp_likes_chirp_id (chirp_id),
+    CONSTRAINT fk_chirp_likes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp_likes_chirp FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
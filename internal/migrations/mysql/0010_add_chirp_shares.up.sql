@@ -0,0 +1,5 @@
+ALTER TABLE chirps ADD COLUMN rechirp_of_id BIGINT UNSIGNED NULL;
+ALTER TABLE chirps ADD COLUMN quote_of_id BIGINT UNSIGNED NULL;
+ALTER TABLE chirps ADD COLUMN share_count BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX idx_chirps_rechirp_of_id ON chirps (rechirp_of_id, user_id);
+CREATE INDEX idx_chirps_quote_of_id ON chirps (quote_of_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS timeline_entries;
+DROP TABLE IF EXISTS follows;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id BIGINT UNSIGNED NOT NULL,
+    followee_id BIGINT UNSIGNED NOT NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    INDEX idx_follows_follower_id_created_at (follower_id, created_at, followee_id),
+    INDEX idx_follows_followee_id_created_at (followee_id, created_at, follower_id),
+    CONSTRAINT fk_follows_follower FOREIGN KEY (follower_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_follows_followee FOREIGN KEY (followee_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS timeline_entries (
+    user_id BIGINT UNSIGNED NOT NULL,
+    chirp_id BIGINT UNSIGNED NOT NULL,
+    author_id BIGINT UNSIGNED NOT NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (user_id, chirp_id),
+    INDEX idx_timeline_entries_user_id_created_at (user_id, created_at, chirp_id),
+    INDEX idx_timeline_entries_user_id_author_id (user_id, author_id),
+    CONSTRAINT fk_timeline_entries_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_timeline_entries_chirp FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS chirp_mentions;
+DROP TABLE IF EXISTS chirp_hashtags;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS chirp_hashtags (
+    chirp_id BIGINT UNSIGNED NOT NULL,
+    start_offset BIGINT NOT NULL,
+    end_offset BIGINT NOT NULL,
+    tag VARCHAR(100) NOT NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (chirp_id, start_offset),
+    INDEX idx_chirp_hashtags_tag (tag, chirp_id),
+    INDEX idx_chirp_hashtags_created_at (created_at, tag),
+    CONSTRAINT fk_chirp_hashtags_chirp FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS chirp_mentions (
+    chirp_id BIGINT UNSIGNED NOT NULL,
+    start_offset BIGINT NOT NULL,
+    end_offset BIGINT NOT NULL,
+    username VARCHAR(30) NOT NULL,
+    PRIMARY KEY (chirp_id, start_offset),
+    CONSTRAINT fk_chirp_mentions_chirp FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
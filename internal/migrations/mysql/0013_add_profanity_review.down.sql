@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS profanity_words;
+DROP INDEX idx_chirps_flagged_created_at ON chirps;
+ALTER TABLE chirps DROP COLUMN flagged;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    token_hash CHAR(64) NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (token_hash),
+    INDEX idx_password_reset_tokens_user_id (user_id),
+    CONSTRAINT fk_password_reset_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME(3) NULL;
+-- Accounts that predate verification were never asked to verify, so they
+-- count as verified rather than being locked out by REQUIRE_VERIFIED_EMAIL.
+UPDATE users SET email_verified_at = created_at;
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    token_hash CHAR(64) NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    expires_at DATETIME(3) NOT NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (token_hash),
+    INDEX idx_email_verification_tokens_user_id (user_id),
+    CONSTRAINT fk_email_verification_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
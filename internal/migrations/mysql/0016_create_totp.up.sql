@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS totp_credentials (
+    user_id BIGINT UNSIGNED NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    enabled_at DATETIME(3) NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_totp_credentials_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    user_id BIGINT UNSIGNED NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope VARCHAR(16) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    locked_until DATETIME(3) NULL,
+    last_failed_at DATETIME(3) NOT NULL,
+    PRIMARY KEY (scope, subject),
+    INDEX idx_login_attempts_locked_until (locked_until)
+);
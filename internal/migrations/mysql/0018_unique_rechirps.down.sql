@@ -0,0 +1,2 @@
+DROP INDEX idx_chirps_live_rechirp ON chirps;
+ALTER TABLE chirps DROP COLUMN live_rechirp_of_id;
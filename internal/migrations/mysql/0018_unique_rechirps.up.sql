@@ -0,0 +1,25 @@
+-- Keep only the oldest live rechirp of a chirp per user, so the unique
+-- index below can be built, and recount the shares that are left.
+UPDATE chirps
+JOIN (
+    SELECT rechirp_of_id, user_id, MIN(id) AS keep_id FROM chirps
+    WHERE rechirp_of_id IS NOT NULL AND deleted_at IS NULL
+    GROUP BY rechirp_of_id, user_id
+) kept ON chirps.rechirp_of_id = kept.rechirp_of_id AND chirps.user_id = kept.user_id
+SET chirps.deleted_at = CURRENT_TIMESTAMP(3)
+WHERE chirps.deleted_at IS NULL AND chirps.id <> kept.keep_id;
+UPDATE chirps
+LEFT JOIN (
+    SELECT shared_id, COUNT(*) AS shares FROM (
+        SELECT rechirp_of_id AS shared_id FROM chirps WHERE rechirp_of_id IS NOT NULL AND deleted_at IS NULL
+        UNION ALL
+        SELECT quote_of_id FROM chirps WHERE quote_of_id IS NOT NULL AND deleted_at IS NULL
+    ) shared GROUP BY shared_id
+) counted ON counted.shared_id = chirps.id
+SET chirps.share_count = COALESCE(counted.shares, 0)
+WHERE chirps.share_count > 0;
+-- MySQL has no partial indexes; this column is NULL once a rechirp is
+-- deleted, and NULLs never collide in a unique index.
+ALTER TABLE chirps ADD COLUMN live_rechirp_of_id BIGINT UNSIGNED
+    AS (CASE WHEN deleted_at IS NULL THEN rechirp_of_id END) STORED;
+CREATE UNIQUE INDEX idx_chirps_live_rechirp ON chirps (live_rechirp_of_id, user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS chirps (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    body TEXT NOT NULL,
+    user_id BIGINT REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_chirps_deleted_at ON chirps (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_chirps_user_id ON chirps (user_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_chirps_user_id_created_at_id;
+DROP INDEX IF EXISTS idx_chirps_created_at_id;
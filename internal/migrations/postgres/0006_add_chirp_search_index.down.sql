@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_chirps_body_search;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_chirps_body_search ON chirps USING GIN (to_tsvector('simple', body));
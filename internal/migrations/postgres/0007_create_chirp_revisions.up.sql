@@ -0,0 +1,8 @@
+ALTER TABLE chirps ADD COLUMN edited_at TIMESTAMPTZ;
+CREATE TABLE IF NOT EXISTS chirp_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    chirp_id BIGINT NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    body TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_chirp_revisions_chirp_id ON chirp_revisions (chirp_id);
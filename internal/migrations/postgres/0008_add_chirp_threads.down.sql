@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_chirps_conversation_id;
+DROP INDEX IF EXISTS idx_chirps_in_reply_to_id;
+ALTER TABLE chirps DROP COLUMN reply_count;
+ALTER TABLE chirps DROP COLUMN conversation_id;
+ALTER TABLE chirps DROP COLUMN in_reply_to_id;
@@ -0,0 +1,6 @@
+ALTER TABLE chirps ADD COLUMN in_reply_to_id BIGINT REFERENCES chirps (id) ON DELETE SET NULL;
+ALTER TABLE chirps ADD COLUMN conversation_id BIGINT;
+ALTER TABLE chirps ADD COLUMN reply_count BIGINT NOT NULL DEFAULT 0;
+UPDATE chirps SET conversation_id = id WHERE conversation_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_chirps_in_reply_to_id ON chirps (in_reply_to_id);
+CREATE INDEX IF NOT EXISTS idx_chirps_conversation_id ON chirps (conversation_id, created_at, id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    followee_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (follower_id, followee_id)
+);
+CREATE INDEX IF NOT EXISTS idx_follows_follower_id_created_at ON follows (follower_id, created_at, followee_id);
+CREATE INDEX IF NOT EXISTS idx_follows_followee_id_created_at ON follows (followee_id, created_at, follower_id);
+CREATE TABLE IF NOT EXISTS timeline_entries (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    chirp_id BIGINT NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    author_id BIGINT NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, chirp_id)
+);
+CREATE INDEX IF NOT EXISTS idx_timeline_entries_user_id_created_at ON timeline_entries (user_id, created_at, chirp_id);
+CREATE INDEX IF NOT EXISTS idx_timeline_entries_user_id_author_id ON timeline_entries (user_id, author_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS chirp_hashtags (
+    chirp_id BIGINT NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    start_offset BIGINT NOT NULL,
+    end_offset BIGINT NOT NULL,
+    tag VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (chirp_id, start_offset)
+);
+CREATE INDEX IF NOT EXISTS idx_chirp_hashtags_tag ON chirp_hashtags (tag, chirp_id);
+CREATE INDEX IF NOT EXISTS idx_chirp_hashtags_created_at ON chirp_hashtags (created_at, tag);
+CREATE TABLE IF NOT EXISTS chirp_mentions (
+    chirp_id BIGINT NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    start_offset BIGINT NOT NULL,
+    end_offset BIGINT NOT NULL,
+    username VARCHAR(30) NOT NULL,
+    PRIMARY KEY (chirp_id, start_offset)
+);
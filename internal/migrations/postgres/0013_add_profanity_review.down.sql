@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS profanity_words;
+DROP INDEX IF EXISTS idx_chirps_flagged_created_at;
+ALTER TABLE chirps DROP COLUMN flagged;
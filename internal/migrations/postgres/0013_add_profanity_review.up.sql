@@ -0,0 +1,8 @@
+ALTER TABLE chirps ADD COLUMN flagged BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_chirps_flagged_created_at ON chirps (flagged, created_at, id);
+CREATE TABLE IF NOT EXISTS profanity_words (
+    word VARCHAR(100) NOT NULL PRIMARY KEY,
+    action VARCHAR(16) NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_chirps_rechirp_of_id;
+CREATE INDEX IF NOT EXISTS idx_chirps_rechirp_of_id ON chirps (rechirp_of_id, user_id);
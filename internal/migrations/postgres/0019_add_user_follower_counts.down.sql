@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN follower_count;
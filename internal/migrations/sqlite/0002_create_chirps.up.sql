@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS chirps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    body TEXT NOT NULL,
+    user_id INTEGER REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_chirps_deleted_at ON chirps (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_chirps_user_id ON chirps (user_id);
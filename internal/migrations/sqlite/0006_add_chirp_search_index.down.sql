@@ -0,0 +1,3 @@
+-- SQLite chirps are searched with the in-process index from
+-- internal/search, so there is nothing to create here. The migration
+-- exists to keep versions aligned across dialects.
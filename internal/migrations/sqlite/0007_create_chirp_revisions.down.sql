@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS chirp_revisions;
+ALTER TABLE chirps DROP COLUMN edited_at;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS chirp_likes;
+ALTER TABLE chirps DROP COLUMN like_count;
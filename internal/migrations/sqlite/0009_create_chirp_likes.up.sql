@@ -0,0 +1,9 @@
+ALTER TABLE chirps ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS chirp_likes (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    chirp_id INTEGER NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    created_at DATETIME,
+    PRIMARY KEY (user_id, chirp_id)
+);
+CREATE INDEX IF NOT EXISTS idx_chirp_likes_user_id_created_at ON chirp_likes (user_id, created_at, chirp_id);
+CREATE INDEX IF NOT EXISTS idx_chirp_likes_chirp_id ON chirp_likes (chirp_id);
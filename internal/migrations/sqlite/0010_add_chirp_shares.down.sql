@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_chirps_quote_of_id;
+DROP INDEX IF EXISTS idx_chirps_rechirp_of_id;
+ALTER TABLE chirps DROP COLUMN share_count;
+ALTER TABLE chirps DROP COLUMN quote_of_id;
+ALTER TABLE chirps DROP COLUMN rechirp_of_id;
@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+-- Accounts that predate verification were never asked to verify, so they
+-- count as verified rather than being locked out by REQUIRE_VERIFIED_EMAIL.
+UPDATE users SET email_verified_at = created_at;
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user_id ON email_verification_tokens (user_id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS totp_credentials (
+    user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    enabled_at DATETIME,
+    last_used_step INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at DATETIME,
+    PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    locked_until DATETIME,
+    last_failed_at DATETIME NOT NULL,
+    PRIMARY KEY (scope, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_locked_until ON login_attempts (locked_until);
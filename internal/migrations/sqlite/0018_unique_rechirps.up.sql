@@ -0,0 +1,15 @@
+-- Keep only the oldest live rechirp of a chirp per user, so the unique
+-- index below can be built, and recount the shares that are left.
+UPDATE chirps SET deleted_at = CURRENT_TIMESTAMP
+WHERE rechirp_of_id IS NOT NULL AND deleted_at IS NULL AND id NOT IN (
+    SELECT MIN(id) FROM chirps
+    WHERE rechirp_of_id IS NOT NULL AND deleted_at IS NULL
+    GROUP BY rechirp_of_id, user_id
+);
+UPDATE chirps SET share_count = (
+    SELECT COUNT(*) FROM chirps shares
+    WHERE (shares.rechirp_of_id = chirps.id OR shares.quote_of_id = chirps.id) AND shares.deleted_at IS NULL
+)
+WHERE share_count > 0;
+DROP INDEX IF EXISTS idx_chirps_rechirp_of_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chirps_rechirp_of_id ON chirps (rechirp_of_id, user_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,4 @@
+-- follower_count lets timeline fan-out decide per author without counting
+-- follows on every chirp and every read.
+ALTER TABLE users ADD COLUMN follower_count INTEGER NOT NULL DEFAULT 0;
+UPDATE users SET follower_count = (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id);
@@ -21,6 +21,74 @@ type RefreshToken struct {
 	User      User       `gorm:"foreignKey:UserID"`
 	ExpiresAt time.Time  `gorm:"not null"`
 	RevokedAt *time.Time `gorm:"default:NULL"`
+	// FamilyID is shared by every token rotated from the same login.
+	FamilyID string `gorm:"size:64;index"`
+	// ReplacedBy is set when the token was rotated rather than revoked.
+	ReplacedBy *string `gorm:"size:255;default:NULL"`
+}
+
+// PasswordResetToken lets its holder set a new password for UserID once,
+// until ExpiresAt. Only a SHA-256 hash of the token is kept, so a copy of
+// the table cannot be used to take over accounts.
+type PasswordResetToken struct {
+	TokenHash string    `gorm:"primaryKey;size:64"`
+	UserID    uint      `gorm:"not null;index;constraint:OnDelete:CASCADE;"`
+	User      User      `gorm:"foreignKey:UserID"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// EmailVerificationToken proves its holder reads Email. It only verifies
+// the user while Email is still their address, so a token sent before an
+// address change cannot verify the new one. Like PasswordResetToken, only
+// the token's hash is kept.
+type EmailVerificationToken struct {
+	TokenHash string    `gorm:"primaryKey;size:64"`
+	UserID    uint      `gorm:"not null;index;constraint:OnDelete:CASCADE;"`
+	User      User      `gorm:"foreignKey:UserID"`
+	Email     string    `gorm:"size:255;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// TOTPCredential is a user's authenticator app secret. It only guards
+// logins once EnabledAt is set, which happens when the user shows their
+// app generates codes for it. LastUsedStep is the time step of the last
+// code accepted, so a code cannot be used twice.
+type TOTPCredential struct {
+	UserID       uint       `gorm:"primaryKey;autoIncrement:false;constraint:OnDelete:CASCADE;"`
+	User         User       `gorm:"foreignKey:UserID"`
+	Secret       string     `gorm:"size:64;not null"`
+	EnabledAt    *time.Time `gorm:"default:NULL"`
+	LastUsedStep int64      `gorm:"not null;default:0"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RecoveryCode is one of the single-use codes a user with TOTP enabled
+// can log in with instead of a TOTP code. Only the code's hash is kept.
+type RecoveryCode struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false;constraint:OnDelete:CASCADE;"`
+	CodeHash  string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+}
+
+// Login throttling scopes: failed logins are counted against the email
+// address tried, whether or not it has an account, and the client's IP
+// address.
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+)
+
+// LoginAttempt counts the consecutive failed logins for an email address
+// or IP address. LockedUntil is set once there are enough of them.
+type LoginAttempt struct {
+	Scope        string `gorm:"primaryKey;size:16"`
+	Subject      string `gorm:"primaryKey;size:255"`
+	Failures     int    `gorm:"not null;default:0"`
+	LockedUntil  *time.Time
+	LastFailedAt time.Time `gorm:"not null"`
 }
 
 type User struct {
@@ -28,6 +96,9 @@ type User struct {
 	Email          string `gorm:"size:255;uniqueIndex"`
 	HashedPassword string `gorm:"not null"`
 	IsChirpyRed    bool   `gorm:"default:false"`
+	// EmailVerifiedAt is set when the user proves they read Email and
+	// cleared when Email changes.
+	EmailVerifiedAt *time.Time `gorm:"default:NULL"`
 }
 
 type UserUpdateRequest struct {
@@ -40,6 +111,100 @@ type Chirp struct {
 	Body   string `gorm:"not null"`
 	UserID uint   `gorm:"constraint:OnDelete:CASCADE;"`
 	User   User   `gorm:"foreignKey:UserID"`
+	// EditedAt is set the first time the body is changed and moved forward
+	// on every later edit.
+	EditedAt *time.Time `gorm:"default:NULL"`
+	// InReplyToID is the chirp this one answers, if any. ConversationID is
+	// the id of the chirp that started the thread, which for a chirp that
+	// is not a reply is its own id.
+	InReplyToID    *uint `gorm:"index;constraint:OnDelete:SET NULL;"`
+	ConversationID uint  `gorm:"index"`
+	// ReplyCount counts direct replies that have not been deleted.
+	ReplyCount int `gorm:"not null;default:0"`
+	LikeCount  int `gorm:"not null;default:0"`
+	// RechirpOfID marks a rechirp, a repost with no body of its own, and
+	// QuoteOfID a quote chirp. Neither is a foreign key, so a share keeps
+	// pointing at its original after the original is deleted.
+	RechirpOfID *uint `gorm:"index"`
+	QuoteOfID   *uint `gorm:"index"`
+	// ShareCount counts the rechirps and quotes of this chirp that have not
+	// been deleted.
+	ShareCount int `gorm:"not null;default:0"`
+	// Flagged holds a chirp for review because it uses a word the
+	// profanity filter flags. Flagged chirps stay visible meanwhile.
+	Flagged bool `gorm:"not null;default:false"`
+}
+
+// SharedChirpID returns the id of the chirp this one rechirps or quotes.
+func (c *Chirp) SharedChirpID() *uint {
+	if c.RechirpOfID != nil {
+		return c.RechirpOfID
+	}
+	return c.QuoteOfID
+}
+
+// ChirpLike records that a user liked a chirp; a user likes a chirp at
+// most once.
+type ChirpLike struct {
+	UserID    uint `gorm:"primaryKey;constraint:OnDelete:CASCADE;"`
+	ChirpID   uint `gorm:"primaryKey;index;constraint:OnDelete:CASCADE;"`
+	CreatedAt time.Time
+}
+
+// Follow records that FollowerID follows FolloweeID.
+type Follow struct {
+	FollowerID uint `gorm:"primaryKey;constraint:OnDelete:CASCADE;"`
+	FolloweeID uint `gorm:"primaryKey;constraint:OnDelete:CASCADE;"`
+	CreatedAt  time.Time
+}
+
+// TimelineEntry puts a chirp in a user's precomputed home timeline.
+// CreatedAt copies the chirp's so the timeline can be paged without
+// reading the chirps table.
+type TimelineEntry struct {
+	UserID    uint `gorm:"primaryKey;constraint:OnDelete:CASCADE;"`
+	ChirpID   uint `gorm:"primaryKey;constraint:OnDelete:CASCADE;"`
+	AuthorID  uint `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// ChirpHashtag is a #hashtag in a chirp's body. Offsets count grapheme
+// clusters, End exclusive. CreatedAt copies the chirp's so trending tags can
+// be counted without reading the chirps table.
+type ChirpHashtag struct {
+	ChirpID     uint   `gorm:"primaryKey;constraint:OnDelete:CASCADE;"`
+	StartOffset int    `gorm:"primaryKey"`
+	EndOffset   int    `gorm:"not null"`
+	Tag         string `gorm:"size:100;not null"`
+	CreatedAt   time.Time
+}
+
+// ChirpMention is an @mention in a chirp's body, offset like ChirpHashtag.
+// Users have no handles, so Username is only the text after the @; it is
+// not resolved to an account.
+type ChirpMention struct {
+	ChirpID     uint   `gorm:"primaryKey;constraint:OnDelete:CASCADE;"`
+	StartOffset int    `gorm:"primaryKey"`
+	EndOffset   int    `gorm:"not null"`
+	Username    string `gorm:"size:30;not null"`
+}
+
+// ProfanityWord is a word added to the profanity filter through the admin
+// API. Words from PROFANITY_WORDS are not stored.
+type ProfanityWord struct {
+	Word      string `gorm:"primaryKey;size:100"`
+	Action    string `gorm:"size:16;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ChirpRevision keeps a body a chirp had before an edit. CreatedAt is when
+// it was replaced.
+type ChirpRevision struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	ChirpID   uint   `gorm:"not null;index;constraint:OnDelete:CASCADE;"`
+	Body      string `gorm:"not null"`
 }
 
 type ChirpResponse struct {
@@ -48,6 +213,116 @@ type ChirpResponse struct {
 	UpdatedAt string `json:"updated_at"`
 	Body      string `json:"body"`
 	UserId    string `json:"user_id"`
+	Edited    bool   `json:"edited"`
+
+	InReplyToId    string `json:"in_reply_to_id,omitempty"`
+	ConversationId string `json:"conversation_id"`
+	ReplyCount     int    `json:"reply_count"`
+
+	LikeCount int `json:"like_count"`
+	// LikedByMe is always false for anonymous requests.
+	LikedByMe bool `json:"liked_by_me"`
+
+	RechirpOfId string `json:"rechirp_of_id,omitempty"`
+	QuoteOfId   string `json:"quote_of_id,omitempty"`
+	ShareCount  int    `json:"share_count"`
+	// Original is the rechirped or quoted chirp. It is left out and
+	// OriginalDeleted set when that chirp has since been deleted.
+	Original        *ChirpResponse `json:"original,omitempty"`
+	OriginalDeleted bool           `json:"original_deleted,omitempty"`
+
+	Entities ChirpEntities `json:"entities"`
+}
+
+// ChirpEntities lists the hashtags and mentions in a chirp's body in the
+// order they appear. Start and End are character offsets counted in
+// grapheme clusters, as chirp length is, End exclusive, and include the #
+// or @.
+type ChirpEntities struct {
+	Hashtags []HashtagEntity `json:"hashtags"`
+	Mentions []MentionEntity `json:"mentions"`
+}
+
+type HashtagEntity struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type MentionEntity struct {
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// TrendingHashtagResponse is a tag and how many chirps used it within the
+// trending window.
+type TrendingHashtagResponse struct {
+	Tag        string `json:"tag"`
+	ChirpCount int    `json:"chirp_count"`
+}
+
+// ThreadNode is a chirp in a conversation tree. MoreReplies is set when
+// the depth limit cut off its replies; request the chirp's own thread to
+// see them.
+type ThreadNode struct {
+	ChirpResponse
+	Replies     []ThreadNode `json:"replies"`
+	MoreReplies bool         `json:"more_replies,omitempty"`
+}
+
+type ThreadResponse struct {
+	// Ancestors runs from the conversation's first chirp down to the parent
+	// of Chirp.
+	Ancestors  []ChirpResponse `json:"ancestors"`
+	Chirp      ThreadNode      `json:"chirp"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// LikedChirpResponse is a chirp in a user's likes and when they liked it.
+type LikedChirpResponse struct {
+	ChirpResponse
+	LikedAt string `json:"liked_at"`
+}
+
+// FollowResponse is one entry in a follower or following list. Only the
+// user's id is shown, as in chirps, so email addresses stay private.
+type FollowResponse struct {
+	UserId     string `json:"user_id"`
+	FollowedAt string `json:"followed_at"`
+}
+
+type ProfanityWordRequest struct {
+	Action string `json:"action"`
+}
+
+type ProfanityWordResponse struct {
+	Word   string `json:"word"`
+	Action string `json:"action"`
+}
+
+// ChirpReviewRequest settles a flagged chirp: "approve" clears the flag and
+// "remove" deletes the chirp.
+type ChirpReviewRequest struct {
+	Decision string `json:"decision"`
+}
+
+type ChirpEditRequest struct {
+	Body string `json:"body"`
+}
+
+type ChirpRevisionResponse struct {
+	Id         string `json:"id"`
+	Body       string `json:"body"`
+	ReplacedAt string `json:"replaced_at"`
+}
+
+// ChirpSearchResult is a chirp found by search. Highlighted is the body as
+// HTML with matched words wrapped in <mark>.
+type ChirpSearchResult struct {
+	ChirpResponse
+	Score       float64 `json:"score"`
+	Highlighted string  `json:"highlighted"`
 }
 type UserRequest struct {
 	Email            string `json:"email"`
@@ -55,19 +330,72 @@ type UserRequest struct {
 	ExpiresInSeconds int    `json:"expires_in_seconds"`
 }
 
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type EmailVerificationRequest struct {
+	Token string `json:"token"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// MFAChallengeResponse is what logging in returns instead of tokens when
+// the user has TOTP enabled. MFAToken is exchanged at POST /api/login/mfa.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type MFALoginRequest struct {
+	MFAToken         string `json:"mfa_token"`
+	Code             string `json:"code"`
+	ExpiresInSeconds int    `json:"expires_in_seconds"`
+}
+
+// MFACodeRequest carries a TOTP code or, where accepted, a recovery code.
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	// QRCode is URI as a PNG QR code in a data: URL.
+	QRCode string `json:"qr_code"`
+}
+
+type LoginLockoutResponse struct {
+	Scope       string `json:"scope"`
+	Subject     string `json:"subject"`
+	Failures    int    `json:"failures"`
+	LockedUntil string `json:"locked_until"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
 type UserResponse struct {
-	ID           string `json:"id"`
-	CreatedAt    string `json:"created_at"`
-	UpdatedAt    string `json:"updated_at"`
-	Email        string `json:"email"`
-	Token        string `json:"token,omitempty"`
-	RefreshToken string `json:"refresh_token,omitempty"`
-	IsChirpyRed  bool   `json:"is_chirpy_red,omitempty"`
+	ID            string `json:"id"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+	Email         string `json:"email"`
+	Token         string `json:"token,omitempty"`
+	RefreshToken  string `json:"refresh_token,omitempty"`
+	IsChirpyRed   bool   `json:"is_chirpy_red,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
 type ChirpRequest struct {
-	UserId string `json:"user_id"`
-	Body   string `json:"body"`
+	UserId      string `json:"user_id"`
+	Body        string `json:"body"`
+	InReplyToId string `json:"in_reply_to_id,omitempty"`
+	QuoteOfId   string `json:"quote_of_id,omitempty"`
 }
 
 type CleanResponse struct {
@@ -77,3 +405,15 @@ type CleanResponse struct {
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
+
+// PasswordPolicyErrorResponse refuses a password, listing every rule it
+// fails rather than only the first.
+type PasswordPolicyErrorResponse struct {
+	Error      string              `json:"error"`
+	Violations []PasswordViolation `json:"violations"`
+}
+
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
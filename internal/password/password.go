@@ -0,0 +1,86 @@
+// Package password decides whether a password is acceptable for an
+// account.
+package password
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxBytes is the longest password bcrypt can hash. It would otherwise
+// fail on, or in older versions silently ignore, anything beyond.
+const MaxBytes = 72
+
+// Rule names one requirement a password can fail.
+type Rule string
+
+const (
+	// RuleMinLength requires at least Policy.MinLength characters.
+	RuleMinLength Rule = "min_length"
+	// RuleMaxBytes requires at most MaxBytes bytes.
+	RuleMaxBytes Rule = "max_bytes"
+	// RuleCommon refuses passwords on the bundled list of common ones.
+	RuleCommon Rule = "common"
+	// RuleNotEmail refuses the account's own email address.
+	RuleNotEmail Rule = "not_email"
+)
+
+// Violation is one rule a password fails, with a message for its owner.
+type Violation struct {
+	Rule    Rule
+	Message string
+}
+
+// Policy is what a password must satisfy.
+type Policy struct {
+	// MinLength is counted in characters, not bytes.
+	MinLength int
+	// BlockCommon refuses the passwords in the bundled common list.
+	BlockCommon bool
+}
+
+//go:embed common.txt
+var commonList string
+
+var common = parseList(commonList)
+
+func parseList(list string) map[string]bool {
+	words := make(map[string]bool)
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words[strings.ToLower(line)] = true
+	}
+	return words
+}
+
+// IsCommon reports whether password is on the bundled list of common
+// passwords, ignoring case.
+func IsCommon(password string) bool {
+	return common[strings.ToLower(password)]
+}
+
+// Check returns every rule password fails for the account with email, or
+// nil if it is acceptable. An empty email skips RuleNotEmail.
+func (p Policy) Check(password, email string) []Violation {
+	var violations []Violation
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{RuleMinLength,
+			fmt.Sprintf("password must be at least %d characters", p.MinLength)})
+	}
+	if len(password) > MaxBytes {
+		violations = append(violations, Violation{RuleMaxBytes,
+			fmt.Sprintf("password must be at most %d bytes", MaxBytes)})
+	}
+	if p.BlockCommon && IsCommon(password) {
+		violations = append(violations, Violation{RuleCommon, "password is too common"})
+	}
+	if email = strings.TrimSpace(email); email != "" && strings.EqualFold(strings.TrimSpace(password), email) {
+		violations = append(violations, Violation{RuleNotEmail, "password must not be your email address"})
+	}
+	return violations
+}
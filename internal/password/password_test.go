@@ -0,0 +1,61 @@
+package password
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func rules(violations []Violation) []Rule {
+	var got []Rule
+	for _, v := range violations {
+		got = append(got, v.Rule)
+	}
+	return got
+}
+
+func TestCheck(t *testing.T) {
+	policy := Policy{MinLength: 8, BlockCommon: true}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		expected []Rule
+	}{
+		{name: "Acceptable", password: "correct horse battery staple", email: "walt@example.com"},
+		{name: "Empty", password: "", expected: []Rule{RuleMinLength}},
+		{name: "Short and common", password: "qwerty", expected: []Rule{RuleMinLength, RuleCommon}},
+		{name: "Common in any case", password: "PassWord123", expected: []Rule{RuleCommon}},
+		{name: "Characters not bytes", password: "ééééééé", expected: []Rule{RuleMinLength}},
+		{name: "Exactly the limit", password: strings.Repeat("a", MaxBytes)},
+		{name: "Over the limit", password: strings.Repeat("a", MaxBytes+1), expected: []Rule{RuleMaxBytes}},
+		{name: "Multibyte over the limit", password: strings.Repeat("é", 40), expected: []Rule{RuleMaxBytes}},
+		{name: "Email", password: "Walt@Example.com", email: "walt@example.com", expected: []Rule{RuleNotEmail}},
+		{name: "No email given", password: "walt@example.com"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rules(policy.Check(tc.password, tc.email)); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckWithoutCommonList(t *testing.T) {
+	policy := Policy{MinLength: 4}
+	if violations := policy.Check("password", ""); violations != nil {
+		t.Errorf("expected common passwords to be allowed, got %v", violations)
+	}
+}
+
+func TestCommonList(t *testing.T) {
+	if len(common) < 200 {
+		t.Errorf("expected the bundled list to be loaded, got %d passwords", len(common))
+	}
+	if IsCommon("# frequently used passwords, one per line, compared without regard to case.") {
+		t.Error("expected comments to be skipped")
+	}
+}
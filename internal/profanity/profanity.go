@@ -0,0 +1,204 @@
+// Package profanity finds listed words in chirp bodies and decides what
+// happens to them.
+package profanity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Action is what a listed word does to a chirp that contains it.
+type Action string
+
+const (
+	// Mask replaces the word with Replacement.
+	Mask Action = "mask"
+	// Reject refuses the chirp.
+	Reject Action = "reject"
+	// Flag keeps the word and marks the chirp for review.
+	Flag Action = "flag"
+)
+
+// Replacement is what a masked word becomes, whatever its length.
+const Replacement = "****"
+
+var ErrInvalidWord = errors.New("word must be a single word of letters and digits")
+
+// ParseAction accepts the name of an action in any case.
+func ParseAction(s string) (Action, error) {
+	switch a := Action(strings.ToLower(strings.TrimSpace(s))); a {
+	case Mask, Reject, Flag:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown action %q (want %s, %s or %s)", s, Mask, Reject, Flag)
+}
+
+// Rule lists a word and its action.
+type Rule struct {
+	Word   string
+	Action Action
+}
+
+// ParseRules reads a comma-separated list such as
+//
+//	kerfuffle, sharbert:reject, fornax:flag
+//
+// A word without an action is masked.
+func ParseRules(list string) ([]Rule, error) {
+	var rules []Rule
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		word, actionStr, hasAction := strings.Cut(item, ":")
+		action := Mask
+		if hasAction {
+			var err error
+			if action, err = ParseAction(actionStr); err != nil {
+				return nil, fmt.Errorf("%s: %w", item, err)
+			}
+		}
+		rules = append(rules, Rule{Word: strings.TrimSpace(word), Action: action})
+	}
+	return rules, nil
+}
+
+// NormalizeWord returns word as the filter compares it, or "" if it is not
+// a single word the filter could match.
+func NormalizeWord(word string) string {
+	word = strings.TrimSpace(word)
+	if word == "" || strings.IndexFunc(word, func(r rune) bool { return !isWordRune(r) }) >= 0 {
+		return ""
+	}
+	return fold(word)
+}
+
+// fold puts a word in the form words are compared in: lower case and NFC,
+// so a precomposed "ở" matches one typed as "o" and combining marks.
+func fold(word string) string {
+	return norm.NFC.String(strings.ToLower(word))
+}
+
+// Result is what Apply made of a text. Rejected and Flagged hold the
+// distinct listed words found with that action, in the order first seen.
+type Result struct {
+	Text     string
+	Rejected []string
+	Flagged  []string
+}
+
+// Filter holds the listed words. It is safe for concurrent use, so the
+// list can change while chirps are being checked.
+type Filter struct {
+	mu    sync.RWMutex
+	rules map[string]Action
+}
+
+func NewFilter(rules ...Rule) (*Filter, error) {
+	f := &Filter{rules: make(map[string]Action)}
+	for _, rule := range rules {
+		if err := f.Set(rule); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Set adds a word or changes its action.
+func (f *Filter) Set(rule Rule) error {
+	word := NormalizeWord(rule.Word)
+	if word == "" {
+		return fmt.Errorf("%q: %w", rule.Word, ErrInvalidWord)
+	}
+	action, err := ParseAction(string(rule.Action))
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules[word] = action
+	return nil
+}
+
+// Remove takes a word off the list and reports whether it was on it.
+func (f *Filter) Remove(word string) bool {
+	word = NormalizeWord(word)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.rules[word]
+	delete(f.rules, word)
+	return ok
+}
+
+// Rules returns the list sorted by word.
+func (f *Filter) Rules() []Rule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	rules := make([]Rule, 0, len(f.rules))
+	for word, action := range f.rules {
+		rules = append(rules, Rule{Word: word, Action: action})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Word < rules[j].Word })
+	return rules
+}
+
+// Apply checks every word in text. Words are runs of letters, digits and
+// combining marks compared without regard to case, so punctuation around a
+// word does not hide it and a listed word inside a longer one does not
+// match. Everything but masked words is left exactly as written.
+func (f *Filter) Apply(text string) Result {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var out strings.Builder
+	var result Result
+	seen := make(map[string]bool)
+	last := 0
+	for start := 0; start < len(text); {
+		r, size := utf8.DecodeRuneInString(text[start:])
+		if !isWordRune(r) {
+			start += size
+			continue
+		}
+		end := start + size
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if !isWordRune(r) {
+				break
+			}
+			end += size
+		}
+
+		word := fold(text[start:end])
+		switch action := f.rules[word]; action {
+		case Mask:
+			out.WriteString(text[last:start])
+			out.WriteString(Replacement)
+			last = end
+		case Reject, Flag:
+			if !seen[word] {
+				seen[word] = true
+				if action == Reject {
+					result.Rejected = append(result.Rejected, word)
+				} else {
+					result.Flagged = append(result.Flagged, word)
+				}
+			}
+		}
+		start = end
+	}
+	out.WriteString(text[last:])
+	result.Text = out.String()
+	return result
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
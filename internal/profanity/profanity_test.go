@@ -0,0 +1,90 @@
+package profanity
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	f, err := NewFilter(
+		Rule{Word: "kerfuffle", Action: Mask},
+		Rule{Word: "Sharbert", Action: Mask},
+		Rule{Word: "fornax", Action: Reject},
+		Rule{Word: "gloop", Action: Flag},
+		Rule{Word: "phở", Action: Mask},
+	)
+	if err != nil {
+		t.Fatalf("NewFilter returned error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected Result
+	}{
+		{"clean", "This is a clean text", Result{Text: "This is a clean text"}},
+		{"mask", "This is kerfuffle and sharbert", Result{Text: "This is **** and ****"}},
+		{"case", "KERFUFFLE and Sharbert", Result{Text: "**** and ****"}},
+		{"punctuation", "What a kerfuffle! (sharbert)", Result{Text: "What a ****! (****)"}},
+		{"spacing kept", "  kerfuffle\n\tok  ", Result{Text: "  ****\n\tok  "}},
+		{"longer word", "kerfuffles and unsharbert", Result{Text: "kerfuffles and unsharbert"}},
+		{"unicode", "Phở? PHỞ.", Result{Text: "****? ****."}},
+		{"decomposed", "pho\u031b\u0309!", Result{Text: "****!"}},
+		{"reject", "fornax, then FORNAX", Result{Text: "fornax, then FORNAX", Rejected: []string{"fornax"}}},
+		{"flag", "gloop kerfuffle", Result{Text: "gloop ****", Flagged: []string{"gloop"}}},
+		{"empty", "", Result{Text: ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Apply(tt.text); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFilterRules(t *testing.T) {
+	f, err := NewFilter(Rule{Word: "kerfuffle", Action: Mask})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set(Rule{Word: "Kerfuffle", Action: Reject}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	if err := f.Set(Rule{Word: "two words", Action: Mask}); !errors.Is(err, ErrInvalidWord) {
+		t.Errorf("expected ErrInvalidWord, got %v", err)
+	}
+	if err := f.Set(Rule{Word: "gloop", Action: "shout"}); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+	if got, expected := f.Rules(), []Rule{{"kerfuffle", Reject}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if !f.Remove("KERFUFFLE") || f.Remove("kerfuffle") {
+		t.Error("expected Remove to report whether the word was listed")
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		list     string
+		expected []Rule
+		wantErr  bool
+	}{
+		{"kerfuffle, sharbert:REJECT,fornax:flag,", []Rule{{"kerfuffle", Mask}, {"sharbert", Reject}, {"fornax", Flag}}, false},
+		{"", nil, false},
+		{"kerfuffle:shout", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := ParseRules(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
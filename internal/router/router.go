@@ -8,6 +8,28 @@ import (
 	"github.com/G0SU19O2/Chirpy/internal/middleware"
 )
 
+// access says who may call a route.
+type access int
+
+const (
+	public access = iota
+	// optionalUser routes are public but identify the caller when a token
+	// is sent, so responses can include per-user state.
+	optionalUser
+	authenticated
+	// verified routes publish chirps, which REQUIRE_VERIFIED_EMAIL holds
+	// back until the user's email address is verified.
+	verified
+	// admin routes need ADMIN_API_KEY.
+	admin
+)
+
+type route struct {
+	pattern string
+	access  access
+	handler http.HandlerFunc
+}
+
 func SetupRoutes(cfg *config.Config) *http.ServeMux {
 	mux := http.NewServeMux()
 
@@ -18,17 +40,70 @@ func SetupRoutes(cfg *config.Config) *http.ServeMux {
 	mux.HandleFunc("GET /admin/metrics", handlers.HandleMetrics(cfg))
 	mux.HandleFunc("POST /admin/reset", handlers.HandleReset(cfg))
 
+	// Public keys for verifying access tokens
+	mux.HandleFunc("GET /.well-known/jwks.json", middleware.JSONContentType(handlers.HandleJWKS(cfg)))
+
 	// API routes
 	mux.HandleFunc("GET /api/healthz", handlers.HandleReadiness)
-	mux.HandleFunc("POST /api/users", middleware.JSONContentType(handlers.HandleCreateUser(cfg)))
-	mux.HandleFunc("PUT /api/users", middleware.JSONContentType(handlers.HandleUpdateUser(cfg)))
-	mux.HandleFunc("POST /api/chirps", middleware.JSONContentType(handlers.HandleCreateChirp(cfg)))
-	mux.HandleFunc("GET /api/chirps", middleware.JSONContentType(handlers.HandleGetAllChirps(cfg)))
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", middleware.JSONContentType(handlers.HandleDeleteChirp(cfg)))
-	mux.HandleFunc("GET /api/chirps/{chirpID}", middleware.JSONContentType(handlers.HandleGetChirpById(cfg)))
-	mux.HandleFunc("POST /api/login", middleware.JSONContentType(handlers.HandleLoginUser(cfg)))
-	mux.HandleFunc("POST /api/refresh", middleware.JSONContentType(handlers.HandleRefreshToken(cfg)))
-	mux.HandleFunc("POST /api/revoke", middleware.JSONContentType(handlers.HandleRevokeToken(cfg)))
-	mux.HandleFunc("POST /api/polka/webhooks", middleware.JSONContentType(handlers.HandleWebHook(cfg)))
+	for _, rt := range []route{
+		{"POST /api/users", public, handlers.HandleCreateUser(cfg)},
+		{"PUT /api/users", authenticated, handlers.HandleUpdateUser(cfg)},
+		{"POST /api/chirps", verified, handlers.HandleCreateChirp(cfg)},
+		{"GET /api/chirps", optionalUser, handlers.HandleGetAllChirps(cfg)},
+		{"GET /api/chirps/search", optionalUser, handlers.HandleSearchChirps(cfg)},
+		{"DELETE /api/chirps/{chirpID}", authenticated, handlers.HandleDeleteChirp(cfg)},
+		{"GET /api/chirps/{chirpID}", optionalUser, handlers.HandleGetChirpById(cfg)},
+		{"PUT /api/chirps/{chirpID}", verified, handlers.HandleEditChirp(cfg)},
+		{"GET /api/chirps/{chirpID}/revisions", public, handlers.HandleListChirpRevisions(cfg)},
+		{"GET /api/chirps/{chirpID}/thread", optionalUser, handlers.HandleGetChirpThread(cfg)},
+		{"POST /api/chirps/{chirpID}/likes", authenticated, handlers.HandleLikeChirp(cfg)},
+		{"DELETE /api/chirps/{chirpID}/likes", authenticated, handlers.HandleUnlikeChirp(cfg)},
+		{"POST /api/chirps/{chirpID}/rechirps", verified, handlers.HandleRechirp(cfg)},
+		{"DELETE /api/chirps/{chirpID}/rechirps", authenticated, handlers.HandleUndoRechirp(cfg)},
+		{"GET /api/users/{userID}/likes", optionalUser, handlers.HandleListUserLikes(cfg)},
+		{"POST /api/users/{userID}/follow", authenticated, handlers.HandleFollowUser(cfg)},
+		{"DELETE /api/users/{userID}/follow", authenticated, handlers.HandleUnfollowUser(cfg)},
+		{"GET /api/users/{userID}/followers", public, handlers.HandleListFollowers(cfg)},
+		{"GET /api/users/{userID}/following", public, handlers.HandleListFollowing(cfg)},
+		{"GET /api/timeline", authenticated, handlers.HandleTimeline(cfg)},
+		{"GET /api/hashtags/trending", public, handlers.HandleTrendingHashtags(cfg)},
+		{"GET /api/hashtags/{tag}/chirps", optionalUser, handlers.HandleListHashtagChirps(cfg)},
+		{"POST /api/login", public, handlers.HandleLoginUser(cfg)},
+		{"POST /api/login/mfa", public, handlers.HandleLoginMFA(cfg)},
+		{"POST /api/refresh", public, handlers.HandleRefreshToken(cfg)},
+		{"POST /api/revoke", public, handlers.HandleRevokeToken(cfg)},
+		{"POST /api/password-reset/request", public, handlers.HandleRequestPasswordReset(cfg)},
+		{"POST /api/password-reset/confirm", public, handlers.HandleConfirmPasswordReset(cfg)},
+		{"POST /api/email-verification/request", authenticated, handlers.HandleRequestEmailVerification(cfg)},
+		{"POST /api/email-verification/confirm", public, handlers.HandleConfirmEmailVerification(cfg)},
+		{"POST /api/mfa/totp/enroll", authenticated, handlers.HandleEnrollTOTP(cfg)},
+		{"POST /api/mfa/totp/confirm", authenticated, handlers.HandleConfirmTOTP(cfg)},
+		{"DELETE /api/mfa/totp", authenticated, handlers.HandleDisableTOTP(cfg)},
+		{"POST /api/polka/webhooks", public, handlers.HandleWebHook(cfg)},
+		{"GET /admin/profanity", admin, handlers.HandleListProfanityWords(cfg)},
+		{"PUT /admin/profanity/{word}", admin, handlers.HandleSetProfanityWord(cfg)},
+		{"DELETE /admin/profanity/{word}", admin, handlers.HandleDeleteProfanityWord(cfg)},
+		{"GET /admin/chirps/flagged", admin, handlers.HandleListFlaggedChirps(cfg)},
+		{"POST /admin/chirps/{chirpID}/review", admin, handlers.HandleReviewChirp(cfg)},
+		{"GET /admin/lockouts", admin, handlers.HandleListLoginLockouts(cfg)},
+		{"DELETE /admin/lockouts/{scope}/{subject}", admin, handlers.HandleClearLoginLockout(cfg)},
+	} {
+		mux.HandleFunc(rt.pattern, middleware.JSONContentType(guard(cfg, rt.access, rt.handler)))
+	}
 	return mux
 }
+
+// guard wraps h in the middleware that enforces level.
+func guard(cfg *config.Config, level access, h http.HandlerFunc) http.HandlerFunc {
+	switch level {
+	case optionalUser:
+		return middleware.OptionalUser(cfg)(h)
+	case authenticated:
+		return middleware.RequireUser(cfg)(h)
+	case verified:
+		return middleware.RequireUser(cfg)(middleware.RequireVerifiedEmail(cfg)(h))
+	case admin:
+		return middleware.RequireAdminKey(cfg)(h)
+	}
+	return h
+}
@@ -0,0 +1,1397 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/auth"
+	"github.com/G0SU19O2/Chirpy/internal/background"
+	"github.com/G0SU19O2/Chirpy/internal/config"
+	"github.com/G0SU19O2/Chirpy/internal/mail"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/store"
+	"github.com/G0SU19O2/Chirpy/internal/totp"
+)
+
+const (
+	testJWTSecret = "0123456789abcdef0123456789abcdef"
+	testPolkaKey  = "polka-key"
+	testPassword  = "correct horse battery staple"
+)
+
+type testClient struct {
+	t       *testing.T
+	cfg     *config.Config
+	mux     *http.ServeMux
+	mailbox *mailbox
+}
+
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+	cfg := config.New(store.NewMemoryStore(), config.PlatformDev, testJWTSecret, testPolkaKey)
+	box := &mailbox{}
+	cfg.Mailer = box
+	t.Cleanup(func() { cfg.MailQueue.Close(context.Background()) })
+	return &testClient{t: t, cfg: cfg, mux: SetupRoutes(cfg), mailbox: box}
+}
+
+// mailbox keeps the email the server sends.
+type mailbox struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *mailbox) messages() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.sent)
+}
+
+// blockedMailer holds each message until release is closed, reporting on
+// sending that it has one.
+type blockedMailer struct {
+	mail.Mailer
+	sending chan<- struct{}
+	release <-chan struct{}
+}
+
+func (m blockedMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sending <- struct{}{}
+	<-m.release
+	return m.Mailer.Send(ctx, msg)
+}
+
+// flushMail waits for the email the server queued after answering to be
+// sent, then gives it a fresh queue.
+func (c *testClient) flushMail() []mail.Message {
+	c.t.Helper()
+	if err := c.cfg.MailQueue.Close(context.Background()); err != nil {
+		c.t.Fatalf("closing mail queue: %v", err)
+	}
+	c.cfg.MailQueue = background.NewQueue(config.DefaultMailWorkers, config.DefaultMailQueueSize)
+	return c.mailbox.messages()
+}
+
+func (c *testClient) do(method, path, authorization string, payload interface{}) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			c.t.Fatalf("encoding payload: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &body)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	c.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+}
+
+func (c *testClient) signup(email, password string) models.UserResponse {
+	c.t.Helper()
+	rec := c.do("POST", "/api/users", "", models.UserRequest{Email: email, Password: password})
+	expectStatus(c.t, rec, http.StatusCreated)
+	return decode[models.UserResponse](c.t, rec)
+}
+
+func (c *testClient) login(email, password string) models.UserResponse {
+	c.t.Helper()
+	rec := c.do("POST", "/api/login", "", models.UserRequest{Email: email, Password: password})
+	expectStatus(c.t, rec, http.StatusOK)
+	return decode[models.UserResponse](c.t, rec)
+}
+
+func TestUserLifecycle(t *testing.T) {
+	c := newTestClient(t)
+
+	created := c.signup("walt@example.com", "walt-04234-heisenberg")
+	if created.Email != "walt@example.com" {
+		t.Errorf("expected email walt@example.com, got %s", created.Email)
+	}
+
+	rec := c.do("POST", "/api/login", "", models.UserRequest{Email: "walt@example.com", Password: "wrong"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	loggedIn := c.login("walt@example.com", "walt-04234-heisenberg")
+	if loggedIn.Token == "" || loggedIn.RefreshToken == "" {
+		t.Fatal("expected login to return access and refresh tokens")
+	}
+
+	rec = c.do("PUT", "/api/users", "Bearer "+loggedIn.Token, models.UserUpdateRequest{Email: "walter@example.com", Password: "new password 1"})
+	expectStatus(t, rec, http.StatusOK)
+	c.login("walter@example.com", "new password 1")
+
+	rec = c.do("POST", "/api/refresh", "Bearer "+loggedIn.RefreshToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	refreshed := decode[map[string]string](t, rec)
+	if refreshed["token"] == "" || refreshed["refresh_token"] == "" {
+		t.Fatalf("expected refresh to return a new access and refresh token, got %v", refreshed)
+	}
+
+	rec = c.do("POST", "/api/revoke", "Bearer "+refreshed["refresh_token"], nil)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	rec = c.do("POST", "/api/refresh", "Bearer "+refreshed["refresh_token"], nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("reuse@example.com", testPassword)
+	loggedIn := c.login("reuse@example.com", testPassword)
+
+	rec := c.do("POST", "/api/refresh", "Bearer "+loggedIn.RefreshToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+	rotated := decode[map[string]string](t, rec)["refresh_token"]
+
+	rec = c.do("POST", "/api/refresh", "Bearer "+loggedIn.RefreshToken, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	if errResp := decode[models.ErrorResponse](t, rec); errResp.Error != "refresh token reuse detected" {
+		t.Errorf("expected reuse to be reported, got %q", errResp.Error)
+	}
+
+	rec = c.do("POST", "/api/refresh", "Bearer "+rotated, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	other := c.login("reuse@example.com", testPassword)
+	rec = c.do("POST", "/api/refresh", "Bearer "+other.RefreshToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestChirpLifecycle(t *testing.T) {
+	c := newTestClient(t)
+
+	author := c.signup("author@example.com", testPassword)
+	authorLogin := c.login("author@example.com", testPassword)
+	c.signup("other@example.com", testPassword)
+	otherLogin := c.login("other@example.com", testPassword)
+
+	rec := c.do("POST", "/api/chirps", "", models.ChirpRequest{UserId: author.ID, Body: "no token"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = c.do("POST", "/api/chirps", "Bearer "+authorLogin.Token, models.ChirpRequest{UserId: author.ID, Body: "I had a kerfuffle today"})
+	expectStatus(t, rec, http.StatusCreated)
+	chirp := decode[models.ChirpResponse](t, rec)
+	if chirp.Body != "I had a **** today" {
+		t.Errorf("expected profanity to be cleaned, got %q", chirp.Body)
+	}
+
+	rec = c.do("GET", "/api/chirps/"+chirp.Id, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = c.do("GET", "/api/chirps?author_id="+author.ID, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if chirps := decode[[]models.ChirpResponse](t, rec); len(chirps) != 1 {
+		t.Errorf("expected 1 chirp for author, got %d", len(chirps))
+	}
+
+	rec = c.do("DELETE", "/api/chirps/"+chirp.Id, "Bearer "+otherLogin.Token, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = c.do("DELETE", "/api/chirps/"+chirp.Id, "Bearer "+authorLogin.Token, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	rec = c.do("GET", "/api/chirps/"+chirp.Id, "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestPolkaWebhook(t *testing.T) {
+	c := newTestClient(t)
+	user := c.signup("red@example.com", testPassword)
+
+	event := models.WebhookRequest{Event: "user.upgraded"}
+	event.Data.UserID = user.ID
+
+	rec := c.do("POST", "/api/polka/webhooks", "wrong-key", event)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = c.do("POST", "/api/polka/webhooks", testPolkaKey, event)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	loggedIn := c.login("red@example.com", testPassword)
+	if !loggedIn.IsChirpyRed {
+		t.Error("expected user to be upgraded to Chirpy Red")
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("forgetful@example.com", "old passphrase")
+	session := c.login("forgetful@example.com", "old passphrase")
+
+	before := len(c.mailbox.messages())
+
+	// The email is held until the request has been answered, so a request
+	// for an address with an account must not wait for it.
+	sending, release := make(chan struct{}, 1), make(chan struct{})
+	c.cfg.Mailer = blockedMailer{Mailer: c.mailbox, sending: sending, release: release}
+	for _, email := range []string{"nobody@example.com", "forgetful@example.com"} {
+		rec := c.do("POST", "/api/password-reset/request", "", models.PasswordResetRequest{Email: email})
+		expectStatus(t, rec, http.StatusAccepted)
+	}
+	<-sending
+	if sent := c.mailbox.messages(); len(sent) != before {
+		t.Fatalf("expected nothing delivered while the mailer is blocked, got %+v", sent[before:])
+	}
+	close(release)
+
+	sent := c.flushMail()[before:]
+	if len(sent) != 1 || sent[0].To != "forgetful@example.com" {
+		t.Fatalf("expected one email to forgetful@example.com, got %+v", sent)
+	}
+	token := mailedToken(t, sent[0].Body)
+
+	rec := c.do("POST", "/api/password-reset/confirm", "", models.PasswordResetConfirmRequest{Token: "wrong", Password: "new passphrase"})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = c.do("POST", "/api/password-reset/confirm", "", models.PasswordResetConfirmRequest{Token: token, Password: "new passphrase"})
+	expectStatus(t, rec, http.StatusNoContent)
+
+	rec = c.do("POST", "/api/password-reset/confirm", "", models.PasswordResetConfirmRequest{Token: token, Password: "newer passphrase"})
+	expectStatus(t, rec, http.StatusBadRequest)
+	if got := decode[models.ErrorResponse](t, rec); got.Error != "reset token is invalid or expired" {
+		t.Errorf("expected a used token to be refused, got %q", got.Error)
+	}
+
+	rec = c.do("POST", "/api/refresh", "Bearer "+session.RefreshToken, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = c.do("POST", "/api/login", "", models.UserRequest{Email: "forgetful@example.com", Password: "old passphrase"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+	c.login("forgetful@example.com", "new passphrase")
+
+	// Once the queue is full, requests are refused instead of piling up.
+	sending, release = make(chan struct{}, 1), make(chan struct{})
+	c.cfg.Mailer = blockedMailer{Mailer: c.mailbox, sending: sending, release: release}
+	c.cfg.MailQueue = background.NewQueue(1, 1)
+	rec = c.do("POST", "/api/password-reset/request", "", models.PasswordResetRequest{Email: "forgetful@example.com"})
+	expectStatus(t, rec, http.StatusAccepted)
+	<-sending
+	rec = c.do("POST", "/api/password-reset/request", "", models.PasswordResetRequest{Email: "forgetful@example.com"})
+	expectStatus(t, rec, http.StatusAccepted)
+	rec = c.do("POST", "/api/password-reset/request", "", models.PasswordResetRequest{Email: "nobody@example.com"})
+	expectStatus(t, rec, http.StatusServiceUnavailable)
+	close(release)
+	if sent := c.flushMail(); len(sent) != before+3 {
+		t.Errorf("expected both queued resets to be sent, got %d emails", len(sent)-before)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	c := newTestClient(t)
+	violations := func(rec *httptest.ResponseRecorder) []string {
+		t.Helper()
+		expectStatus(t, rec, http.StatusBadRequest)
+		var rules []string
+		for _, v := range decode[models.PasswordPolicyErrorResponse](t, rec).Violations {
+			rules = append(rules, v.Rule)
+		}
+		return rules
+	}
+
+	rec := c.do("POST", "/api/users", "", models.UserRequest{Email: "lazy@example.com", Password: ""})
+	if got := violations(rec); !reflect.DeepEqual(got, []string{"min_length"}) {
+		t.Errorf("expected an empty password to be too short, got %v", got)
+	}
+	rec = c.do("POST", "/api/users", "", models.UserRequest{Email: "lazy@example.com", Password: "qwerty"})
+	if got := violations(rec); !reflect.DeepEqual(got, []string{"min_length", "common"}) {
+		t.Errorf("expected every failed rule, got %v", got)
+	}
+	rec = c.do("POST", "/api/users", "", models.UserRequest{Email: "lazy@example.com", Password: "LAZY@example.com"})
+	if got := violations(rec); !reflect.DeepEqual(got, []string{"not_email"}) {
+		t.Errorf("expected the email address to be refused, got %v", got)
+	}
+	rec = c.do("POST", "/api/users", "", models.UserRequest{Email: "lazy@example.com", Password: strings.Repeat("long ", 15)})
+	if got := violations(rec); !reflect.DeepEqual(got, []string{"max_bytes"}) {
+		t.Errorf("expected a password bcrypt cannot hash to be refused, got %v", got)
+	}
+
+	c.signup("lazy@example.com", testPassword)
+	bearer := "Bearer " + c.login("lazy@example.com", testPassword).Token
+	rec = c.do("PUT", "/api/users", bearer, models.UserUpdateRequest{Email: "moved@example.com", Password: "moved@example.com"})
+	if got := violations(rec); !reflect.DeepEqual(got, []string{"not_email"}) {
+		t.Errorf("expected the new email address to be refused, got %v", got)
+	}
+	rec = c.do("PUT", "/api/users", bearer, models.UserUpdateRequest{Password: "password1"})
+	if got := violations(rec); !reflect.DeepEqual(got, []string{"common"}) {
+		t.Errorf("expected a common password to be refused, got %v", got)
+	}
+	c.login("lazy@example.com", testPassword)
+
+	before := len(c.mailbox.messages())
+	rec = c.do("POST", "/api/password-reset/request", "", models.PasswordResetRequest{Email: "lazy@example.com"})
+	expectStatus(t, rec, http.StatusAccepted)
+	token := mailedToken(t, c.flushMail()[before].Body)
+	rec = c.do("POST", "/api/password-reset/confirm", "", models.PasswordResetConfirmRequest{Token: token, Password: "short"})
+	if got := violations(rec); !reflect.DeepEqual(got, []string{"min_length"}) {
+		t.Errorf("expected reset passwords to follow the policy, got %v", got)
+	}
+	rec = c.do("POST", "/api/password-reset/confirm", "", models.PasswordResetConfirmRequest{Token: token, Password: "Lazy@Example.com"})
+	if got := violations(rec); !reflect.DeepEqual(got, []string{"not_email"}) {
+		t.Errorf("expected a reset to refuse the account's email address, got %v", got)
+	}
+	rec = c.do("POST", "/api/password-reset/confirm", "", models.PasswordResetConfirmRequest{Token: token, Password: "lazy passphrase 2"})
+	expectStatus(t, rec, http.StatusNoContent)
+	bearer = "Bearer " + c.login("lazy@example.com", "lazy passphrase 2").Token
+
+	c.cfg.PasswordPolicy.BlockCommon = false
+	rec = c.do("PUT", "/api/users", bearer, models.UserUpdateRequest{Password: "password1"})
+	expectStatus(t, rec, http.StatusOK)
+}
+
+// mailedToken picks the token out of a password reset or verification
+// email: the line after the instructions.
+func mailedToken(t *testing.T, body string) string {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if len(line) == 64 && strings.Trim(line, "0123456789abcdef") == "" {
+			return line
+		}
+	}
+	t.Fatalf("no token in email:\n%s", body)
+	return ""
+}
+
+func TestEmailVerification(t *testing.T) {
+	c := newTestClient(t)
+	c.cfg.RequireVerifiedEmail = true
+	created := c.signup("owner@example.com", testPassword)
+	if created.EmailVerified {
+		t.Error("expected a new user to be unverified")
+	}
+	sent := c.mailbox.messages()
+	if len(sent) != 1 || sent[0].To != "owner@example.com" {
+		t.Fatalf("expected a verification email to owner@example.com, got %+v", sent)
+	}
+	signupToken := mailedToken(t, sent[0].Body)
+	session := c.login("owner@example.com", testPassword)
+
+	rec := c.do("POST", "/api/chirps", "Bearer "+session.Token, models.ChirpRequest{Body: "hello"})
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = c.do("POST", "/api/email-verification/request", "Bearer "+session.Token, nil)
+	expectStatus(t, rec, http.StatusAccepted)
+	resentToken := mailedToken(t, c.mailbox.messages()[1].Body)
+
+	rec = c.do("POST", "/api/email-verification/confirm", "", models.EmailVerificationRequest{Token: "wrong"})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = c.do("POST", "/api/email-verification/confirm", "", models.EmailVerificationRequest{Token: signupToken})
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = c.do("POST", "/api/email-verification/confirm", "", models.EmailVerificationRequest{Token: resentToken})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	if !c.login("owner@example.com", testPassword).EmailVerified {
+		t.Error("expected the user to be verified")
+	}
+	rec = c.do("POST", "/api/chirps", "Bearer "+session.Token, models.ChirpRequest{Body: "hello"})
+	expectStatus(t, rec, http.StatusCreated)
+	rec = c.do("POST", "/api/email-verification/request", "Bearer "+session.Token, nil)
+	expectStatus(t, rec, http.StatusConflict)
+
+	c.signup("taken@example.com", testPassword)
+	rec = c.do("POST", "/api/users", "", models.UserRequest{Email: "taken@example.com", Password: "another passphrase"})
+	expectStatus(t, rec, http.StatusConflict)
+	if got := decode[models.ErrorResponse](t, rec); got.Error != "email is already in use" {
+		t.Errorf("expected a taken address to be refused, got %q", got.Error)
+	}
+	c.login("taken@example.com", testPassword)
+	sent = c.mailbox.messages()
+	rec = c.do("PUT", "/api/users", "Bearer "+session.Token, models.UserUpdateRequest{Email: "taken@example.com"})
+	expectStatus(t, rec, http.StatusConflict)
+	if !c.login("owner@example.com", testPassword).EmailVerified {
+		t.Error("expected a refused change to leave the address verified")
+	}
+
+	rec = c.do("PUT", "/api/users", "Bearer "+session.Token, models.UserUpdateRequest{Email: "moved@example.com"})
+	expectStatus(t, rec, http.StatusOK)
+	if decode[models.UserResponse](t, rec).EmailVerified {
+		t.Error("expected changing the address to need verification again")
+	}
+	sent = c.mailbox.messages()[len(sent):]
+	if len(sent) != 1 || sent[0].To != "moved@example.com" {
+		t.Fatalf("expected a verification email to moved@example.com, got %+v", sent)
+	}
+	rec = c.do("POST", "/api/chirps", "Bearer "+session.Token, models.ChirpRequest{Body: "hello again"})
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = c.do("POST", "/api/email-verification/confirm", "", models.EmailVerificationRequest{Token: mailedToken(t, sent[0].Body)})
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = c.do("POST", "/api/chirps", "Bearer "+session.Token, models.ChirpRequest{Body: "hello again"})
+	expectStatus(t, rec, http.StatusCreated)
+}
+
+func TestTOTPLogin(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("careful@example.com", testPassword)
+	session := c.login("careful@example.com", testPassword)
+	bearer := "Bearer " + session.Token
+	code := func(t *testing.T, secret string, step int64) string {
+		t.Helper()
+		code, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	rec := c.do("POST", "/api/mfa/totp/confirm", bearer, models.MFACodeRequest{Code: "123456"})
+	expectStatus(t, rec, http.StatusConflict)
+	rec = c.do("POST", "/api/mfa/totp/enroll", bearer, nil)
+	expectStatus(t, rec, http.StatusOK)
+	enrollment := decode[models.TOTPEnrollmentResponse](t, rec)
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/Chirpy:careful@example.com?") || !strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,") {
+		t.Errorf("unexpected enrollment %s", enrollment.URI)
+	}
+	// An unconfirmed secret does not change how logging in works.
+	c.login("careful@example.com", testPassword)
+
+	now := totp.Step(time.Now())
+	current := code(t, enrollment.Secret, now)
+	wrong := current[:5] + string('0'+(current[5]-'0'+1)%10)
+	rec = c.do("POST", "/api/mfa/totp/confirm", bearer, models.MFACodeRequest{Code: wrong})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = c.do("POST", "/api/mfa/totp/confirm", bearer, models.MFACodeRequest{Code: current})
+	expectStatus(t, rec, http.StatusOK)
+	recoveryCodes := decode[models.RecoveryCodesResponse](t, rec).RecoveryCodes
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %v", recoveryCodes)
+	}
+	rec = c.do("POST", "/api/mfa/totp/enroll", bearer, nil)
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = c.do("POST", "/api/login", "", models.UserRequest{Email: "careful@example.com", Password: testPassword})
+	expectStatus(t, rec, http.StatusOK)
+	challenge := decode[models.MFAChallengeResponse](t, rec)
+	if !challenge.MFARequired || challenge.MFAToken == "" || challenge.ExpiresIn != 300 {
+		t.Fatalf("expected an MFA challenge, got %+v", challenge)
+	}
+	if strings.Contains(rec.Body.String(), `"token"`) {
+		t.Errorf("expected no access token before the code, got %s", rec.Body.String())
+	}
+	rec = c.do("POST", "/api/chirps", "Bearer "+challenge.MFAToken, models.ChirpRequest{Body: "sneaky"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+	rec = c.do("POST", "/api/login/mfa", "", models.MFALoginRequest{MFAToken: session.Token, Code: code(t, enrollment.Secret, now+1)})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	// The code used to confirm enrollment cannot be replayed.
+	rec = c.do("POST", "/api/login/mfa", "", models.MFALoginRequest{MFAToken: challenge.MFAToken, Code: current})
+	expectStatus(t, rec, http.StatusUnauthorized)
+	next := code(t, enrollment.Secret, now+1)
+	rec = c.do("POST", "/api/login/mfa", "", models.MFALoginRequest{MFAToken: challenge.MFAToken, Code: next})
+	expectStatus(t, rec, http.StatusOK)
+	if decode[models.UserResponse](t, rec).Token == "" {
+		t.Error("expected an access token after the code")
+	}
+	rec = c.do("POST", "/api/login/mfa", "", models.MFALoginRequest{MFAToken: challenge.MFAToken, Code: next})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	recovery := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", " "))
+	rec = c.do("POST", "/api/login/mfa", "", models.MFALoginRequest{MFAToken: challenge.MFAToken, Code: recovery})
+	expectStatus(t, rec, http.StatusOK)
+	rec = c.do("POST", "/api/login/mfa", "", models.MFALoginRequest{MFAToken: challenge.MFAToken, Code: recovery})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = c.do("DELETE", "/api/mfa/totp", bearer, models.MFACodeRequest{Code: recoveryCodes[0]})
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = c.do("DELETE", "/api/mfa/totp", bearer, models.MFACodeRequest{Code: recoveryCodes[1]})
+	expectStatus(t, rec, http.StatusNoContent)
+	if c.login("careful@example.com", testPassword).Token == "" {
+		t.Error("expected the password alone to log in again")
+	}
+	rec = c.do("DELETE", "/api/mfa/totp", bearer, models.MFACodeRequest{Code: recoveryCodes[2]})
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestLoginLockout(t *testing.T) {
+	c := newTestClient(t)
+	c.cfg.LoginMaxFailures = 3
+	c.signup("target@example.com", testPassword)
+	const adminKey = "admin-key"
+	c.cfg.AdminAPIKey = adminKey
+	login := func(email, password string) *httptest.ResponseRecorder {
+		return c.do("POST", "/api/login", "", models.UserRequest{Email: email, Password: password})
+	}
+
+	for i := 0; i < 3; i++ {
+		expectStatus(t, login("target@example.com", "guess"), http.StatusUnauthorized)
+	}
+	rec := login("target@example.com", testPassword)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	// The lockout started when the last guess failed, a little earlier.
+	if retryAfter, _ := strconv.Atoi(rec.Header().Get("Retry-After")); retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("expected Retry-After of at most 60 seconds, got %q", rec.Header().Get("Retry-After"))
+	}
+	expectStatus(t, login("TARGET@example.com", testPassword), http.StatusTooManyRequests)
+
+	// Unknown addresses are locked out the same way, so lockouts do not
+	// reveal which addresses have accounts.
+	for i := 0; i < 3; i++ {
+		expectStatus(t, login("nobody@example.com", "guess"), http.StatusUnauthorized)
+	}
+	expectStatus(t, login("nobody@example.com", "guess"), http.StatusTooManyRequests)
+
+	rec = c.do("GET", "/admin/lockouts", adminKey, nil)
+	expectStatus(t, rec, http.StatusOK)
+	lockouts := decode[[]models.LoginLockoutResponse](t, rec)
+	if len(lockouts) != 2 || lockouts[0].Scope != models.LoginScopeAccount || lockouts[0].Failures != 3 {
+		t.Fatalf("expected two account lockouts, got %+v", lockouts)
+	}
+
+	rec = c.do("DELETE", "/admin/lockouts/account/Target@example.com", adminKey, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = c.do("DELETE", "/admin/lockouts/account/target@example.com", adminKey, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = c.do("DELETE", "/admin/lockouts/user/target@example.com", adminKey, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	c.login("target@example.com", testPassword)
+
+	// A successful login starts the count over.
+	for i := 0; i < 2; i++ {
+		expectStatus(t, login("target@example.com", "guess"), http.StatusUnauthorized)
+	}
+	c.login("target@example.com", testPassword)
+	expectStatus(t, login("target@example.com", "guess"), http.StatusUnauthorized)
+	c.login("target@example.com", testPassword)
+
+	// Failures from one address add up across every email it tries.
+	c.cfg.LoginIPMaxFailures = 7
+	expectStatus(t, login("someone@example.com", "guess"), http.StatusUnauthorized)
+	expectStatus(t, login("target@example.com", testPassword), http.StatusTooManyRequests)
+	rec = c.do("DELETE", "/admin/lockouts/ip/192.0.2.1", adminKey, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+	c.login("target@example.com", testPassword)
+}
+
+func TestLoginLockoutSharedAddress(t *testing.T) {
+	c := newTestClient(t)
+	c.cfg.LoginIPMaxFailures = 3
+	const adminKey = "admin-key"
+	c.cfg.AdminAPIKey = adminKey
+	c.signup("walt@example.com", testPassword)
+	c.signup("jesse@example.com", testPassword)
+	login := func(forwardedFor, email, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.UserRequest{Email: email, Password: password})
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewReader(body))
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		c.mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Typos from everyone behind one address do not add up to a lockout
+	// as long as they go on to log in.
+	for i := 0; i < 4; i++ {
+		for _, email := range []string{"walt@example.com", "jesse@example.com"} {
+			expectStatus(t, login("", email, "guess"), http.StatusUnauthorized)
+			expectStatus(t, login("", email, testPassword), http.StatusOK)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		expectStatus(t, login("", "nobody@example.com", "guess"), http.StatusUnauthorized)
+	}
+	expectStatus(t, login("", "walt@example.com", testPassword), http.StatusTooManyRequests)
+
+	// Behind a trusted proxy each client gets its own count, and entries
+	// the client could have written itself are ignored.
+	c.cfg.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("10.0.0.0/8")}
+	for i := 0; i < 3; i++ {
+		expectStatus(t, login("198.51.100.7, 10.0.0.2", "stranger@example.com", "guess"), http.StatusUnauthorized)
+	}
+	expectStatus(t, login("198.51.100.8, 198.51.100.7", "walt@example.com", testPassword), http.StatusTooManyRequests)
+	expectStatus(t, login("198.51.100.8", "walt@example.com", testPassword), http.StatusOK)
+	rec := c.do("GET", "/admin/lockouts", adminKey, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var subjects []string
+	for _, lockout := range decode[[]models.LoginLockoutResponse](t, rec) {
+		if lockout.Scope == models.LoginScopeIP {
+			subjects = append(subjects, lockout.Subject)
+		}
+	}
+	slices.Sort(subjects)
+	if !slices.Equal(subjects, []string{"192.0.2.1", "198.51.100.7"}) {
+		t.Errorf("expected the proxy and the client behind it to be locked out, got %v", subjects)
+	}
+
+	// The header means nothing from anyone else.
+	c.cfg.TrustedProxies = nil
+	expectStatus(t, login("198.51.100.8", "walt@example.com", testPassword), http.StatusTooManyRequests)
+}
+
+func TestLoginLockoutParallelGuesses(t *testing.T) {
+	c := newTestClient(t)
+	c.cfg.LoginMaxFailures = 3
+	c.signup("target@example.com", testPassword)
+
+	// Each guess is counted before its password is checked, so guesses
+	// sent all at once get no more tries than guesses sent in turn.
+	codes := make([]int, 10)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = c.do("POST", "/api/login", "", models.UserRequest{Email: "target@example.com", Password: "guess"}).Code
+		}()
+	}
+	wg.Wait()
+	checked := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("expected 401 or 429, got %d", code)
+		}
+	}
+	if checked != 3 {
+		t.Errorf("expected 3 guesses to be checked, got %d", checked)
+	}
+}
+
+func TestTOTPCodeLockout(t *testing.T) {
+	c := newTestClient(t)
+	c.cfg.LoginMaxFailures = 2
+	c.signup("guarded@example.com", testPassword)
+	bearer := "Bearer " + c.login("guarded@example.com", testPassword).Token
+
+	rec := c.do("POST", "/api/mfa/totp/enroll", bearer, nil)
+	expectStatus(t, rec, http.StatusOK)
+	secret := decode[models.TOTPEnrollmentResponse](t, rec).Secret
+	current, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := current[:5] + string('0'+(current[5]-'0'+1)%10)
+	unlock := func() {
+		t.Helper()
+		if err := c.cfg.Store.ClearLoginAttempts(context.Background(), models.LoginScopeAccount, "guarded@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Wrong codes lock the account out, so a stolen access token cannot
+	// be used to guess its way through.
+	for range 2 {
+		expectStatus(t, c.do("POST", "/api/mfa/totp/confirm", bearer, models.MFACodeRequest{Code: wrong}), http.StatusBadRequest)
+	}
+	expectStatus(t, c.do("POST", "/api/mfa/totp/confirm", bearer, models.MFACodeRequest{Code: current}), http.StatusTooManyRequests)
+	unlock()
+	rec = c.do("POST", "/api/mfa/totp/confirm", bearer, models.MFACodeRequest{Code: current})
+	expectStatus(t, rec, http.StatusOK)
+	recoveryCodes := decode[models.RecoveryCodesResponse](t, rec).RecoveryCodes
+
+	for range 2 {
+		expectStatus(t, c.do("DELETE", "/api/mfa/totp", bearer, models.MFACodeRequest{Code: wrong}), http.StatusForbidden)
+	}
+	expectStatus(t, c.do("DELETE", "/api/mfa/totp", bearer, models.MFACodeRequest{Code: recoveryCodes[0]}), http.StatusTooManyRequests)
+	unlock()
+	expectStatus(t, c.do("DELETE", "/api/mfa/totp", bearer, models.MFACodeRequest{Code: recoveryCodes[0]}), http.StatusNoContent)
+}
+
+func TestReset(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("gone@example.com", testPassword)
+
+	rec := c.do("POST", "/admin/reset", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = c.do("POST", "/api/login", "", models.UserRequest{Email: "gone@example.com", Password: testPassword})
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestJWKSWithSharedSecret(t *testing.T) {
+	c := newTestClient(t)
+
+	rec := c.do("GET", "/.well-known/jwks.json", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if jwks := decode[auth.JWKS](t, rec); len(jwks.Keys) != 0 {
+		t.Errorf("expected HMAC secret to stay unpublished, got %+v", jwks.Keys)
+	}
+}
+
+func TestAccessTokenRejections(t *testing.T) {
+	c := newTestClient(t)
+	user := c.signup("strict@example.com", testPassword)
+
+	otherAudience := c.cfg.JWTPolicy
+	otherAudience.Audience = "another-service"
+
+	tests := []struct {
+		name     string
+		policy   auth.TokenPolicy
+		ttl      time.Duration
+		expected string
+	}{
+		{"expired", c.cfg.JWTPolicy, -time.Hour, "token has expired"},
+		{"wrong audience", otherAudience, time.Hour, "token is not intended for this audience"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := auth.MakeJWT(user.ID, c.cfg.JWTKeys, tt.policy, tt.ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := c.do("POST", "/api/chirps", "Bearer "+token, models.ChirpRequest{UserId: user.ID, Body: "hello"})
+			expectStatus(t, rec, http.StatusUnauthorized)
+			if !strings.Contains(rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+				t.Errorf("expected WWW-Authenticate challenge, got %q", rec.Header().Get("WWW-Authenticate"))
+			}
+			if errResp := decode[models.ErrorResponse](t, rec); errResp.Error != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, errResp.Error)
+			}
+		})
+	}
+}
+
+func TestCreateChirpUserID(t *testing.T) {
+	c := newTestClient(t)
+	author := c.signup("me@example.com", testPassword)
+	authorLogin := c.login("me@example.com", testPassword)
+	other := c.signup("them@example.com", testPassword)
+
+	rec := c.do("POST", "/api/chirps", "Bearer "+authorLogin.Token, models.ChirpRequest{Body: "no user_id"})
+	expectStatus(t, rec, http.StatusCreated)
+	if chirp := decode[models.ChirpResponse](t, rec); chirp.UserId != author.ID {
+		t.Errorf("expected chirp to be authored by %s, got %s", author.ID, chirp.UserId)
+	}
+
+	rec = c.do("POST", "/api/chirps", "Bearer "+authorLogin.Token, models.ChirpRequest{UserId: other.ID, Body: "impersonation"})
+	expectStatus(t, rec, http.StatusForbidden)
+}
+
+func TestChirpLengthLimit(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("plain@example.com", testPassword)
+	plainLogin := c.login("plain@example.com", testPassword)
+	red := c.signup("red@example.com", testPassword)
+	event := models.WebhookRequest{Event: "user.upgraded"}
+	event.Data.UserID = red.ID
+	expectStatus(t, c.do("POST", "/api/polka/webhooks", testPolkaKey, event), http.StatusNoContent)
+	redLogin := c.login("red@example.com", testPassword)
+
+	emoji := strings.Repeat("🇻🇳", 140)
+	rec := c.do("POST", "/api/chirps", "Bearer "+plainLogin.Token, models.ChirpRequest{Body: emoji})
+	expectStatus(t, rec, http.StatusCreated)
+
+	long := strings.Repeat("a", 200)
+	rec = c.do("POST", "/api/chirps", "Bearer "+plainLogin.Token, models.ChirpRequest{Body: long})
+	expectStatus(t, rec, http.StatusBadRequest)
+	if got := decode[models.ErrorResponse](t, rec); got.Error != "chirp is 60 characters over the 140-character limit" {
+		t.Errorf("unexpected error %q", got.Error)
+	}
+
+	rec = c.do("POST", "/api/chirps", "Bearer "+redLogin.Token, models.ChirpRequest{Body: long})
+	expectStatus(t, rec, http.StatusCreated)
+	chirp := decode[models.ChirpResponse](t, rec)
+
+	rec = c.do("PUT", "/api/chirps/"+chirp.Id, "Bearer "+redLogin.Token, models.ChirpEditRequest{Body: strings.Repeat("a", 281)})
+	expectStatus(t, rec, http.StatusBadRequest)
+	if got := decode[models.ErrorResponse](t, rec); got.Error != "chirp is 1 character over the 280-character limit" {
+		t.Errorf("unexpected error %q", got.Error)
+	}
+}
+
+func TestListChirpsPagination(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("pager@example.com", testPassword)
+	loggedIn := c.login("pager@example.com", testPassword)
+
+	var created []string
+	for i := 0; i < 5; i++ {
+		rec := c.do("POST", "/api/chirps", "Bearer "+loggedIn.Token, models.ChirpRequest{Body: "chirp"})
+		expectStatus(t, rec, http.StatusCreated)
+		created = append(created, decode[models.ChirpResponse](t, rec).Id)
+	}
+
+	var got []string
+	path := "/api/chirps?sort=desc&limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("expected 3 pages at most")
+		}
+		rec := c.do("GET", path, "", nil)
+		expectStatus(t, rec, http.StatusOK)
+		for _, chirp := range decode[[]models.ChirpResponse](t, rec) {
+			got = append(got, chirp.Id)
+		}
+		path = ""
+		if link := rec.Header().Get("Link"); link != "" {
+			path = strings.TrimPrefix(strings.TrimSuffix(link, `>; rel="next"`), "<")
+		}
+	}
+
+	if len(got) != len(created) {
+		t.Fatalf("expected %d chirps across pages, got %v", len(created), got)
+	}
+	for i := range got {
+		if got[i] != created[len(created)-1-i] {
+			t.Fatalf("expected newest first %v, got %v", created, got)
+		}
+	}
+
+	rec := c.do("GET", "/api/chirps?cursor=not-a-cursor", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// Without a limit a page holds 50 chirps, and the Link header leads on.
+	for i := len(created); i < 51; i++ {
+		rec := c.do("POST", "/api/chirps", "Bearer "+loggedIn.Token, models.ChirpRequest{Body: "chirp"})
+		expectStatus(t, rec, http.StatusCreated)
+	}
+	rec = c.do("GET", "/api/chirps", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if page := decode[[]models.ChirpResponse](t, rec); len(page) != 50 {
+		t.Errorf("expected a default page of 50 chirps, got %d", len(page))
+	}
+	link := rec.Header().Get("Link")
+	if !strings.HasPrefix(link, "</api/chirps?") || !strings.HasSuffix(link, `>; rel="next"`) || !strings.Contains(link, "limit=50") {
+		t.Errorf("expected a Link header to the next page, got %q", link)
+	}
+}
+
+func TestSearchChirps(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("searcher@example.com", testPassword)
+	loggedIn := c.login("searcher@example.com", testPassword)
+	for _, body := range []string{"Good morning, world", "Morning coffee", "Evening tea"} {
+		rec := c.do("POST", "/api/chirps", "Bearer "+loggedIn.Token, models.ChirpRequest{Body: body})
+		expectStatus(t, rec, http.StatusCreated)
+	}
+
+	rec := c.do("GET", "/api/chirps/search?q=%22good+morning%22", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	results := decode[[]models.ChirpSearchResult](t, rec)
+	if len(results) != 1 || results[0].Body != "Good morning, world" {
+		t.Fatalf("expected the phrase match only, got %+v", results)
+	}
+	if results[0].Highlighted != "<mark>Good</mark> <mark>morning</mark>, world" {
+		t.Errorf("unexpected highlight %q", results[0].Highlighted)
+	}
+
+	rec = c.do("GET", "/api/chirps/search?q=morn*", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if results := decode[[]models.ChirpSearchResult](t, rec); len(results) != 2 {
+		t.Errorf("expected 2 prefix matches, got %d", len(results))
+	}
+
+	rec = c.do("GET", "/api/chirps/search?q=", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestEditChirp(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("editor@example.com", testPassword)
+	editor := c.login("editor@example.com", testPassword)
+	c.signup("bystander@example.com", testPassword)
+	bystander := c.login("bystander@example.com", testPassword)
+
+	rec := c.do("POST", "/api/chirps", "Bearer "+editor.Token, models.ChirpRequest{Body: "helo world"})
+	expectStatus(t, rec, http.StatusCreated)
+	chirp := decode[models.ChirpResponse](t, rec)
+	if chirp.Edited {
+		t.Error("expected a new chirp not to be marked edited")
+	}
+
+	rec = c.do("PUT", "/api/chirps/"+chirp.Id, "Bearer "+bystander.Token, models.ChirpEditRequest{Body: "hijacked"})
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = c.do("PUT", "/api/chirps/"+chirp.Id, "Bearer "+editor.Token, models.ChirpEditRequest{Body: "hello world"})
+	expectStatus(t, rec, http.StatusOK)
+	if edited := decode[models.ChirpResponse](t, rec); edited.Body != "hello world" || !edited.Edited {
+		t.Errorf("expected edited chirp, got %+v", edited)
+	}
+
+	rec = c.do("GET", "/api/chirps/"+chirp.Id+"/revisions", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if revisions := decode[[]models.ChirpRevisionResponse](t, rec); len(revisions) != 1 || revisions[0].Body != "helo world" {
+		t.Errorf("expected the original body as the only revision, got %+v", revisions)
+	}
+
+	c.cfg.ChirpEditWindow = time.Nanosecond
+	rec = c.do("PUT", "/api/chirps/"+chirp.Id, "Bearer "+editor.Token, models.ChirpEditRequest{Body: "too late"})
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = c.do("GET", "/api/chirps/999/revisions", "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestChirpThread(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("threads@example.com", testPassword)
+	auth := "Bearer " + c.login("threads@example.com", testPassword).Token
+
+	post := func(body, inReplyTo string) models.ChirpResponse {
+		rec := c.do("POST", "/api/chirps", auth, models.ChirpRequest{Body: body, InReplyToId: inReplyTo})
+		expectStatus(t, rec, http.StatusCreated)
+		return decode[models.ChirpResponse](t, rec)
+	}
+	root := post("root", "")
+	first := post("first", root.Id)
+	second := post("second", root.Id)
+	nested := post("nested", first.Id)
+	deep := post("deep", nested.Id)
+	if nested.ConversationId != root.Id || nested.InReplyToId != first.Id {
+		t.Errorf("expected reply to join root's conversation, got %+v", nested)
+	}
+
+	rec := c.do("POST", "/api/chirps", auth, models.ChirpRequest{Body: "orphan", InReplyToId: "999"})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = c.do("GET", "/api/chirps/"+root.Id, "", nil)
+	if got := decode[models.ChirpResponse](t, rec); got.ReplyCount != 2 {
+		t.Errorf("expected reply_count 2, got %d", got.ReplyCount)
+	}
+
+	rec = c.do("GET", "/api/chirps/"+root.Id+"/thread?depth=2&limit=1", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	thread := decode[models.ThreadResponse](t, rec)
+	if len(thread.Ancestors) != 0 || len(thread.Chirp.Replies) != 1 || thread.NextCursor == "" {
+		t.Fatalf("expected one reply and a next cursor, got %+v", thread)
+	}
+	reply := thread.Chirp.Replies[0]
+	if reply.Id != first.Id || len(reply.Replies) != 1 || reply.Replies[0].Id != nested.Id || !reply.Replies[0].MoreReplies {
+		t.Errorf("expected first -> nested cut off at depth 2, got %+v", reply)
+	}
+
+	secondPage := "/api/chirps/" + root.Id + "/thread?limit=1&cursor=" + thread.NextCursor
+	rec = c.do("GET", secondPage+"&depth=2", "", nil)
+	thread = decode[models.ThreadResponse](t, rec)
+	if len(thread.Chirp.Replies) != 1 || thread.Chirp.Replies[0].Id != second.Id || thread.NextCursor != "" {
+		t.Errorf("expected second reply on the last page, got %+v", thread)
+	}
+
+	rec = c.do("GET", "/api/chirps/"+deep.Id+"/thread", "", nil)
+	thread = decode[models.ThreadResponse](t, rec)
+	var ancestors []string
+	for _, a := range thread.Ancestors {
+		ancestors = append(ancestors, a.Body)
+	}
+	if strings.Join(ancestors, ",") != "root,first,nested" {
+		t.Errorf("expected ancestors root,first,nested, got %v", ancestors)
+	}
+
+	// Below the first level each chirp shows a capped number of replies.
+	for i := range 11 {
+		post("busy "+strconv.Itoa(i), second.Id)
+	}
+	rec = c.do("GET", secondPage, "", nil)
+	thread = decode[models.ThreadResponse](t, rec)
+	if len(thread.Chirp.Replies) != 1 {
+		t.Fatalf("expected only second after the cursor, got %+v", thread)
+	}
+	if busy := thread.Chirp.Replies[0]; len(busy.Replies) != 10 || !busy.MoreReplies {
+		t.Errorf("expected 10 of 11 nested replies and more_replies, got %d (more_replies %v)", len(busy.Replies), busy.MoreReplies)
+	}
+
+	for _, query := range []string{"depth=0", "limit=x", "cursor=bogus"} {
+		rec = c.do("GET", "/api/chirps/"+root.Id+"/thread?"+query, "", nil)
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+	rec = c.do("GET", "/api/chirps/999/thread", "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestChirpLikes(t *testing.T) {
+	c := newTestClient(t)
+	author := c.signup("author@example.com", testPassword)
+	authorAuth := "Bearer " + c.login("author@example.com", testPassword).Token
+	fan := c.signup("fan@example.com", testPassword)
+	fanAuth := "Bearer " + c.login("fan@example.com", testPassword).Token
+
+	rec := c.do("POST", "/api/chirps", authorAuth, models.ChirpRequest{Body: "like me"})
+	expectStatus(t, rec, http.StatusCreated)
+	chirp := decode[models.ChirpResponse](t, rec)
+
+	rec = c.do("POST", "/api/chirps/"+chirp.Id+"/likes", "", nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	for range 2 {
+		rec = c.do("POST", "/api/chirps/"+chirp.Id+"/likes", fanAuth, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if liked := decode[models.ChirpResponse](t, rec); liked.LikeCount != 1 || !liked.LikedByMe {
+			t.Errorf("expected one like by the caller, got %+v", liked)
+		}
+	}
+	rec = c.do("POST", "/api/chirps/999/likes", fanAuth, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	tests := []struct {
+		name          string
+		authorization string
+		likedByMe     bool
+	}{
+		{"anonymous", "", false},
+		{"fan", fanAuth, true},
+		{"author", authorAuth, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := c.do("GET", "/api/chirps/"+chirp.Id, tt.authorization, nil)
+			expectStatus(t, rec, http.StatusOK)
+			if got := decode[models.ChirpResponse](t, rec); got.LikeCount != 1 || got.LikedByMe != tt.likedByMe {
+				t.Errorf("expected like_count 1 and liked_by_me %v, got %+v", tt.likedByMe, got)
+			}
+		})
+	}
+
+	rec = c.do("GET", "/api/chirps", "Bearer nope", nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = c.do("GET", "/api/users/"+fan.ID+"/likes", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if likes := decode[[]models.LikedChirpResponse](t, rec); len(likes) != 1 || likes[0].Id != chirp.Id || likes[0].LikedAt == "" {
+		t.Errorf("expected the fan's like, got %+v", likes)
+	}
+	rec = c.do("GET", "/api/users/"+author.ID+"/likes", "", nil)
+	if likes := decode[[]models.LikedChirpResponse](t, rec); len(likes) != 0 {
+		t.Errorf("expected no likes for the author, got %+v", likes)
+	}
+	rec = c.do("GET", "/api/users/999/likes", "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	for range 2 {
+		rec = c.do("DELETE", "/api/chirps/"+chirp.Id+"/likes", fanAuth, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if unliked := decode[models.ChirpResponse](t, rec); unliked.LikeCount != 0 || unliked.LikedByMe {
+			t.Errorf("expected no likes after unliking, got %+v", unliked)
+		}
+	}
+}
+
+func TestRechirpsAndQuotes(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("author@example.com", testPassword)
+	authorAuth := "Bearer " + c.login("author@example.com", testPassword).Token
+	c.signup("sharer@example.com", testPassword)
+	sharerAuth := "Bearer " + c.login("sharer@example.com", testPassword).Token
+
+	rec := c.do("POST", "/api/chirps", authorAuth, models.ChirpRequest{Body: "share me"})
+	expectStatus(t, rec, http.StatusCreated)
+	original := decode[models.ChirpResponse](t, rec)
+
+	rec = c.do("POST", "/api/chirps/"+original.Id+"/rechirps", sharerAuth, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	rechirp := decode[models.ChirpResponse](t, rec)
+	if rechirp.RechirpOfId != original.Id || rechirp.Original == nil || rechirp.Original.Body != "share me" {
+		t.Errorf("expected rechirp embedding the original, got %+v", rechirp)
+	}
+
+	rec = c.do("POST", "/api/chirps/"+original.Id+"/rechirps", sharerAuth, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if again := decode[models.ChirpResponse](t, rec); again.Id != rechirp.Id {
+		t.Errorf("expected rechirping twice to return rechirp %s, got %s", rechirp.Id, again.Id)
+	}
+
+	// Quoting a rechirp quotes what it reposted.
+	rec = c.do("POST", "/api/chirps", sharerAuth, models.ChirpRequest{Body: "so true", QuoteOfId: rechirp.Id})
+	expectStatus(t, rec, http.StatusCreated)
+	quote := decode[models.ChirpResponse](t, rec)
+	if quote.QuoteOfId != original.Id || quote.Original == nil || quote.Original.Id != original.Id {
+		t.Errorf("expected quote of the original, got %+v", quote)
+	}
+
+	rec = c.do("POST", "/api/chirps", sharerAuth, models.ChirpRequest{Body: "quoting nothing", QuoteOfId: "999"})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = c.do("PUT", "/api/chirps/"+rechirp.Id, sharerAuth, models.ChirpEditRequest{Body: "sneaky"})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = c.do("GET", "/api/chirps/"+original.Id, "", nil)
+	if got := decode[models.ChirpResponse](t, rec); got.ShareCount != 2 {
+		t.Errorf("expected share_count 2, got %d", got.ShareCount)
+	}
+
+	rec = c.do("DELETE", "/api/chirps/"+original.Id+"/rechirps", sharerAuth, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = c.do("GET", "/api/chirps/"+rechirp.Id, "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = c.do("DELETE", "/api/chirps/"+original.Id, authorAuth, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = c.do("GET", "/api/chirps/"+quote.Id, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[models.ChirpResponse](t, rec); got.Original != nil || !got.OriginalDeleted || got.Body != "so true" {
+		t.Errorf("expected quote to survive its original's deletion, got %+v", got)
+	}
+
+	rec = c.do("POST", "/api/chirps/"+original.Id+"/rechirps", sharerAuth, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestTimelineFanoutCap(t *testing.T) {
+	c := newTestClient(t)
+	c.cfg.TimelineFanout = config.FanoutOnWrite
+	c.cfg.TimelineFanoutMaxFollowers = 1
+	writer := c.signup("writer@example.com", testPassword)
+	writerAuth := "Bearer " + c.login("writer@example.com", testPassword).Token
+	c.signup("reader@example.com", testPassword)
+	readerAuth := "Bearer " + c.login("reader@example.com", testPassword).Token
+	c.signup("fan@example.com", testPassword)
+	fanAuth := "Bearer " + c.login("fan@example.com", testPassword).Token
+	for _, authorization := range []string{readerAuth, fanAuth} {
+		rec := c.do("POST", "/api/users/"+writer.ID+"/follow", authorization, nil)
+		expectStatus(t, rec, http.StatusNoContent)
+	}
+	timeline := func() []models.ChirpResponse {
+		rec := c.do("GET", "/api/timeline", readerAuth, nil)
+		expectStatus(t, rec, http.StatusOK)
+		return decode[[]models.ChirpResponse](t, rec)
+	}
+
+	rec := c.do("POST", "/api/chirps", writerAuth, models.ChirpRequest{Body: "over the cap"})
+	expectStatus(t, rec, http.StatusCreated)
+	if got := timeline(); len(got) != 1 || got[0].Body != "over the cap" {
+		t.Fatalf("expected the chirp merged in on read, got %+v", got)
+	}
+
+	// Losing a follower brings the writer back to the cap; the chirp must
+	// not drop out of the reader's timeline now it is no longer merged in.
+	for range 2 {
+		rec = c.do("DELETE", "/api/users/"+writer.ID+"/follow", fanAuth, nil)
+		expectStatus(t, rec, http.StatusNoContent)
+	}
+	if got := timeline(); len(got) != 1 || got[0].Body != "over the cap" {
+		t.Errorf("expected the chirp to stay in the timeline, got %+v", got)
+	}
+}
+
+func TestFollowsAndTimeline(t *testing.T) {
+	for _, fanout := range []string{config.FanoutOnRead, config.FanoutOnWrite} {
+		t.Run(fanout, func(t *testing.T) {
+			c := newTestClient(t)
+			c.cfg.TimelineFanout = fanout
+			reader := c.signup("reader@example.com", testPassword)
+			readerAuth := "Bearer " + c.login("reader@example.com", testPassword).Token
+			writer := c.signup("writer@example.com", testPassword)
+			writerAuth := "Bearer " + c.login("writer@example.com", testPassword).Token
+			c.signup("stranger@example.com", testPassword)
+			strangerAuth := "Bearer " + c.login("stranger@example.com", testPassword).Token
+
+			post := func(authorization, body string) {
+				rec := c.do("POST", "/api/chirps", authorization, models.ChirpRequest{Body: body})
+				expectStatus(t, rec, http.StatusCreated)
+			}
+			timeline := func() string {
+				rec := c.do("GET", "/api/timeline", readerAuth, nil)
+				expectStatus(t, rec, http.StatusOK)
+				var bodies []string
+				for _, chirp := range decode[[]models.ChirpResponse](t, rec) {
+					bodies = append(bodies, chirp.Body)
+				}
+				return strings.Join(bodies, ",")
+			}
+
+			post(writerAuth, "before follow")
+			for range 2 {
+				rec := c.do("POST", "/api/users/"+writer.ID+"/follow", readerAuth, nil)
+				expectStatus(t, rec, http.StatusNoContent)
+			}
+			rec := c.do("POST", "/api/users/"+reader.ID+"/follow", readerAuth, nil)
+			expectStatus(t, rec, http.StatusBadRequest)
+			rec = c.do("POST", "/api/users/999/follow", readerAuth, nil)
+			expectStatus(t, rec, http.StatusNotFound)
+
+			post(readerAuth, "mine")
+			post(writerAuth, "after follow")
+			post(strangerAuth, "unfollowed")
+
+			if got := timeline(); got != "after follow,mine,before follow" {
+				t.Errorf("expected own and followed chirps newest first, got %q", got)
+			}
+
+			rec = c.do("GET", "/api/users/"+writer.ID+"/followers", "", nil)
+			expectStatus(t, rec, http.StatusOK)
+			if followers := decode[[]models.FollowResponse](t, rec); len(followers) != 1 || followers[0].UserId != reader.ID {
+				t.Errorf("expected the reader as the only follower, got %+v", followers)
+			}
+			rec = c.do("GET", "/api/users/"+reader.ID+"/following", "", nil)
+			if following := decode[[]models.FollowResponse](t, rec); len(following) != 1 || following[0].UserId != writer.ID {
+				t.Errorf("expected the reader to follow the writer, got %+v", following)
+			}
+
+			rec = c.do("GET", "/api/timeline?limit=2", readerAuth, nil)
+			expectStatus(t, rec, http.StatusOK)
+			if next := rec.Header().Get("X-Next-Cursor"); next == "" {
+				t.Error("expected a next cursor on a full page")
+			}
+
+			rec = c.do("DELETE", "/api/users/"+writer.ID+"/follow", readerAuth, nil)
+			expectStatus(t, rec, http.StatusNoContent)
+			if got := timeline(); got != "mine" {
+				t.Errorf("expected only own chirps after unfollowing, got %q", got)
+			}
+
+			rec = c.do("GET", "/api/timeline", "", nil)
+			expectStatus(t, rec, http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestHashtagsAndMentions(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("tagger@example.com", testPassword)
+	auth := "Bearer " + c.login("tagger@example.com", testPassword).Token
+
+	rec := c.do("POST", "/api/chirps", auth, models.ChirpRequest{Body: "Café #Go with @bob"})
+	expectStatus(t, rec, http.StatusCreated)
+	chirp := decode[models.ChirpResponse](t, rec)
+	expected := models.ChirpEntities{
+		Hashtags: []models.HashtagEntity{{Tag: "go", Start: 5, End: 8}},
+		Mentions: []models.MentionEntity{{Username: "bob", Start: 14, End: 18}},
+	}
+	if !reflect.DeepEqual(chirp.Entities, expected) {
+		t.Errorf("expected entities %+v, got %+v", expected, chirp.Entities)
+	}
+
+	rec = c.do("POST", "/api/chirps", auth, models.ChirpRequest{Body: "more #go and #rust"})
+	expectStatus(t, rec, http.StatusCreated)
+	rec = c.do("POST", "/api/chirps/"+chirp.Id+"/rechirps", auth, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	if rechirp := decode[models.ChirpResponse](t, rec); len(rechirp.Entities.Hashtags) != 0 || rechirp.Original == nil || len(rechirp.Original.Entities.Hashtags) != 1 {
+		t.Errorf("expected the original's entities embedded in the rechirp, got %+v", rechirp)
+	}
+
+	rec = c.do("GET", "/api/hashtags/GO/chirps?limit=1", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if chirps := decode[[]models.ChirpResponse](t, rec); len(chirps) != 1 || chirps[0].Body != "more #go and #rust" {
+		t.Errorf("expected the newest go chirp, got %+v", chirps)
+	}
+	if rec.Header().Get("X-Next-Cursor") == "" {
+		t.Error("expected a next cursor on a full page")
+	}
+	rec = c.do("GET", "/api/hashtags/not%20a%20tag/chirps", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = c.do("GET", "/api/hashtags/trending", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	trending := decode[[]models.TrendingHashtagResponse](t, rec)
+	if len(trending) != 2 || trending[0] != (models.TrendingHashtagResponse{Tag: "go", ChirpCount: 2}) {
+		t.Errorf("expected go to trend above rust, got %+v", trending)
+	}
+
+	c.cfg.TrendingWindow = time.Nanosecond
+	rec = c.do("GET", "/api/hashtags/trending", "", nil)
+	if trending := decode[[]models.TrendingHashtagResponse](t, rec); len(trending) != 0 {
+		t.Errorf("expected nothing trending in an empty window, got %+v", trending)
+	}
+}
+
+func TestProfanityFilter(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("potty@example.com", testPassword)
+	auth := "Bearer " + c.login("potty@example.com", testPassword).Token
+	const adminKey = "admin-key"
+
+	rec := c.do("GET", "/admin/profanity", adminKey, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+	c.cfg.AdminAPIKey = adminKey
+	rec = c.do("GET", "/admin/profanity", "wrong-key", nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = c.do("POST", "/api/chirps", auth, models.ChirpRequest{Body: "What a  Kerfuffle!\nReally."})
+	expectStatus(t, rec, http.StatusCreated)
+	if chirp := decode[models.ChirpResponse](t, rec); chirp.Body != "What a  ****!\nReally." {
+		t.Errorf("expected the word masked and spacing kept, got %q", chirp.Body)
+	}
+
+	rec = c.do("PUT", "/admin/profanity/Fornax", adminKey, models.ProfanityWordRequest{Action: "reject"})
+	expectStatus(t, rec, http.StatusOK)
+	rec = c.do("PUT", "/admin/profanity/gloop", adminKey, models.ProfanityWordRequest{Action: "flag"})
+	expectStatus(t, rec, http.StatusOK)
+	rec = c.do("PUT", "/admin/profanity/gloop", adminKey, models.ProfanityWordRequest{Action: "shout"})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = c.do("DELETE", "/admin/profanity/sharbert", adminKey, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	rec = c.do("GET", "/admin/profanity", adminKey, nil)
+	expectStatus(t, rec, http.StatusOK)
+	expected := []models.ProfanityWordResponse{
+		{Word: "fornax", Action: "reject"},
+		{Word: "gloop", Action: "flag"},
+		{Word: "kerfuffle", Action: "mask"},
+	}
+	if got := decode[[]models.ProfanityWordResponse](t, rec); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if words, err := c.cfg.Store.ListProfanityWords(t.Context()); err != nil || len(words) != 2 {
+		t.Errorf("expected the two added words to be stored, got %+v, %v", words, err)
+	}
+
+	rec = c.do("POST", "/api/chirps", auth, models.ChirpRequest{Body: "fornax."})
+	expectStatus(t, rec, http.StatusBadRequest)
+	if got := decode[models.ErrorResponse](t, rec); got.Error != "chirp contains words that are not allowed: fornax" {
+		t.Errorf("expected the rejected word named, got %q", got.Error)
+	}
+
+	rec = c.do("POST", "/api/chirps", auth, models.ChirpRequest{Body: "sharbert"})
+	expectStatus(t, rec, http.StatusCreated)
+	if chirp := decode[models.ChirpResponse](t, rec); chirp.Body != "sharbert" {
+		t.Errorf("expected a removed word to pass, got %q", chirp.Body)
+	}
+
+	rec = c.do("POST", "/api/chirps", auth, models.ChirpRequest{Body: "gloop"})
+	expectStatus(t, rec, http.StatusCreated)
+	flagged := decode[models.ChirpResponse](t, rec)
+	rec = c.do("GET", "/admin/chirps/flagged", adminKey, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if chirps := decode[[]models.ChirpResponse](t, rec); len(chirps) != 1 || chirps[0].Id != flagged.Id {
+		t.Errorf("expected the flagged chirp in the review queue, got %+v", chirps)
+	}
+
+	rec = c.do("POST", "/admin/chirps/"+flagged.Id+"/review", adminKey, models.ChirpReviewRequest{Decision: "maybe"})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = c.do("POST", "/admin/chirps/"+flagged.Id+"/review", adminKey, models.ChirpReviewRequest{Decision: "approve"})
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = c.do("GET", "/admin/chirps/flagged", adminKey, nil)
+	if chirps := decode[[]models.ChirpResponse](t, rec); len(chirps) != 0 {
+		t.Errorf("expected an empty queue after approval, got %+v", chirps)
+	}
+
+	rec = c.do("PUT", "/api/chirps/"+flagged.Id, auth, models.ChirpEditRequest{Body: "gloop again"})
+	expectStatus(t, rec, http.StatusOK)
+	rec = c.do("GET", "/admin/chirps/flagged", adminKey, nil)
+	if chirps := decode[[]models.ChirpResponse](t, rec); len(chirps) != 1 {
+		t.Errorf("expected an edit using a flagged word to flag the chirp again, got %+v", chirps)
+	}
+	rec = c.do("POST", "/admin/chirps/"+flagged.Id+"/review", adminKey, models.ChirpReviewRequest{Decision: "remove"})
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = c.do("GET", "/api/chirps/"+flagged.Id, "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
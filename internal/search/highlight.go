@@ -0,0 +1,25 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+// Highlight returns text as HTML with every word that matches q wrapped in
+// <mark>. Everything else is escaped, so the result is safe to render.
+func Highlight(text string, q Query) string {
+	var b strings.Builder
+	last := 0
+	for _, t := range Tokenize(text) {
+		if !q.matches(t.Text) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:t.Start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[t.Start:t.End]))
+		b.WriteString("</mark>")
+		last = t.End
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
@@ -0,0 +1,192 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BM25 parameters; the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Hit is a matching document and its relevance; higher scores rank first.
+type Hit struct {
+	ID    uint
+	Score float64
+}
+
+// Index is an in-memory inverted index from words to the positions they
+// occupy in each document. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	lengths  map[uint]int
+	postings map[string]map[uint][]int
+	total    int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		lengths:  make(map[uint]int),
+		postings: make(map[string]map[uint][]int),
+	}
+}
+
+// Add indexes text under id, replacing anything previously indexed for it.
+func (ix *Index) Add(id uint, text string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+	ws := words(text)
+	for pos, w := range ws {
+		docs, ok := ix.postings[w]
+		if !ok {
+			docs = make(map[uint][]int)
+			ix.postings[w] = docs
+		}
+		docs[id] = append(docs[id], pos)
+	}
+	ix.lengths[id] = len(ws)
+	ix.total += len(ws)
+}
+
+func (ix *Index) Remove(id uint) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id uint) {
+	length, ok := ix.lengths[id]
+	if !ok {
+		return
+	}
+	for w, docs := range ix.postings {
+		if _, ok := docs[id]; !ok {
+			continue
+		}
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(ix.postings, w)
+		}
+	}
+	delete(ix.lengths, id)
+	ix.total -= length
+}
+
+// Reset empties the index.
+func (ix *Index) Reset() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.lengths = make(map[uint]int)
+	ix.postings = make(map[string]map[uint][]int)
+	ix.total = 0
+}
+
+// Search returns every document matching q, best first. Ties are broken by
+// newest (highest) id.
+func (ix *Index) Search(q Query) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	if q.Empty() || len(ix.lengths) == 0 {
+		return nil
+	}
+
+	// Each clause narrows the candidates and contributes the words that are
+	// scored for the documents that survive.
+	var candidates map[uint]bool
+	var scored []string
+	narrow := func(docs map[uint]bool) {
+		if candidates == nil {
+			candidates = docs
+			return
+		}
+		for id := range candidates {
+			if !docs[id] {
+				delete(candidates, id)
+			}
+		}
+	}
+
+	for _, t := range q.Terms {
+		narrow(keys(ix.postings[t]))
+		scored = append(scored, t)
+	}
+	for _, p := range q.Prefixes {
+		docs := make(map[uint]bool)
+		for w, postings := range ix.postings {
+			if strings.HasPrefix(w, p) {
+				for id := range postings {
+					docs[id] = true
+				}
+				scored = append(scored, w)
+			}
+		}
+		narrow(docs)
+	}
+	for _, phrase := range q.Phrases {
+		narrow(ix.phraseDocs(phrase))
+		scored = append(scored, phrase...)
+	}
+
+	avgLength := float64(ix.total) / float64(len(ix.lengths))
+	hits := make([]Hit, 0, len(candidates))
+	for id := range candidates {
+		var score float64
+		for _, w := range scored {
+			tf := float64(len(ix.postings[w][id]))
+			if tf == 0 {
+				continue
+			}
+			df := float64(len(ix.postings[w]))
+			idf := math.Log(1 + (float64(len(ix.lengths))-df+0.5)/(df+0.5))
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(ix.lengths[id])/avgLength)
+			score += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID > hits[j].ID
+	})
+	return hits
+}
+
+// phraseDocs finds the documents containing phrase as consecutive words.
+func (ix *Index) phraseDocs(phrase []string) map[uint]bool {
+	docs := make(map[uint]bool)
+	for id, starts := range ix.postings[phrase[0]] {
+	start:
+		for _, pos := range starts {
+			for offset, w := range phrase[1:] {
+				if !contains(ix.postings[w][id], pos+offset+1) {
+					continue start
+				}
+			}
+			docs[id] = true
+			break
+		}
+	}
+	return docs
+}
+
+func keys(postings map[uint][]int) map[uint]bool {
+	docs := make(map[uint]bool, len(postings))
+	for id := range postings {
+		docs[id] = true
+	}
+	return docs
+}
+
+func contains(positions []int, pos int) bool {
+	// Positions are appended in order, so they are sorted.
+	i := sort.SearchInts(positions, pos)
+	return i < len(positions) && positions[i] == pos
+}
@@ -0,0 +1,139 @@
+// Package search parses chirp search queries and provides the in-process
+// inverted index used where the database has no full-text search of its own.
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptyQuery = errors.New("search query must contain at least one word")
+
+// Query is a parsed search. A chirp matches when it contains every term,
+// has a word starting with every prefix and contains every phrase as
+// consecutive words.
+type Query struct {
+	Terms    []string
+	Prefixes []string
+	Phrases  [][]string
+}
+
+// Token is a normalised word and its byte offsets in the original text.
+type Token struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into lower-cased runs of letters and digits.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			tokens = append(tokens, Token{Text: strings.ToLower(text[start:i]), Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Text: strings.ToLower(text[start:]), Start: start, End: len(text)})
+	}
+	return tokens
+}
+
+func words(text string) []string {
+	tokens := Tokenize(text)
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = t.Text
+	}
+	return out
+}
+
+// Parse reads a query such as
+//
+//	coffee "good morning" tea*
+//
+// Quoted text is a phrase and a trailing * makes the word a prefix. A bare
+// word that splits into several tokens, like "don't", is kept as a phrase.
+func Parse(q string) (Query, error) {
+	var query Query
+	for len(q) > 0 {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		if q == "" {
+			break
+		}
+
+		if q[0] == '"' {
+			phrase, rest, _ := strings.Cut(q[1:], `"`)
+			q = rest
+			query.addPhrase(words(phrase))
+			continue
+		}
+
+		end := strings.IndexFunc(q, unicode.IsSpace)
+		if end < 0 {
+			end = len(q)
+		}
+		piece := q[:end]
+		q = q[end:]
+
+		if strings.HasSuffix(piece, "*") {
+			ws := words(strings.TrimRight(piece, "*"))
+			if len(ws) == 0 {
+				continue
+			}
+			query.Terms = append(query.Terms, ws[:len(ws)-1]...)
+			query.Prefixes = append(query.Prefixes, ws[len(ws)-1])
+			continue
+		}
+		query.addPhrase(words(piece))
+	}
+
+	if query.Empty() {
+		return Query{}, ErrEmptyQuery
+	}
+	return query, nil
+}
+
+func (q *Query) addPhrase(ws []string) {
+	switch len(ws) {
+	case 0:
+	case 1:
+		q.Terms = append(q.Terms, ws[0])
+	default:
+		q.Phrases = append(q.Phrases, ws)
+	}
+}
+
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Prefixes) == 0 && len(q.Phrases) == 0
+}
+
+// matches reports whether a single normalised word satisfies some part of
+// the query, which is what highlighting needs.
+func (q Query) matches(word string) bool {
+	for _, t := range q.Terms {
+		if word == t {
+			return true
+		}
+	}
+	for _, p := range q.Prefixes {
+		if strings.HasPrefix(word, p) {
+			return true
+		}
+	}
+	for _, phrase := range q.Phrases {
+		for _, w := range phrase {
+			if word == w {
+				return true
+			}
+		}
+	}
+	return false
+}
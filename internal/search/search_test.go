@@ -0,0 +1,88 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Query
+		err      error
+	}{
+		{"terms", "Coffee  TEA", Query{Terms: []string{"coffee", "tea"}}, nil},
+		{"phrase", `"good morning" coffee`, Query{Terms: []string{"coffee"}, Phrases: [][]string{{"good", "morning"}}}, nil},
+		{"prefix", "caf*", Query{Prefixes: []string{"caf"}}, nil},
+		{"split word becomes phrase", "don't", Query{Phrases: [][]string{{"don", "t"}}}, nil},
+		{"unterminated quote", `"good morning`, Query{Phrases: [][]string{{"good", "morning"}}}, nil},
+		{"empty", "  ", Query{}, ErrEmptyQuery},
+		{"punctuation only", `"" * !!`, Query{}, ErrEmptyQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if err != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := NewIndex()
+	ix.Add(1, "Good morning, coffee lovers")
+	ix.Add(2, "Morning is good for coffee coffee coffee")
+	ix.Add(3, "Tea in the morning")
+	ix.Add(4, "Caffeine is not a food group")
+
+	tests := []struct {
+		query    string
+		expected []uint
+	}{
+		{"morning", []uint{3, 1, 2}},
+		{`"good morning"`, []uint{1}},
+		{"coffee", []uint{2, 1}},
+		{"caf*", []uint{4}},
+		{"morning tea", []uint{3}},
+		{"espresso", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint
+			for _, hit := range ix.Search(q) {
+				got = append(got, hit.ID)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	ix.Remove(2)
+	ix.Add(1, "decaf only")
+	q, _ := Parse("coffee")
+	if hits := ix.Search(q); len(hits) != 0 {
+		t.Errorf("expected removed and replaced documents to be gone, got %v", hits)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	q, err := Parse(`"good morning" caf*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Highlight("Good morning <b>Café</b> & cafeteria!", q)
+	expected := "<mark>Good</mark> <mark>morning</mark> &lt;b&gt;<mark>Café</mark>&lt;/b&gt; &amp; <mark>cafeteria</mark>!"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
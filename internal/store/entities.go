@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/entities"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"gorm.io/gorm"
+)
+
+// extractEntities parses chirp's body into the rows both stores keep.
+func extractEntities(chirp *models.Chirp) ChirpEntities {
+	var found ChirpEntities
+	for _, e := range entities.Extract(chirp.Body) {
+		switch e.Kind {
+		case entities.Hashtag:
+			found.Hashtags = append(found.Hashtags, models.ChirpHashtag{
+				ChirpID:     chirp.ID,
+				StartOffset: e.Start,
+				EndOffset:   e.End,
+				Tag:         e.Text,
+				CreatedAt:   chirp.CreatedAt,
+			})
+		case entities.Mention:
+			found.Mentions = append(found.Mentions, models.ChirpMention{
+				ChirpID:     chirp.ID,
+				StartOffset: e.Start,
+				EndOffset:   e.End,
+				Username:    e.Text,
+			})
+		}
+	}
+	return found
+}
+
+// saveEntities replaces the stored entities of chirp with those in its
+// current body.
+func saveEntities(tx *gorm.DB, chirp *models.Chirp) error {
+	if err := deleteEntities(tx, chirp.ID); err != nil {
+		return err
+	}
+	found := extractEntities(chirp)
+	if len(found.Hashtags) > 0 {
+		if err := tx.Create(&found.Hashtags).Error; err != nil {
+			return err
+		}
+	}
+	if len(found.Mentions) > 0 {
+		return tx.Create(&found.Mentions).Error
+	}
+	return nil
+}
+
+// deleteEntities removes a chirp's entities. Chirps are soft-deleted, so
+// the cascade on chirp_id does not do it for us.
+func deleteEntities(tx *gorm.DB, chirpID uint) error {
+	if err := tx.Where("chirp_id = ?", chirpID).Delete(&models.ChirpHashtag{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("chirp_id = ?", chirpID).Delete(&models.ChirpMention{}).Error
+}
+
+func (s *GormStore) ListChirpEntities(ctx context.Context, chirpIDs []uint) (map[uint]ChirpEntities, error) {
+	found := make(map[uint]ChirpEntities)
+	if len(chirpIDs) == 0 {
+		return found, nil
+	}
+	db := s.db.WithContext(ctx)
+	var hashtags []models.ChirpHashtag
+	if err := db.Where("chirp_id IN ?", chirpIDs).Order("start_offset").Find(&hashtags).Error; err != nil {
+		return nil, err
+	}
+	var mentions []models.ChirpMention
+	if err := db.Where("chirp_id IN ?", chirpIDs).Order("start_offset").Find(&mentions).Error; err != nil {
+		return nil, err
+	}
+	for _, hashtag := range hashtags {
+		e := found[hashtag.ChirpID]
+		e.Hashtags = append(e.Hashtags, hashtag)
+		found[hashtag.ChirpID] = e
+	}
+	for _, mention := range mentions {
+		e := found[mention.ChirpID]
+		e.Mentions = append(e.Mentions, mention)
+		found[mention.ChirpID] = e
+	}
+	return found, nil
+}
+
+func (s *GormStore) ListHashtagChirps(ctx context.Context, filter HashtagFilter) ([]models.Chirp, error) {
+	db := s.db.WithContext(ctx)
+	// A subquery rather than a join so a chirp using the tag twice is
+	// listed once.
+	tagged := db.Model(&models.ChirpHashtag{}).Select("chirp_id").Where("tag = ?", filter.Tag)
+	query := db.Where("id IN (?)", tagged)
+	if filter.After != nil {
+		query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))",
+			filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+	query = query.Order("created_at DESC").Order("id DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var chirps []models.Chirp
+	if err := query.Find(&chirps).Error; err != nil {
+		return nil, err
+	}
+	return chirps, nil
+}
+
+func (s *GormStore) TrendingHashtags(ctx context.Context, since time.Time, limit int) ([]TrendingHashtag, error) {
+	var trending []TrendingHashtag
+	err := s.db.WithContext(ctx).Model(&models.ChirpHashtag{}).
+		Select("tag, COUNT(DISTINCT chirp_id) AS chirp_count").
+		Where("created_at >= ?", since).
+		Group("tag").
+		Order("chirp_count DESC").Order("tag").
+		Limit(limit).
+		Scan(&trending).Error
+	if err != nil {
+		return nil, err
+	}
+	return trending, nil
+}
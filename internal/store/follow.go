@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"gorm.io/gorm"
+)
+
+func (s *GormStore) Follow(ctx context.Context, followerID, followeeID uint) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.Follow{FollowerID: followerID, FolloweeID: followeeID}).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE users SET follower_count = follower_count + 1 WHERE id = ?", followeeID).Error
+	})
+	if err = translateError(err); errors.Is(err, ErrDuplicate) {
+		return nil
+	}
+	return err
+}
+
+func (s *GormStore) Unfollow(ctx context.Context, followerID, followeeID uint) (int, error) {
+	var followers int
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&models.Follow{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := tx.Exec("UPDATE users SET follower_count = follower_count - 1 WHERE id = ? AND follower_count > 0", followeeID).Error; err != nil {
+			return err
+		}
+		// The update holds the row until commit, so concurrent unfollows
+		// each see a different count.
+		return tx.Raw("SELECT follower_count FROM users WHERE id = ?", followeeID).Scan(&followers).Error
+	})
+	return followers, err
+}
+
+func (s *GormStore) ListFollowers(ctx context.Context, filter FollowFilter) ([]FollowedUser, error) {
+	return s.listFollows(ctx, filter, "followee_id", "follower_id")
+}
+
+func (s *GormStore) ListFollowing(ctx context.Context, filter FollowFilter) ([]FollowedUser, error) {
+	return s.listFollows(ctx, filter, "follower_id", "followee_id")
+}
+
+// listFollows pages through the follows whose self column is the filter's
+// user, returning the users in the other column.
+func (s *GormStore) listFollows(ctx context.Context, filter FollowFilter, self, other string) ([]FollowedUser, error) {
+	query := s.db.WithContext(ctx).Model(&models.User{}).
+		Select("users.*, follows.created_at AS followed_at").
+		Joins("JOIN follows ON follows."+other+" = users.id").
+		Where("follows."+self+" = ?", filter.UserID)
+	if filter.After != nil {
+		query = query.Where("(follows.created_at < ? OR (follows.created_at = ? AND follows."+other+" < ?))",
+			filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+	query = query.Order("follows.created_at DESC").Order("follows." + other + " DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var users []FollowedUser
+	if err := query.Scan(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *GormStore) ListTimeline(ctx context.Context, filter TimelineFilter) ([]models.Chirp, error) {
+	db := s.db.WithContext(ctx)
+	var pulled []uint
+	if filter.Precomputed && filter.FanoutMaxFollowers > 0 {
+		err := db.Raw(`SELECT follows.followee_id FROM follows
+			JOIN users ON users.id = follows.followee_id
+			WHERE follows.follower_id = ? AND users.follower_count > ?`,
+			filter.UserID, filter.FanoutMaxFollowers).Scan(&pulled).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var query *gorm.DB
+	created, id := "created_at", "id"
+	switch {
+	case filter.Precomputed && len(pulled) > 0:
+		entries := db.Model(&models.TimelineEntry{}).Select("chirp_id").Where("user_id = ?", filter.UserID)
+		query = db.Where("(id IN (?) OR user_id IN ?)", entries, pulled)
+	case filter.Precomputed:
+		created, id = "timeline_entries.created_at", "timeline_entries.chirp_id"
+		query = db.Model(&models.Chirp{}).Select("chirps.*").
+			Joins("JOIN timeline_entries ON timeline_entries.chirp_id = chirps.id").
+			Where("timeline_entries.user_id = ?", filter.UserID)
+	default:
+		followees := db.Model(&models.Follow{}).Select("followee_id").Where("follower_id = ?", filter.UserID)
+		query = db.Where("(user_id = ? OR user_id IN (?))", filter.UserID, followees)
+	}
+	if filter.After != nil {
+		query = query.Where("("+created+" < ? OR ("+created+" = ? AND "+id+" < ?))",
+			filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+	query = query.Order(created + " DESC").Order(id + " DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var chirps []models.Chirp
+	if err := query.Find(&chirps).Error; err != nil {
+		return nil, err
+	}
+	return chirps, nil
+}
+
+func (s *GormStore) DeliverChirp(ctx context.Context, chirp *models.Chirp, maxFollowers int) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		own := models.TimelineEntry{UserID: chirp.UserID, ChirpID: chirp.ID, AuthorID: chirp.UserID, CreatedAt: chirp.CreatedAt}
+		if err := tx.Create(&own).Error; err != nil {
+			return err
+		}
+		// One statement however many followers there are. Authors over the
+		// cap are left to ListTimeline to merge in.
+		return tx.Exec(`INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+			SELECT follows.follower_id, chirps.id, chirps.user_id, chirps.created_at
+			FROM follows
+			JOIN chirps ON chirps.user_id = follows.followee_id
+			JOIN users ON users.id = chirps.user_id
+			WHERE chirps.id = ? AND (? = 0 OR users.follower_count <= ?)`,
+			chirp.ID, maxFollowers, maxFollowers).Error
+	})
+}
+
+func (s *GormStore) BackfillTimeline(ctx context.Context, userID, authorID uint, limit int) error {
+	return s.db.WithContext(ctx).Exec(`INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+		SELECT ?, id, user_id, created_at FROM chirps
+		WHERE user_id = ? AND deleted_at IS NULL
+			AND id NOT IN (SELECT chirp_id FROM timeline_entries WHERE user_id = ?)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`, userID, authorID, userID, limit).Error
+}
+
+func (s *GormStore) BackfillTimelines(ctx context.Context, limit, maxFollowers int) error {
+	return s.db.WithContext(ctx).Exec(`INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+		SELECT readers.user_id, latest.id, latest.user_id, latest.created_at
+		FROM (
+			SELECT id, user_id, created_at,
+				ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC, id DESC) AS author_rank
+			FROM chirps WHERE deleted_at IS NULL
+		) latest
+		JOIN (
+			SELECT id AS user_id, id AS author_id FROM users
+			UNION
+			SELECT follows.follower_id, follows.followee_id FROM follows
+			JOIN users ON users.id = follows.followee_id
+			WHERE ? = 0 OR users.follower_count <= ?
+		) readers ON readers.author_id = latest.user_id
+		WHERE latest.author_rank <= ?
+			AND NOT EXISTS (
+				SELECT 1 FROM timeline_entries existing
+				WHERE existing.user_id = readers.user_id AND existing.chirp_id = latest.id
+			)`, maxFollowers, maxFollowers, limit).Error
+}
+
+func (s *GormStore) BackfillFollowerTimelines(ctx context.Context, authorID uint, limit int) error {
+	return s.db.WithContext(ctx).Exec(`INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+		SELECT follows.follower_id, latest.id, latest.user_id, latest.created_at
+		FROM (
+			SELECT id, user_id, created_at FROM chirps
+			WHERE user_id = ? AND deleted_at IS NULL
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?
+		) latest
+		JOIN follows ON follows.followee_id = latest.user_id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM timeline_entries existing
+			WHERE existing.user_id = follows.follower_id AND existing.chirp_id = latest.id
+		)`, authorID, limit).Error
+}
+
+func (s *GormStore) PruneTimeline(ctx context.Context, userID, authorID uint) error {
+	return s.db.WithContext(ctx).
+		Where("user_id = ? AND author_id = ?", userID, authorID).
+		Delete(&models.TimelineEntry{}).Error
+}
@@ -0,0 +1,511 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormStore struct {
+	db        *gorm.DB
+	textIndex sqliteIndex
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db, textIndex: sqliteIndex{index: search.NewIndex()}}
+}
+
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		// The row referred to does not exist.
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *GormStore) CreateUser(ctx context.Context, user *models.User) error {
+	return translateError(s.db.WithContext(ctx).Create(user).Error)
+}
+
+func (s *GormStore) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (s *GormStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (s *GormStore) UpdateUser(ctx context.Context, user *models.User) error {
+	return translateError(s.db.WithContext(ctx).Save(user).Error)
+}
+
+func (s *GormStore) DeleteAllUsers(ctx context.Context) error {
+	defer s.resetIndex()
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Session must come last so tx is safe to reuse for every delete.
+		tx = tx.Unscoped().Session(&gorm.Session{AllowGlobalUpdate: true})
+		for _, model := range []interface{}{&models.TimelineEntry{}, &models.Follow{}, &models.RefreshToken{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}, &models.RecoveryCode{}, &models.TOTPCredential{}, &models.ChirpLike{}, &models.ChirpHashtag{}, &models.ChirpMention{}, &models.ChirpRevision{}, &models.Chirp{}, &models.User{}, &models.LoginAttempt{}} {
+			if err := tx.Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *GormStore) CreateChirp(ctx context.Context, chirp *models.Chirp) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(chirp).Error; err != nil {
+			return err
+		}
+		if chirp.ConversationID == 0 {
+			chirp.ConversationID = chirp.ID
+			if err := tx.Model(chirp).UpdateColumn("conversation_id", chirp.ID).Error; err != nil {
+				return err
+			}
+		}
+		if err := saveEntities(tx, chirp); err != nil {
+			return err
+		}
+		// UpdateColumn leaves updated_at alone, which EditChirp relies on to
+		// detect concurrent edits of the parent or original.
+		if chirp.InReplyToID != nil {
+			err := tx.Model(&models.Chirp{}).Where("id = ?", *chirp.InReplyToID).
+				UpdateColumn("reply_count", gorm.Expr("reply_count + 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+		if shared := chirp.SharedChirpID(); shared != nil {
+			return tx.Model(&models.Chirp{}).Where("id = ?", *shared).
+				UpdateColumn("share_count", gorm.Expr("share_count + 1")).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return translateError(err)
+	}
+	s.indexChirp(chirp)
+	return nil
+}
+
+func (s *GormStore) GetChirpByID(ctx context.Context, id uint) (*models.Chirp, error) {
+	var chirp models.Chirp
+	if err := s.db.WithContext(ctx).First(&chirp, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &chirp, nil
+}
+
+func (s *GormStore) GetChirpsByIDs(ctx context.Context, ids []uint) ([]models.Chirp, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var chirps []models.Chirp
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&chirps).Error; err != nil {
+		return nil, err
+	}
+	return chirps, nil
+}
+
+func (s *GormStore) GetRechirp(ctx context.Context, userID, chirpID uint) (*models.Chirp, error) {
+	var chirp models.Chirp
+	err := s.db.WithContext(ctx).Where("rechirp_of_id = ? AND user_id = ?", chirpID, userID).First(&chirp).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &chirp, nil
+}
+
+func (s *GormStore) ListChirps(ctx context.Context, filter ChirpFilter) ([]models.Chirp, error) {
+	query := s.db.WithContext(ctx)
+	if filter.AuthorID != 0 {
+		query = query.Where("user_id = ?", filter.AuthorID)
+	}
+	if filter.Flagged {
+		query = query.Where("flagged = ?", true)
+	}
+	op, dir := ">", "ASC"
+	if filter.Descending {
+		op, dir = "<", "DESC"
+	}
+	if filter.After != nil {
+		// Expanded rather than a row-value comparison so every dialect
+		// can use the (created_at, id) index.
+		query = query.Where("(created_at "+op+" ? OR (created_at = ? AND id "+op+" ?))",
+			filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+	query = query.Order("created_at " + dir).Order("id " + dir)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var chirps []models.Chirp
+	if err := query.Find(&chirps).Error; err != nil {
+		return nil, err
+	}
+	return chirps, nil
+}
+
+func (s *GormStore) EditChirp(ctx context.Context, chirp *models.Chirp, body string) error {
+	now := time.Now()
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.ChirpRevision{ChirpID: chirp.ID, Body: chirp.Body, CreatedAt: now}).Error; err != nil {
+			return err
+		}
+		// Matching on updated_at makes a concurrent edit lose cleanly
+		// instead of dropping the other edit's revision.
+		result := tx.Model(&models.Chirp{}).
+			Where("id = ? AND updated_at = ?", chirp.ID, chirp.UpdatedAt).
+			Updates(map[string]interface{}{"body": body, "edited_at": now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		edited := *chirp
+		edited.Body = body
+		return saveEntities(tx, &edited)
+	})
+	if err != nil {
+		return translateError(err)
+	}
+	chirp.Body = body
+	chirp.EditedAt = &now
+	chirp.UpdatedAt = now
+	s.indexChirp(chirp)
+	return nil
+}
+
+func (s *GormStore) ListChirpRevisions(ctx context.Context, chirpID uint) ([]models.ChirpRevision, error) {
+	var revisions []models.ChirpRevision
+	if err := s.db.WithContext(ctx).Where("chirp_id = ?", chirpID).Order("id").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (s *GormStore) ListAncestors(ctx context.Context, chirpID uint) ([]models.Chirp, error) {
+	// Walking the parent links in one recursive query touches only the
+	// ancestors, however large the rest of the conversation is.
+	var chirps []models.Chirp
+	err := s.db.WithContext(ctx).Raw(`WITH RECURSIVE ancestors (id, in_reply_to_id, depth) AS (
+		SELECT id, in_reply_to_id, 0 FROM chirps WHERE id = ?
+		UNION ALL
+		SELECT c.id, c.in_reply_to_id, a.depth + 1
+		FROM chirps c JOIN ancestors a ON c.id = a.in_reply_to_id
+		WHERE c.deleted_at IS NULL
+	)
+	SELECT chirps.* FROM chirps JOIN ancestors ON chirps.id = ancestors.id
+	WHERE ancestors.depth > 0
+	ORDER BY ancestors.depth DESC`, chirpID).Scan(&chirps).Error
+	if err != nil {
+		return nil, err
+	}
+	return chirps, nil
+}
+
+func (s *GormStore) ListReplies(ctx context.Context, filter ReplyFilter) ([]models.Chirp, error) {
+	if len(filter.ParentIDs) == 0 {
+		return nil, nil
+	}
+	replies := s.db.WithContext(ctx).Model(&models.Chirp{}).
+		Select("chirps.*, ROW_NUMBER() OVER (PARTITION BY in_reply_to_id ORDER BY created_at, id) AS reply_rank").
+		Where("in_reply_to_id IN ?", filter.ParentIDs)
+	if filter.After != nil {
+		replies = replies.Where("(created_at > ? OR (created_at = ? AND id > ?))",
+			filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+	query := s.db.WithContext(ctx).Table("(?) AS replies", replies)
+	if filter.PerParent > 0 {
+		query = query.Where("reply_rank <= ?", filter.PerParent)
+	}
+	query = query.Order("in_reply_to_id").Order("created_at").Order("id")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var chirps []models.Chirp
+	if err := query.Find(&chirps).Error; err != nil {
+		return nil, err
+	}
+	return chirps, nil
+}
+
+func (s *GormStore) SetChirpFlagged(ctx context.Context, id uint, flagged bool) error {
+	// UpdateColumn, like the counters, so a review does not count as an
+	// edit.
+	result := s.db.WithContext(ctx).Model(&models.Chirp{}).Where("id = ?", id).UpdateColumn("flagged", flagged)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *GormStore) DeleteChirp(ctx context.Context, id uint) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var chirp models.Chirp
+		if err := tx.Select("id", "in_reply_to_id", "rechirp_of_id", "quote_of_id").First(&chirp, id).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.Chirp{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := deleteEntities(tx, id); err != nil {
+			return err
+		}
+		if chirp.InReplyToID != nil {
+			err := tx.Model(&models.Chirp{}).Where("id = ? AND reply_count > 0", *chirp.InReplyToID).
+				UpdateColumn("reply_count", gorm.Expr("reply_count - 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+		if shared := chirp.SharedChirpID(); shared != nil {
+			return tx.Model(&models.Chirp{}).Where("id = ? AND share_count > 0", *shared).
+				UpdateColumn("share_count", gorm.Expr("share_count - 1")).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return translateError(err)
+	}
+	s.unindexChirp(id)
+	return nil
+}
+
+func (s *GormStore) LikeChirp(ctx context.Context, userID, chirpID uint) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Counting first also checks the chirp exists and is not deleted.
+		result := tx.Model(&models.Chirp{}).Where("id = ?", chirpID).
+			UpdateColumn("like_count", gorm.Expr("like_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return translateError(tx.Create(&models.ChirpLike{UserID: userID, ChirpID: chirpID}).Error)
+	})
+	// A duplicate means the chirp is already liked; the rollback leaves the
+	// count as it was.
+	if errors.Is(err, ErrDuplicate) {
+		return nil
+	}
+	return err
+}
+
+func (s *GormStore) UnlikeChirp(ctx context.Context, userID, chirpID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND chirp_id = ?", userID, chirpID).Delete(&models.ChirpLike{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Chirp{}).Where("id = ? AND like_count > 0", chirpID).
+			UpdateColumn("like_count", gorm.Expr("like_count - 1")).Error
+	})
+}
+
+func (s *GormStore) LikedChirpIDs(ctx context.Context, userID uint, chirpIDs []uint) (map[uint]bool, error) {
+	liked := make(map[uint]bool)
+	if len(chirpIDs) == 0 {
+		return liked, nil
+	}
+	var ids []uint
+	err := s.db.WithContext(ctx).Model(&models.ChirpLike{}).
+		Where("user_id = ? AND chirp_id IN ?", userID, chirpIDs).
+		Pluck("chirp_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		liked[id] = true
+	}
+	return liked, nil
+}
+
+func (s *GormStore) ListLikedChirps(ctx context.Context, filter LikeFilter) ([]LikedChirp, error) {
+	query := s.db.WithContext(ctx).Model(&models.Chirp{}).
+		Select("chirps.*, chirp_likes.created_at AS liked_at").
+		Joins("JOIN chirp_likes ON chirp_likes.chirp_id = chirps.id").
+		Where("chirp_likes.user_id = ?", filter.UserID)
+	if filter.After != nil {
+		query = query.Where("(chirp_likes.created_at < ? OR (chirp_likes.created_at = ? AND chirp_likes.chirp_id < ?))",
+			filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+	query = query.Order("chirp_likes.created_at DESC").Order("chirp_likes.chirp_id DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var likes []LikedChirp
+	if err := query.Scan(&likes).Error; err != nil {
+		return nil, err
+	}
+	return likes, nil
+}
+
+func (s *GormStore) ListProfanityWords(ctx context.Context) ([]models.ProfanityWord, error) {
+	var words []models.ProfanityWord
+	if err := s.db.WithContext(ctx).Order("word").Find(&words).Error; err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+func (s *GormStore) SaveProfanityWord(ctx context.Context, word *models.ProfanityWord) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "word"}},
+		DoUpdates: clause.AssignmentColumns([]string{"action", "updated_at"}),
+	}).Create(word).Error
+}
+
+func (s *GormStore) DeleteProfanityWord(ctx context.Context, word string) error {
+	return s.db.WithContext(ctx).Where("word = ?", word).Delete(&models.ProfanityWord{}).Error
+}
+
+func (s *GormStore) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return translateError(s.db.WithContext(ctx).Create(token).Error)
+}
+
+func (s *GormStore) GetRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+	if err := s.db.WithContext(ctx).Where("token = ?", token).First(&refreshToken).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &refreshToken, nil
+}
+
+func (s *GormStore) UpdateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return translateError(s.db.WithContext(ctx).Save(token).Error)
+}
+
+func (s *GormStore) RotateRefreshToken(ctx context.Context, old, next *models.RefreshToken) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("token = ? AND revoked_at IS NULL", old.Token).
+			Updates(map[string]interface{}{"revoked_at": now, "updated_at": now, "replaced_by": next.Token})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		if err := tx.Create(next).Error; err != nil {
+			return translateError(err)
+		}
+		old.RevokedAt = &now
+		old.UpdatedAt = now
+		old.ReplacedBy = &next.Token
+		return nil
+	})
+}
+
+func (s *GormStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+	return s.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error
+}
+
+func (s *GormStore) CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	return translateError(s.db.WithContext(ctx).Create(token).Error)
+}
+
+func (s *GormStore) GetPasswordResetUser(ctx context.Context, tokenHash string) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).
+		Joins("JOIN password_reset_tokens ON password_reset_tokens.user_id = users.id").
+		Where("password_reset_tokens.token_hash = ? AND password_reset_tokens.expires_at > ?", tokenHash, time.Now()).
+		First(&user).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (s *GormStore) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (uint, error) {
+	var userID uint
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var token models.PasswordResetToken
+		if err := tx.Where("token_hash = ? AND expires_at > ?", tokenHash, now).First(&token).Error; err != nil {
+			return translateError(err)
+		}
+		// Deleting the token is what makes it single-use: of two requests
+		// racing with it, only one deletes a row.
+		result := tx.Where("token_hash = ?", tokenHash).Delete(&models.PasswordResetToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := tx.Where("user_id = ?", token.UserID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", token.UserID).
+			Updates(map[string]interface{}{"hashed_password": hashedPassword, "updated_at": now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", token.UserID).
+			Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error; err != nil {
+			return err
+		}
+		userID = token.UserID
+		return nil
+	})
+	return userID, err
+}
+
+func (s *GormStore) CreateEmailVerificationToken(ctx context.Context, token *models.EmailVerificationToken) error {
+	return translateError(s.db.WithContext(ctx).Create(token).Error)
+}
+
+func (s *GormStore) VerifyEmail(ctx context.Context, tokenHash string) (uint, error) {
+	var userID uint
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var token models.EmailVerificationToken
+		if err := tx.Where("token_hash = ? AND expires_at > ?", tokenHash, now).First(&token).Error; err != nil {
+			return translateError(err)
+		}
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND email = ?", token.UserID, token.Email).
+			UpdateColumn("email_verified_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		userID = token.UserID
+		return tx.Where("user_id = ?", token.UserID).Delete(&models.EmailVerificationToken{}).Error
+	})
+	return userID, err
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"gorm.io/gorm"
+)
+
+func (s *GormStore) GetLoginAttempt(ctx context.Context, scope, subject string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	if err := s.db.WithContext(ctx).Where("scope = ? AND subject = ?", scope, subject).First(&attempt).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &attempt, nil
+}
+
+func (s *GormStore) RecordLoginFailure(ctx context.Context, scope, subject string, now, forgetBefore time.Time) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("scope = ? AND subject = ? AND last_failed_at < ?", scope, subject, forgetBefore).
+			Delete(&models.LoginAttempt{}).Error; err != nil {
+			return err
+		}
+		// Incrementing in SQL keeps concurrent failures from being lost.
+		result := tx.Model(&models.LoginAttempt{}).
+			Where("scope = ? AND subject = ?", scope, subject).
+			Updates(map[string]interface{}{"failures": gorm.Expr("failures + 1"), "last_failed_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			attempt = models.LoginAttempt{Scope: scope, Subject: subject, Failures: 1, LastFailedAt: now}
+			return translateError(tx.Create(&attempt).Error)
+		}
+		return tx.Where("scope = ? AND subject = ?", scope, subject).First(&attempt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (s *GormStore) ForgiveLoginFailures(ctx context.Context, scope, subject string, n int) error {
+	return s.db.WithContext(ctx).Model(&models.LoginAttempt{}).
+		Where("scope = ? AND subject = ?", scope, subject).
+		UpdateColumn("failures", gorm.Expr("CASE WHEN failures > ? THEN failures - ? ELSE 0 END", n, n)).Error
+}
+
+func (s *GormStore) LockLogin(ctx context.Context, scope, subject string, until time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.LoginAttempt{}).
+		Where("scope = ? AND subject = ? AND (locked_until IS NULL OR locked_until < ?)", scope, subject, until).
+		UpdateColumn("locked_until", until).Error
+}
+
+func (s *GormStore) ListLoginLockouts(ctx context.Context, now time.Time) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := s.db.WithContext(ctx).
+		Where("locked_until > ?", now).
+		Order("locked_until DESC").Order("scope").Order("subject").
+		Find(&attempts).Error
+	return attempts, err
+}
+
+func (s *GormStore) ClearLoginAttempts(ctx context.Context, scope, subject string) error {
+	result := s.db.WithContext(ctx).Where("scope = ? AND subject = ?", scope, subject).Delete(&models.LoginAttempt{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
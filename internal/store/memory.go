@@ -0,0 +1,1139 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/entities"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/search"
+)
+
+// MemoryStore keeps everything in process memory. It is meant for tests and
+// local experiments; nothing survives a restart.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	nextUserID    uint
+	nextChirpID   uint
+	nextRevision  uint
+	users         map[uint]models.User
+	chirps        map[uint]models.Chirp
+	revisions     map[uint][]models.ChirpRevision
+	likes         map[likeKey]time.Time
+	follows       map[followKey]time.Time
+	timelines     map[uint]map[uint]bool
+	profanity     map[string]models.ProfanityWord
+	refreshTokens map[string]models.RefreshToken
+	resetTokens   map[string]models.PasswordResetToken
+	verifyTokens  map[string]models.EmailVerificationToken
+	totp          map[uint]models.TOTPCredential
+	recoveryCodes map[uint]map[string]bool
+	loginAttempts map[loginKey]models.LoginAttempt
+	index         *search.Index
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:         make(map[uint]models.User),
+		chirps:        make(map[uint]models.Chirp),
+		revisions:     make(map[uint][]models.ChirpRevision),
+		likes:         make(map[likeKey]time.Time),
+		follows:       make(map[followKey]time.Time),
+		timelines:     make(map[uint]map[uint]bool),
+		profanity:     make(map[string]models.ProfanityWord),
+		refreshTokens: make(map[string]models.RefreshToken),
+		resetTokens:   make(map[string]models.PasswordResetToken),
+		verifyTokens:  make(map[string]models.EmailVerificationToken),
+		totp:          make(map[uint]models.TOTPCredential),
+		recoveryCodes: make(map[uint]map[string]bool),
+		loginAttempts: make(map[loginKey]models.LoginAttempt),
+		index:         search.NewIndex(),
+	}
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return ErrDuplicate
+		}
+	}
+	s.nextUserID++
+	now := time.Now()
+	user.ID = s.nextUserID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *MemoryStore) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) UpdateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; !ok {
+		return ErrNotFound
+	}
+	for id, existing := range s.users {
+		if id != user.ID && existing.Email == user.Email {
+			return ErrDuplicate
+		}
+	}
+	user.UpdatedAt = time.Now()
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *MemoryStore) DeleteAllUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = make(map[uint]models.User)
+	s.chirps = make(map[uint]models.Chirp)
+	s.revisions = make(map[uint][]models.ChirpRevision)
+	s.likes = make(map[likeKey]time.Time)
+	s.follows = make(map[followKey]time.Time)
+	s.timelines = make(map[uint]map[uint]bool)
+	s.refreshTokens = make(map[string]models.RefreshToken)
+	s.resetTokens = make(map[string]models.PasswordResetToken)
+	s.verifyTokens = make(map[string]models.EmailVerificationToken)
+	s.totp = make(map[uint]models.TOTPCredential)
+	s.recoveryCodes = make(map[uint]map[string]bool)
+	s.loginAttempts = make(map[loginKey]models.LoginAttempt)
+	s.index.Reset()
+	return nil
+}
+
+func (s *MemoryStore) CreateChirp(ctx context.Context, chirp *models.Chirp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if chirp.RechirpOfID != nil {
+		for _, existing := range s.chirps {
+			if existing.UserID == chirp.UserID && existing.RechirpOfID != nil && *existing.RechirpOfID == *chirp.RechirpOfID {
+				return ErrDuplicate
+			}
+		}
+	}
+	s.nextChirpID++
+	now := time.Now()
+	chirp.ID = s.nextChirpID
+	// Like gorm, keep timestamps the caller already set.
+	if chirp.CreatedAt.IsZero() {
+		chirp.CreatedAt = now
+	}
+	if chirp.UpdatedAt.IsZero() {
+		chirp.UpdatedAt = now
+	}
+	if chirp.ConversationID == 0 {
+		chirp.ConversationID = chirp.ID
+	}
+	if chirp.InReplyToID != nil {
+		if parent, ok := s.chirps[*chirp.InReplyToID]; ok {
+			parent.ReplyCount++
+			s.chirps[parent.ID] = parent
+		}
+	}
+	if shared := chirp.SharedChirpID(); shared != nil {
+		if original, ok := s.chirps[*shared]; ok {
+			original.ShareCount++
+			s.chirps[original.ID] = original
+		}
+	}
+	s.chirps[chirp.ID] = *chirp
+	s.index.Add(chirp.ID, chirp.Body)
+	return nil
+}
+
+func (s *MemoryStore) GetChirpByID(ctx context.Context, id uint) (*models.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chirp, ok := s.chirps[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &chirp, nil
+}
+
+func (s *MemoryStore) GetChirpsByIDs(ctx context.Context, ids []uint) ([]models.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var chirps []models.Chirp
+	for _, id := range ids {
+		if chirp, ok := s.chirps[id]; ok {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
+
+func (s *MemoryStore) GetRechirp(ctx context.Context, userID, chirpID uint) (*models.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, chirp := range s.chirps {
+		if chirp.UserID == userID && chirp.RechirpOfID != nil && *chirp.RechirpOfID == chirpID {
+			return &chirp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) ListChirps(ctx context.Context, filter ChirpFilter) ([]models.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chirps := make([]models.Chirp, 0, len(s.chirps))
+	for _, chirp := range s.chirps {
+		if filter.AuthorID != 0 && chirp.UserID != filter.AuthorID {
+			continue
+		}
+		if filter.Flagged && !chirp.Flagged {
+			continue
+		}
+		if filter.After != nil && !chirpAfter(chirp, *filter.After, filter.Descending) {
+			continue
+		}
+		chirps = append(chirps, chirp)
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirpAfter(chirps[j], ChirpCursor{CreatedAt: chirps[i].CreatedAt, ID: chirps[i].ID}, filter.Descending)
+	})
+	if filter.Limit > 0 && len(chirps) > filter.Limit {
+		chirps = chirps[:filter.Limit]
+	}
+	return chirps, nil
+}
+
+func (s *MemoryStore) ListAncestors(ctx context.Context, chirpID uint) ([]models.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var chirps []models.Chirp
+	chirp, ok := s.chirps[chirpID]
+	for ok && chirp.InReplyToID != nil {
+		chirp, ok = s.chirps[*chirp.InReplyToID]
+		if ok {
+			chirps = append([]models.Chirp{chirp}, chirps...)
+		}
+	}
+	return chirps, nil
+}
+
+func (s *MemoryStore) ListReplies(ctx context.Context, filter ReplyFilter) ([]models.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	parents := make(map[uint]bool, len(filter.ParentIDs))
+	for _, id := range filter.ParentIDs {
+		parents[id] = true
+	}
+	var chirps []models.Chirp
+	for _, chirp := range s.chirps {
+		if chirp.InReplyToID == nil || !parents[*chirp.InReplyToID] {
+			continue
+		}
+		if filter.After != nil && !chirpAfter(chirp, *filter.After, false) {
+			continue
+		}
+		chirps = append(chirps, chirp)
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		if *chirps[i].InReplyToID != *chirps[j].InReplyToID {
+			return *chirps[i].InReplyToID < *chirps[j].InReplyToID
+		}
+		return chirpAfter(chirps[j], ChirpCursor{CreatedAt: chirps[i].CreatedAt, ID: chirps[i].ID}, false)
+	})
+	if filter.PerParent > 0 {
+		kept := chirps[:0]
+		seen := make(map[uint]int)
+		for _, chirp := range chirps {
+			if seen[*chirp.InReplyToID] < filter.PerParent {
+				seen[*chirp.InReplyToID]++
+				kept = append(kept, chirp)
+			}
+		}
+		chirps = kept
+	}
+	if filter.Limit > 0 && len(chirps) > filter.Limit {
+		chirps = chirps[:filter.Limit]
+	}
+	return chirps, nil
+}
+
+func (s *MemoryStore) EditChirp(ctx context.Context, chirp *models.Chirp, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.chirps[chirp.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if !current.UpdatedAt.Equal(chirp.UpdatedAt) {
+		return ErrConflict
+	}
+	now := time.Now()
+	s.nextRevision++
+	s.revisions[chirp.ID] = append(s.revisions[chirp.ID], models.ChirpRevision{
+		ID:        s.nextRevision,
+		CreatedAt: now,
+		ChirpID:   chirp.ID,
+		Body:      current.Body,
+	})
+	current.Body = body
+	current.EditedAt = &now
+	current.UpdatedAt = now
+	s.chirps[chirp.ID] = current
+	s.index.Add(chirp.ID, body)
+	*chirp = current
+	return nil
+}
+
+func (s *MemoryStore) ListChirpRevisions(ctx context.Context, chirpID uint) ([]models.ChirpRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.ChirpRevision(nil), s.revisions[chirpID]...), nil
+}
+
+func (s *MemoryStore) SearchChirps(ctx context.Context, q ChirpSearch) ([]ChirpMatch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []ChirpMatch
+	for _, hit := range s.index.Search(q.Query) {
+		chirp, ok := s.chirps[hit.ID]
+		if !ok || (q.AuthorID != 0 && chirp.UserID != q.AuthorID) {
+			continue
+		}
+		matches = append(matches, ChirpMatch{Chirp: chirp, Score: hit.Score})
+		if q.Limit > 0 && len(matches) == q.Limit {
+			break
+		}
+	}
+	return matches, nil
+}
+
+// chirpAfter reports whether chirp comes after cursor in (created_at, id)
+// order, or before it when descending.
+func chirpAfter(chirp models.Chirp, cursor ChirpCursor, descending bool) bool {
+	if !chirp.CreatedAt.Equal(cursor.CreatedAt) {
+		return chirp.CreatedAt.After(cursor.CreatedAt) != descending
+	}
+	if chirp.ID == cursor.ID {
+		return false
+	}
+	return (chirp.ID > cursor.ID) != descending
+}
+
+func (s *MemoryStore) SetChirpFlagged(ctx context.Context, id uint, flagged bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chirp, ok := s.chirps[id]
+	if !ok {
+		return ErrNotFound
+	}
+	chirp.Flagged = flagged
+	s.chirps[id] = chirp
+	return nil
+}
+
+func (s *MemoryStore) DeleteChirp(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chirp, ok := s.chirps[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if chirp.InReplyToID != nil {
+		if parent, ok := s.chirps[*chirp.InReplyToID]; ok && parent.ReplyCount > 0 {
+			parent.ReplyCount--
+			s.chirps[parent.ID] = parent
+		}
+	}
+	if shared := chirp.SharedChirpID(); shared != nil {
+		if original, ok := s.chirps[*shared]; ok && original.ShareCount > 0 {
+			original.ShareCount--
+			s.chirps[original.ID] = original
+		}
+	}
+	delete(s.chirps, id)
+	delete(s.revisions, id)
+	s.index.Remove(id)
+	return nil
+}
+
+type likeKey struct {
+	userID, chirpID uint
+}
+
+func (s *MemoryStore) LikeChirp(ctx context.Context, userID, chirpID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chirp, ok := s.chirps[chirpID]
+	if !ok {
+		return ErrNotFound
+	}
+	key := likeKey{userID, chirpID}
+	if _, ok := s.likes[key]; ok {
+		return nil
+	}
+	s.likes[key] = time.Now()
+	chirp.LikeCount++
+	s.chirps[chirpID] = chirp
+	return nil
+}
+
+func (s *MemoryStore) UnlikeChirp(ctx context.Context, userID, chirpID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := likeKey{userID, chirpID}
+	if _, ok := s.likes[key]; !ok {
+		return nil
+	}
+	delete(s.likes, key)
+	if chirp, ok := s.chirps[chirpID]; ok && chirp.LikeCount > 0 {
+		chirp.LikeCount--
+		s.chirps[chirpID] = chirp
+	}
+	return nil
+}
+
+func (s *MemoryStore) LikedChirpIDs(ctx context.Context, userID uint, chirpIDs []uint) (map[uint]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	liked := make(map[uint]bool)
+	for _, id := range chirpIDs {
+		if _, ok := s.likes[likeKey{userID, id}]; ok {
+			liked[id] = true
+		}
+	}
+	return liked, nil
+}
+
+func (s *MemoryStore) ListLikedChirps(ctx context.Context, filter LikeFilter) ([]LikedChirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var likes []LikedChirp
+	for key, likedAt := range s.likes {
+		chirp, ok := s.chirps[key.chirpID]
+		if key.userID != filter.UserID || !ok {
+			continue
+		}
+		like := LikedChirp{Chirp: chirp, LikedAt: likedAt}
+		if filter.After != nil && !before(likedAt, chirp.ID, *filter.After) {
+			continue
+		}
+		likes = append(likes, like)
+	}
+	sort.Slice(likes, func(i, j int) bool {
+		return before(likes[j].LikedAt, likes[j].Chirp.ID, ChirpCursor{CreatedAt: likes[i].LikedAt, ID: likes[i].Chirp.ID})
+	})
+	if filter.Limit > 0 && len(likes) > filter.Limit {
+		likes = likes[:filter.Limit]
+	}
+	return likes, nil
+}
+
+type followKey struct {
+	followerID, followeeID uint
+}
+
+func (s *MemoryStore) Follow(ctx context.Context, followerID, followeeID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[followerID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.users[followeeID]; !ok {
+		return ErrNotFound
+	}
+	key := followKey{followerID, followeeID}
+	if _, ok := s.follows[key]; !ok {
+		s.follows[key] = time.Now()
+	}
+	return nil
+}
+
+func (s *MemoryStore) Unfollow(ctx context.Context, followerID, followeeID uint) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := followKey{followerID, followeeID}
+	if _, ok := s.follows[key]; !ok {
+		return 0, ErrNotFound
+	}
+	delete(s.follows, key)
+	return s.followerCount(followeeID), nil
+}
+
+func (s *MemoryStore) ListFollowers(ctx context.Context, filter FollowFilter) ([]FollowedUser, error) {
+	return s.listFollows(filter, func(key followKey) (uint, uint) { return key.followeeID, key.followerID })
+}
+
+func (s *MemoryStore) ListFollowing(ctx context.Context, filter FollowFilter) ([]FollowedUser, error) {
+	return s.listFollows(filter, func(key followKey) (uint, uint) { return key.followerID, key.followeeID })
+}
+
+// listFollows pages through the follows where sides reports the filter's
+// user as self, returning the users on the other side.
+func (s *MemoryStore) listFollows(filter FollowFilter, sides func(followKey) (self, other uint)) ([]FollowedUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []FollowedUser
+	for key, followedAt := range s.follows {
+		self, other := sides(key)
+		user, ok := s.users[other]
+		if self != filter.UserID || !ok {
+			continue
+		}
+		if filter.After != nil && !before(followedAt, other, *filter.After) {
+			continue
+		}
+		users = append(users, FollowedUser{User: user, FollowedAt: followedAt})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return before(users[j].FollowedAt, users[j].User.ID, ChirpCursor{CreatedAt: users[i].FollowedAt, ID: users[i].User.ID})
+	})
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+// before reports whether (t, id) comes before cursor in (time, id) order,
+// the order likes and follows are paged through newest first.
+func before(t time.Time, id uint, cursor ChirpCursor) bool {
+	if !t.Equal(cursor.CreatedAt) {
+		return t.Before(cursor.CreatedAt)
+	}
+	return id < cursor.ID
+}
+
+func (s *MemoryStore) ListTimeline(ctx context.Context, filter TimelineFilter) ([]models.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	include := func(chirp models.Chirp) bool {
+		_, follows := s.follows[followKey{filter.UserID, chirp.UserID}]
+		if filter.Precomputed {
+			pulled := follows && filter.FanoutMaxFollowers > 0 && s.followerCount(chirp.UserID) > filter.FanoutMaxFollowers
+			return s.timelines[filter.UserID][chirp.ID] || pulled
+		}
+		return chirp.UserID == filter.UserID || follows
+	}
+
+	var chirps []models.Chirp
+	for _, chirp := range s.chirps {
+		if !include(chirp) {
+			continue
+		}
+		if filter.After != nil && !chirpAfter(chirp, *filter.After, true) {
+			continue
+		}
+		chirps = append(chirps, chirp)
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirpAfter(chirps[j], ChirpCursor{CreatedAt: chirps[i].CreatedAt, ID: chirps[i].ID}, true)
+	})
+	if filter.Limit > 0 && len(chirps) > filter.Limit {
+		chirps = chirps[:filter.Limit]
+	}
+	return chirps, nil
+}
+
+func (s *MemoryStore) DeliverChirp(ctx context.Context, chirp *models.Chirp, maxFollowers int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addToTimeline(chirp.UserID, chirp.ID)
+	if maxFollowers > 0 && s.followerCount(chirp.UserID) > maxFollowers {
+		return nil
+	}
+	for key := range s.follows {
+		if key.followeeID == chirp.UserID {
+			s.addToTimeline(key.followerID, chirp.ID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) BackfillTimeline(ctx context.Context, userID, authorID uint, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.backfillTimeline(userID, authorID, limit)
+	return nil
+}
+
+func (s *MemoryStore) BackfillTimelines(ctx context.Context, limit, maxFollowers int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID := range s.users {
+		s.backfillTimeline(userID, userID, limit)
+	}
+	for key := range s.follows {
+		if maxFollowers == 0 || s.followerCount(key.followeeID) <= maxFollowers {
+			s.backfillTimeline(key.followerID, key.followeeID, limit)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) BackfillFollowerTimelines(ctx context.Context, authorID uint, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.follows {
+		if key.followeeID == authorID {
+			s.backfillTimeline(key.followerID, authorID, limit)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) backfillTimeline(userID, authorID uint, limit int) {
+	var chirps []models.Chirp
+	for _, chirp := range s.chirps {
+		if chirp.UserID == authorID {
+			chirps = append(chirps, chirp)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirpAfter(chirps[j], ChirpCursor{CreatedAt: chirps[i].CreatedAt, ID: chirps[i].ID}, true)
+	})
+	for i, chirp := range chirps {
+		if i == limit {
+			break
+		}
+		s.addToTimeline(userID, chirp.ID)
+	}
+}
+
+func (s *MemoryStore) followerCount(userID uint) int {
+	count := 0
+	for key := range s.follows {
+		if key.followeeID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *MemoryStore) PruneTimeline(ctx context.Context, userID, authorID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for chirpID := range s.timelines[userID] {
+		if chirp, ok := s.chirps[chirpID]; !ok || chirp.UserID == authorID {
+			delete(s.timelines[userID], chirpID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) addToTimeline(userID, chirpID uint) {
+	if s.timelines[userID] == nil {
+		s.timelines[userID] = make(map[uint]bool)
+	}
+	s.timelines[userID][chirpID] = true
+}
+
+// The memory store keeps no entity tables; it parses chirp bodies as they
+// are read.
+
+func (s *MemoryStore) ListChirpEntities(ctx context.Context, chirpIDs []uint) (map[uint]ChirpEntities, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := make(map[uint]ChirpEntities)
+	for _, id := range chirpIDs {
+		chirp, ok := s.chirps[id]
+		if !ok {
+			continue
+		}
+		if e := extractEntities(&chirp); len(e.Hashtags) > 0 || len(e.Mentions) > 0 {
+			found[id] = e
+		}
+	}
+	return found, nil
+}
+
+func (s *MemoryStore) ListHashtagChirps(ctx context.Context, filter HashtagFilter) ([]models.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var chirps []models.Chirp
+	for _, chirp := range s.chirps {
+		if filter.After != nil && !chirpAfter(chirp, *filter.After, true) {
+			continue
+		}
+		if slices.Contains(entities.Hashtags(chirp.Body), filter.Tag) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirpAfter(chirps[j], ChirpCursor{CreatedAt: chirps[i].CreatedAt, ID: chirps[i].ID}, true)
+	})
+	if filter.Limit > 0 && len(chirps) > filter.Limit {
+		chirps = chirps[:filter.Limit]
+	}
+	return chirps, nil
+}
+
+func (s *MemoryStore) TrendingHashtags(ctx context.Context, since time.Time, limit int) ([]TrendingHashtag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, chirp := range s.chirps {
+		if chirp.CreatedAt.Before(since) {
+			continue
+		}
+		for _, tag := range entities.Hashtags(chirp.Body) {
+			counts[tag]++
+		}
+	}
+	trending := make([]TrendingHashtag, 0, len(counts))
+	for tag, count := range counts {
+		trending = append(trending, TrendingHashtag{Tag: tag, ChirpCount: count})
+	}
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].ChirpCount != trending[j].ChirpCount {
+			return trending[i].ChirpCount > trending[j].ChirpCount
+		}
+		return trending[i].Tag < trending[j].Tag
+	})
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+	return trending, nil
+}
+
+func (s *MemoryStore) ListProfanityWords(ctx context.Context) ([]models.ProfanityWord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	words := make([]models.ProfanityWord, 0, len(s.profanity))
+	for _, word := range s.profanity {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool { return words[i].Word < words[j].Word })
+	return words, nil
+}
+
+func (s *MemoryStore) SaveProfanityWord(ctx context.Context, word *models.ProfanityWord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.profanity[word.Word]; ok {
+		word.CreatedAt = existing.CreatedAt
+	} else {
+		word.CreatedAt = now
+	}
+	word.UpdatedAt = now
+	s.profanity[word.Word] = *word
+	return nil
+}
+
+func (s *MemoryStore) DeleteProfanityWord(ctx context.Context, word string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.profanity, word)
+	return nil
+}
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.refreshTokens[token.Token]; ok {
+		return ErrDuplicate
+	}
+	s.refreshTokens[token.Token] = *token
+	return nil
+}
+
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refreshToken, ok := s.refreshTokens[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &refreshToken, nil
+}
+
+func (s *MemoryStore) UpdateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.refreshTokens[token.Token]; !ok {
+		return ErrNotFound
+	}
+	s.refreshTokens[token.Token] = *token
+	return nil
+}
+
+func (s *MemoryStore) RotateRefreshToken(ctx context.Context, old, next *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.refreshTokens[old.Token]
+	if !ok {
+		return ErrNotFound
+	}
+	if current.RevokedAt != nil {
+		return ErrConflict
+	}
+	if _, ok := s.refreshTokens[next.Token]; ok {
+		return ErrDuplicate
+	}
+	now := time.Now()
+	replacedBy := next.Token
+	current.RevokedAt = &now
+	current.UpdatedAt = now
+	current.ReplacedBy = &replacedBy
+	s.refreshTokens[old.Token] = current
+	s.refreshTokens[next.Token] = *next
+	*old = current
+	return nil
+}
+
+func (s *MemoryStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, token := range s.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			token.UpdatedAt = now
+			s.refreshTokens[key] = token
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[token.UserID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.resetTokens[token.TokenHash]; ok {
+		return ErrDuplicate
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	s.resetTokens[token.TokenHash] = *token
+	return nil
+}
+
+func (s *MemoryStore) GetPasswordResetUser(ctx context.Context, tokenHash string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.resetTokens[tokenHash]
+	if !ok || !time.Now().Before(token.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	user, ok := s.users[token.UserID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	token, ok := s.resetTokens[tokenHash]
+	if !ok || !now.Before(token.ExpiresAt) {
+		return 0, ErrNotFound
+	}
+	user, ok := s.users[token.UserID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	for key, other := range s.resetTokens {
+		if other.UserID == token.UserID {
+			delete(s.resetTokens, key)
+		}
+	}
+	user.HashedPassword = hashedPassword
+	user.UpdatedAt = now
+	s.users[user.ID] = user
+	for key, refreshToken := range s.refreshTokens {
+		if refreshToken.UserID == token.UserID && refreshToken.RevokedAt == nil {
+			refreshToken.RevokedAt = &now
+			refreshToken.UpdatedAt = now
+			s.refreshTokens[key] = refreshToken
+		}
+	}
+	return token.UserID, nil
+}
+
+func (s *MemoryStore) CreateEmailVerificationToken(ctx context.Context, token *models.EmailVerificationToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[token.UserID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.verifyTokens[token.TokenHash]; ok {
+		return ErrDuplicate
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	s.verifyTokens[token.TokenHash] = *token
+	return nil
+}
+
+func (s *MemoryStore) VerifyEmail(ctx context.Context, tokenHash string) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	token, ok := s.verifyTokens[tokenHash]
+	if !ok || !now.Before(token.ExpiresAt) {
+		return 0, ErrNotFound
+	}
+	user, ok := s.users[token.UserID]
+	if !ok || user.Email != token.Email {
+		return 0, ErrNotFound
+	}
+	user.EmailVerifiedAt = &now
+	s.users[user.ID] = user
+	for key, other := range s.verifyTokens {
+		if other.UserID == token.UserID {
+			delete(s.verifyTokens, key)
+		}
+	}
+	return token.UserID, nil
+}
+
+func (s *MemoryStore) GetTOTPCredential(ctx context.Context, userID uint) (*models.TOTPCredential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	credential, ok := s.totp[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &credential, nil
+}
+
+func (s *MemoryStore) SaveTOTPCredential(ctx context.Context, credential *models.TOTPCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[credential.UserID]; !ok {
+		return ErrNotFound
+	}
+	if existing, ok := s.totp[credential.UserID]; ok && existing.EnabledAt != nil {
+		return ErrConflict
+	}
+	now := time.Now()
+	credential.CreatedAt = now
+	credential.UpdatedAt = now
+	s.totp[credential.UserID] = *credential
+	return nil
+}
+
+func (s *MemoryStore) EnableTOTP(ctx context.Context, userID uint, step int64, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credential, ok := s.totp[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if credential.EnabledAt != nil {
+		return ErrConflict
+	}
+	now := time.Now()
+	credential.EnabledAt = &now
+	credential.LastUsedStep = step
+	credential.UpdatedAt = now
+	s.totp[userID] = credential
+	codes := make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes[hash] = true
+	}
+	s.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (s *MemoryStore) UseTOTPStep(ctx context.Context, userID uint, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credential, ok := s.totp[userID]
+	if !ok || credential.EnabledAt == nil || credential.LastUsedStep >= step {
+		return ErrConflict
+	}
+	credential.LastUsedStep = step
+	s.totp[userID] = credential
+	return nil
+}
+
+func (s *MemoryStore) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recoveryCodes[userID][codeHash] {
+		return ErrNotFound
+	}
+	delete(s.recoveryCodes[userID], codeHash)
+	return nil
+}
+
+func (s *MemoryStore) DeleteTOTP(ctx context.Context, userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totp, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
+
+type loginKey struct {
+	scope, subject string
+}
+
+func (s *MemoryStore) GetLoginAttempt(ctx context.Context, scope, subject string) (*models.LoginAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	attempt, ok := s.loginAttempts[loginKey{scope, subject}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &attempt, nil
+}
+
+func (s *MemoryStore) RecordLoginFailure(ctx context.Context, scope, subject string, now, forgetBefore time.Time) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := loginKey{scope, subject}
+	attempt, ok := s.loginAttempts[key]
+	if !ok || attempt.LastFailedAt.Before(forgetBefore) {
+		attempt = models.LoginAttempt{Scope: scope, Subject: subject}
+	}
+	attempt.Failures++
+	attempt.LastFailedAt = now
+	s.loginAttempts[key] = attempt
+	return &attempt, nil
+}
+
+func (s *MemoryStore) ForgiveLoginFailures(ctx context.Context, scope, subject string, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := loginKey{scope, subject}
+	attempt, ok := s.loginAttempts[key]
+	if !ok {
+		return nil
+	}
+	attempt.Failures = max(attempt.Failures-n, 0)
+	s.loginAttempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryStore) LockLogin(ctx context.Context, scope, subject string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := loginKey{scope, subject}
+	attempt, ok := s.loginAttempts[key]
+	if !ok || (attempt.LockedUntil != nil && !attempt.LockedUntil.Before(until)) {
+		return nil
+	}
+	attempt.LockedUntil = &until
+	s.loginAttempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryStore) ListLoginLockouts(ctx context.Context, now time.Time) ([]models.LoginAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var attempts []models.LoginAttempt
+	for _, attempt := range s.loginAttempts {
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			attempts = append(attempts, attempt)
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		a, b := attempts[i], attempts[j]
+		if !a.LockedUntil.Equal(*b.LockedUntil) {
+			return a.LockedUntil.After(*b.LockedUntil)
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		return a.Subject < b.Subject
+	})
+	return attempts, nil
+}
+
+func (s *MemoryStore) ClearLoginAttempts(ctx context.Context, scope, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := loginKey{scope, subject}
+	if _, ok := s.loginAttempts[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.loginAttempts, key)
+	return nil
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/search"
+)
+
+// sqliteIndex is the in-process full-text index GormStore uses on SQLite.
+// It is filled from the chirps table on the first search and then kept up
+// to date by the store's own writes, so it assumes this process is the
+// only writer, as it is for a local SQLite file.
+type sqliteIndex struct {
+	mu     sync.Mutex
+	loaded bool
+	index  *search.Index
+}
+
+func (s *GormStore) SearchChirps(ctx context.Context, q ChirpSearch) ([]ChirpMatch, error) {
+	switch s.db.Dialector.Name() {
+	case DialectMySQL:
+		return s.searchChirpsSQL(ctx, q, "MATCH(body) AGAINST (? IN BOOLEAN MODE)", "", mysqlBooleanQuery(q.Query))
+	case DialectPostgres:
+		// The expression must match the one idx_chirps_body_search was
+		// built on for the index to be used.
+		const vector = "to_tsvector('simple', body)"
+		return s.searchChirpsSQL(ctx, q, "ts_rank("+vector+", to_tsquery('simple', ?))", vector+" @@ to_tsquery('simple', ?)", postgresTSQuery(q.Query))
+	}
+	return s.searchChirpsIndexed(ctx, q)
+}
+
+// searchChirpsSQL runs a search on a database with its own full-text index.
+// score ranks rows; match filters them and defaults to score when empty.
+func (s *GormStore) searchChirpsSQL(ctx context.Context, q ChirpSearch, score, match, arg string) ([]ChirpMatch, error) {
+	if match == "" {
+		match = score
+	}
+	query := s.db.WithContext(ctx).Model(&models.Chirp{}).
+		Select("chirps.*, "+score+" AS score", arg).
+		Where(match, arg)
+	if q.AuthorID != 0 {
+		query = query.Where("user_id = ?", q.AuthorID)
+	}
+	query = query.Order("score DESC").Order("id DESC")
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	var matches []ChirpMatch
+	if err := query.Scan(&matches).Error; err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+func (s *GormStore) searchChirpsIndexed(ctx context.Context, q ChirpSearch) ([]ChirpMatch, error) {
+	if err := s.loadIndex(ctx); err != nil {
+		return nil, err
+	}
+	hits := s.textIndex.index.Search(q.Query)
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	query := s.db.WithContext(ctx).Where("id IN ?", ids)
+	if q.AuthorID != 0 {
+		query = query.Where("user_id = ?", q.AuthorID)
+	}
+	var chirps []models.Chirp
+	if err := query.Find(&chirps).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Chirp, len(chirps))
+	for _, chirp := range chirps {
+		byID[chirp.ID] = chirp
+	}
+
+	var matches []ChirpMatch
+	for _, hit := range hits {
+		chirp, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		matches = append(matches, ChirpMatch{Chirp: chirp, Score: hit.Score})
+		if q.Limit > 0 && len(matches) == q.Limit {
+			break
+		}
+	}
+	return matches, nil
+}
+
+func (s *GormStore) loadIndex(ctx context.Context) error {
+	s.textIndex.mu.Lock()
+	defer s.textIndex.mu.Unlock()
+	if s.textIndex.loaded {
+		return nil
+	}
+	var chirps []models.Chirp
+	if err := s.db.WithContext(ctx).Select("id", "body").Find(&chirps).Error; err != nil {
+		return err
+	}
+	for _, chirp := range chirps {
+		s.textIndex.index.Add(chirp.ID, chirp.Body)
+	}
+	s.textIndex.loaded = true
+	return nil
+}
+
+// indexChirp and unindexChirp keep a loaded index in step with writes. An
+// index that has not been loaded yet will pick the change up when it is.
+func (s *GormStore) indexChirp(chirp *models.Chirp) {
+	s.textIndex.mu.Lock()
+	defer s.textIndex.mu.Unlock()
+	if s.textIndex.loaded {
+		s.textIndex.index.Add(chirp.ID, chirp.Body)
+	}
+}
+
+func (s *GormStore) unindexChirp(id uint) {
+	s.textIndex.mu.Lock()
+	defer s.textIndex.mu.Unlock()
+	if s.textIndex.loaded {
+		s.textIndex.index.Remove(id)
+	}
+}
+
+func (s *GormStore) resetIndex() {
+	s.textIndex.mu.Lock()
+	defer s.textIndex.mu.Unlock()
+	s.textIndex.index.Reset()
+	s.textIndex.loaded = false
+}
+
+// mysqlBooleanQuery renders q for MATCH ... AGAINST in boolean mode, where
+// every clause is required. Query words only hold letters and digits, so
+// nothing needs escaping.
+func mysqlBooleanQuery(q search.Query) string {
+	var clauses []string
+	for _, t := range q.Terms {
+		clauses = append(clauses, "+"+t)
+	}
+	for _, p := range q.Prefixes {
+		clauses = append(clauses, "+"+p+"*")
+	}
+	for _, phrase := range q.Phrases {
+		clauses = append(clauses, `+"`+strings.Join(phrase, " ")+`"`)
+	}
+	return strings.Join(clauses, " ")
+}
+
+// postgresTSQuery renders q for to_tsquery, using <-> to keep phrase words
+// adjacent and :* for prefixes.
+func postgresTSQuery(q search.Query) string {
+	var clauses []string
+	for _, t := range q.Terms {
+		clauses = append(clauses, "'"+t+"'")
+	}
+	for _, p := range q.Prefixes {
+		clauses = append(clauses, "'"+p+"':*")
+	}
+	for _, phrase := range q.Phrases {
+		quoted := make([]string, len(phrase))
+		for i, w := range phrase {
+			quoted[i] = "'" + w + "'"
+		}
+		clauses = append(clauses, "("+strings.Join(quoted, " <-> ")+")")
+	}
+	return strings.Join(clauses, " & ")
+}
@@ -0,0 +1,336 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/search"
+)
+
+var (
+	ErrNotFound  = errors.New("record not found")
+	ErrDuplicate = errors.New("record already exists")
+	ErrConflict  = errors.New("record was changed concurrently")
+)
+
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByID(ctx context.Context, id uint) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteAllUsers(ctx context.Context) error
+}
+
+// ChirpCursor is the position of a chirp in the (created_at, id) listing
+// order. The id breaks ties between chirps created in the same instant.
+type ChirpCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+type ChirpFilter struct {
+	AuthorID uint
+	// Descending lists newest chirps first.
+	Descending bool
+	// Flagged limits the listing to chirps held for review.
+	Flagged bool
+	// After, when set, starts the listing just past that chirp in the
+	// requested order.
+	After *ChirpCursor
+	// Limit caps the number of chirps returned; zero means no cap.
+	Limit int
+}
+
+// ReplyFilter selects one level of a thread: replies to any of ParentIDs.
+type ReplyFilter struct {
+	ParentIDs []uint
+	// After, when set, starts every parent's replies just past that chirp.
+	After *ChirpCursor
+	// PerParent caps the replies returned for each parent and Limit those
+	// returned in all; zero means no cap.
+	PerParent int
+	Limit     int
+}
+
+type ChirpSearch struct {
+	Query    search.Query
+	AuthorID uint
+	// Limit caps the number of matches returned; zero means no cap.
+	Limit int
+}
+
+// ChirpMatch is a chirp found by SearchChirps. Scores are only comparable
+// within one search on one backend.
+type ChirpMatch struct {
+	Chirp models.Chirp `gorm:"embedded"`
+	Score float64
+}
+
+type ChirpStore interface {
+	// CreateChirp stores chirp and the hashtags and mentions in its body.
+	// A chirp without a ConversationID starts a new conversation; a reply
+	// also bumps its parent's ReplyCount and a rechirp or quote its
+	// original's ShareCount. A user rechirping the same chirp twice gets
+	// ErrDuplicate.
+	CreateChirp(ctx context.Context, chirp *models.Chirp) error
+	GetChirpByID(ctx context.Context, id uint) (*models.Chirp, error)
+	// GetChirpsByIDs returns the chirps among ids that exist, in no
+	// particular order.
+	GetChirpsByIDs(ctx context.Context, ids []uint) ([]models.Chirp, error)
+	// GetRechirp returns the user's rechirp of chirpID.
+	GetRechirp(ctx context.Context, userID, chirpID uint) (*models.Chirp, error)
+	ListChirps(ctx context.Context, filter ChirpFilter) ([]models.Chirp, error)
+	// ListAncestors returns the chirps chirpID replies to, from the start
+	// of its conversation down to its parent. The chain stops short at a
+	// deleted chirp.
+	ListAncestors(ctx context.Context, chirpID uint) ([]models.Chirp, error)
+	// ListReplies returns direct replies to the chirps in filter.ParentIDs,
+	// grouped by parent id and oldest first within each parent.
+	ListReplies(ctx context.Context, filter ReplyFilter) ([]models.Chirp, error)
+	// SearchChirps returns the chirps matching the search, most relevant
+	// first.
+	SearchChirps(ctx context.Context, search ChirpSearch) ([]ChirpMatch, error)
+	// EditChirp replaces chirp's body and its entities, keeping the old
+	// body as a revision, and updates chirp in place. It returns ErrConflict if the chirp was
+	// changed since it was read.
+	EditChirp(ctx context.Context, chirp *models.Chirp, body string) error
+	// ListChirpRevisions returns a chirp's earlier bodies, oldest first.
+	ListChirpRevisions(ctx context.Context, chirpID uint) ([]models.ChirpRevision, error)
+	// SetChirpFlagged holds a chirp for review or clears it.
+	SetChirpFlagged(ctx context.Context, id uint, flagged bool) error
+	DeleteChirp(ctx context.Context, id uint) error
+}
+
+// LikeFilter selects a page of the chirps a user liked, most recent like
+// first. After is a position in that order: when the like was made and the
+// liked chirp's id.
+type LikeFilter struct {
+	UserID uint
+	After  *ChirpCursor
+	// Limit caps the number of chirps returned; zero means no cap.
+	Limit int
+}
+
+// LikedChirp is a chirp returned by ListLikedChirps and when it was liked.
+type LikedChirp struct {
+	Chirp   models.Chirp `gorm:"embedded"`
+	LikedAt time.Time
+}
+
+type LikeStore interface {
+	// LikeChirp records that the user likes the chirp and bumps its
+	// LikeCount. Liking a chirp twice is not an error.
+	LikeChirp(ctx context.Context, userID, chirpID uint) error
+	// UnlikeChirp removes a like. Removing one that does not exist is not
+	// an error.
+	UnlikeChirp(ctx context.Context, userID, chirpID uint) error
+	// LikedChirpIDs reports which of chirpIDs the user has liked.
+	LikedChirpIDs(ctx context.Context, userID uint, chirpIDs []uint) (map[uint]bool, error)
+	ListLikedChirps(ctx context.Context, filter LikeFilter) ([]LikedChirp, error)
+}
+
+// FollowFilter selects a page of a user's followers or of the users they
+// follow, most recent follow first. After is a position in that order:
+// when the follow was made and the other user's id.
+type FollowFilter struct {
+	UserID uint
+	After  *ChirpCursor
+	// Limit caps the number of users returned; zero means no cap.
+	Limit int
+}
+
+// FollowedUser is the other side of a follow and when it was made.
+type FollowedUser struct {
+	User       models.User `gorm:"embedded"`
+	FollowedAt time.Time
+}
+
+type FollowStore interface {
+	// Follow makes followerID follow followeeID. Following twice is not an
+	// error.
+	Follow(ctx context.Context, followerID, followeeID uint) error
+	// Unfollow removes a follow and returns how many followers followeeID
+	// has left. It returns ErrNotFound if there was no such follow.
+	Unfollow(ctx context.Context, followerID, followeeID uint) (int, error)
+	ListFollowers(ctx context.Context, filter FollowFilter) ([]FollowedUser, error)
+	ListFollowing(ctx context.Context, filter FollowFilter) ([]FollowedUser, error)
+}
+
+// TimelineFilter selects a page of a user's home timeline: their own
+// chirps and those of everyone they follow, newest first.
+type TimelineFilter struct {
+	UserID uint
+	// Precomputed reads the stored timeline kept by DeliverChirp instead of
+	// assembling it from the follow graph.
+	Precomputed bool
+	// FanoutMaxFollowers, with Precomputed, is the cap DeliverChirp was
+	// given: chirps by followed authors with more followers than that are
+	// read from the follow graph and merged in. Zero means no cap.
+	FanoutMaxFollowers int
+	After              *ChirpCursor
+	// Limit caps the number of chirps returned; zero means no cap.
+	Limit int
+}
+
+type TimelineStore interface {
+	ListTimeline(ctx context.Context, filter TimelineFilter) ([]models.Chirp, error)
+	// DeliverChirp adds chirp to the stored timeline of its author and,
+	// unless they have more than maxFollowers followers, of everyone
+	// following them. Zero means no cap.
+	DeliverChirp(ctx context.Context, chirp *models.Chirp, maxFollowers int) error
+	// BackfillTimeline adds up to limit of authorID's latest chirps to
+	// userID's stored timeline, skipping any already there.
+	BackfillTimeline(ctx context.Context, userID, authorID uint, limit int) error
+	// BackfillTimelines does what BackfillTimeline does for every user,
+	// from their own chirps and those of each author they follow who has
+	// at most maxFollowers followers. It fills in stored timelines after
+	// timelines start fanning out on write.
+	BackfillTimelines(ctx context.Context, limit, maxFollowers int) error
+	// BackfillFollowerTimelines does what BackfillTimeline does for every
+	// follower of authorID. It catches them up on the chirps DeliverChirp
+	// left to ListTimeline while authorID had too many followers, once
+	// they are back under the cap and ListTimeline stops merging them in.
+	BackfillFollowerTimelines(ctx context.Context, authorID uint, limit int) error
+	// PruneTimeline removes authorID's chirps from userID's stored timeline.
+	PruneTimeline(ctx context.Context, userID, authorID uint) error
+}
+
+// ChirpEntities are the hashtags and mentions parsed out of a chirp's
+// body, each in the order they appear.
+type ChirpEntities struct {
+	Hashtags []models.ChirpHashtag
+	Mentions []models.ChirpMention
+}
+
+// HashtagFilter selects a page of the chirps using a tag, newest first.
+type HashtagFilter struct {
+	Tag   string
+	After *ChirpCursor
+	// Limit caps the number of chirps returned; zero means no cap.
+	Limit int
+}
+
+// TrendingHashtag is a tag and the number of chirps that used it.
+type TrendingHashtag struct {
+	Tag        string
+	ChirpCount int
+}
+
+// EntityStore reads the entities CreateChirp and EditChirp extract from
+// chirp bodies.
+type EntityStore interface {
+	// ListChirpEntities returns the entities of those of chirpIDs that have
+	// any.
+	ListChirpEntities(ctx context.Context, chirpIDs []uint) (map[uint]ChirpEntities, error)
+	ListHashtagChirps(ctx context.Context, filter HashtagFilter) ([]models.Chirp, error)
+	// TrendingHashtags ranks the tags of chirps posted since then by how
+	// many chirps used them, ties broken alphabetically.
+	TrendingHashtags(ctx context.Context, since time.Time, limit int) ([]TrendingHashtag, error)
+}
+
+type ProfanityStore interface {
+	ListProfanityWords(ctx context.Context) ([]models.ProfanityWord, error)
+	// SaveProfanityWord adds a word or changes its action.
+	SaveProfanityWord(ctx context.Context, word *models.ProfanityWord) error
+	// DeleteProfanityWord removes a word. Removing one that is not stored
+	// is not an error.
+	DeleteProfanityWord(ctx context.Context, word string) error
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error)
+	UpdateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// RotateRefreshToken revokes old, marks it as replaced by next and stores
+	// next, all or nothing. It returns ErrConflict if old was already revoked.
+	RotateRefreshToken(ctx context.Context, old, next *models.RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+}
+
+type PasswordResetStore interface {
+	CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error
+	// GetPasswordResetUser returns the user a live reset token with
+	// tokenHash was issued to, leaving the token usable. It returns
+	// ErrNotFound if there is no such token.
+	GetPasswordResetUser(ctx context.Context, tokenHash string) (*models.User, error)
+	// ResetPassword gives the user a live reset token with tokenHash was
+	// issued to hashedPassword, deletes every reset token of theirs and
+	// revokes all their refresh tokens, all or nothing. It returns the
+	// user's id, or ErrNotFound if no live token has tokenHash.
+	ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (uint, error)
+}
+
+type EmailVerificationStore interface {
+	CreateEmailVerificationToken(ctx context.Context, token *models.EmailVerificationToken) error
+	// VerifyEmail marks the user a live verification token with tokenHash
+	// was issued to as verified and deletes every verification token of
+	// theirs, all or nothing. It returns the user's id, or ErrNotFound if
+	// no live token has tokenHash or the user's address has changed since
+	// it was sent.
+	VerifyEmail(ctx context.Context, tokenHash string) (uint, error)
+}
+
+// TOTPStore keeps users' authenticator secrets and recovery codes.
+type TOTPStore interface {
+	// GetTOTPCredential returns ErrNotFound if the user never enrolled.
+	GetTOTPCredential(ctx context.Context, userID uint) (*models.TOTPCredential, error)
+	// SaveTOTPCredential stores a secret that is not enabled yet, replacing
+	// one the user enrolled earlier but never enabled. It returns
+	// ErrConflict if the user already has TOTP enabled.
+	SaveTOTPCredential(ctx context.Context, credential *models.TOTPCredential) error
+	// EnableTOTP turns on the user's credential, records the code for step
+	// as used and replaces their recovery codes with codeHashes, all or
+	// nothing. It returns ErrNotFound if the user has no credential and
+	// ErrConflict if it is already enabled.
+	EnableTOTP(ctx context.Context, userID uint, step int64, codeHashes []string) error
+	// UseTOTPStep records that the code for step was used. It returns
+	// ErrConflict if a code for step or a later one was already used.
+	UseTOTPStep(ctx context.Context, userID uint, step int64) error
+	// UseRecoveryCode deletes one of the user's recovery codes. It returns
+	// ErrNotFound if they have none with codeHash.
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error
+	// DeleteTOTP removes the user's credential and recovery codes.
+	DeleteTOTP(ctx context.Context, userID uint) error
+}
+
+// LoginAttemptStore counts failed logins per scope and subject, such as
+// per email address and per IP address.
+type LoginAttemptStore interface {
+	// GetLoginAttempt returns ErrNotFound if subject has no failures on
+	// record.
+	GetLoginAttempt(ctx context.Context, scope, subject string) (*models.LoginAttempt, error)
+	// RecordLoginFailure counts a failure at now and returns the updated
+	// record. A record whose last failure came before forgetBefore is
+	// started over, lockout included.
+	RecordLoginFailure(ctx context.Context, scope, subject string, now, forgetBefore time.Time) (*models.LoginAttempt, error)
+	// ForgiveLoginFailures takes n failures off subject's count, stopping
+	// at zero. A lockout already in force stays.
+	ForgiveLoginFailures(ctx context.Context, scope, subject string, n int) error
+	// LockLogin locks subject out until until, unless it is already locked
+	// out for longer.
+	LockLogin(ctx context.Context, scope, subject string, until time.Time) error
+	// ListLoginLockouts returns the records locked out beyond now, longest
+	// lockout first.
+	ListLoginLockouts(ctx context.Context, now time.Time) ([]models.LoginAttempt, error)
+	// ClearLoginAttempts forgets subject's failures and lifts its lockout.
+	// It returns ErrNotFound if there is nothing to clear.
+	ClearLoginAttempts(ctx context.Context, scope, subject string) error
+}
+
+// Store groups every repository the handlers depend on.
+type Store interface {
+	UserStore
+	ChirpStore
+	LikeStore
+	FollowStore
+	TimelineStore
+	EntityStore
+	ProfanityStore
+	RefreshTokenStore
+	PasswordResetStore
+	EmailVerificationStore
+	TOTPStore
+	LoginAttemptStore
+}
@@ -0,0 +1,1255 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/migrations"
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"github.com/G0SU19O2/Chirpy/internal/search"
+)
+
+// forEachStore runs fn against every Store implementation so the in-memory
+// store stays a faithful stand-in for the database-backed one.
+func forEachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, newSQLiteStore(t))
+	})
+}
+
+func newSQLiteStore(t *testing.T) *GormStore {
+	t.Helper()
+	db, err := Open("sqlite://" + filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("migrations.New returned error: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return NewGormStore(db)
+}
+
+func TestStoreUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		if user.ID == 0 {
+			t.Fatal("expected CreateUser to assign an ID")
+		}
+
+		if err := s.CreateUser(ctx, &models.User{Email: "a@example.com"}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("expected ErrDuplicate for repeated email, got %v", err)
+		}
+
+		found, err := s.GetUserByEmail(ctx, "a@example.com")
+		if err != nil {
+			t.Fatalf("GetUserByEmail returned error: %v", err)
+		}
+		if found.ID != user.ID {
+			t.Errorf("expected user %d, got %d", user.ID, found.ID)
+		}
+
+		found.IsChirpyRed = true
+		if err := s.UpdateUser(ctx, found); err != nil {
+			t.Fatalf("UpdateUser returned error: %v", err)
+		}
+		reloaded, err := s.GetUserByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID returned error: %v", err)
+		}
+		if !reloaded.IsChirpyRed {
+			t.Error("expected update to be persisted")
+		}
+
+		if _, err := s.GetUserByID(ctx, 999); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestStoreChirps(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		first := &models.User{Email: "first@example.com", HashedPassword: "hash"}
+		second := &models.User{Email: "second@example.com", HashedPassword: "hash"}
+		for _, user := range []*models.User{first, second} {
+			if err := s.CreateUser(ctx, user); err != nil {
+				t.Fatalf("CreateUser returned error: %v", err)
+			}
+		}
+
+		for _, userID := range []uint{first.ID, second.ID, first.ID} {
+			if err := s.CreateChirp(ctx, &models.Chirp{Body: "hello", UserID: userID}); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+		}
+
+		all, err := s.ListChirps(ctx, ChirpFilter{})
+		if err != nil {
+			t.Fatalf("ListChirps returned error: %v", err)
+		}
+		if len(all) != 3 {
+			t.Errorf("expected 3 chirps, got %d", len(all))
+		}
+
+		byAuthor, err := s.ListChirps(ctx, ChirpFilter{AuthorID: first.ID})
+		if err != nil {
+			t.Fatalf("ListChirps returned error: %v", err)
+		}
+		if len(byAuthor) != 2 {
+			t.Errorf("expected 2 chirps for first author, got %d", len(byAuthor))
+		}
+
+		if err := s.DeleteChirp(ctx, all[0].ID); err != nil {
+			t.Fatalf("DeleteChirp returned error: %v", err)
+		}
+		if _, err := s.GetChirpByID(ctx, all[0].ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected deleted chirp to be gone, got %v", err)
+		}
+		if err := s.DeleteChirp(ctx, all[0].ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+		}
+	})
+}
+
+func TestStoreListChirpsPagination(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+
+		// Three chirps share a timestamp so the id has to break the tie.
+		base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		offsets := []time.Duration{time.Second, 0, -time.Second, 0, 0}
+		ids := make([]uint, len(offsets))
+		for i, offset := range offsets {
+			chirp := &models.Chirp{Body: "chirp", UserID: user.ID}
+			chirp.CreatedAt = base.Add(offset)
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+			ids[i] = chirp.ID
+		}
+		ascending := []uint{ids[2], ids[1], ids[3], ids[4], ids[0]}
+
+		for _, descending := range []bool{false, true} {
+			var got []uint
+			filter := ChirpFilter{Descending: descending, Limit: 2}
+			for page := 0; page < 5; page++ {
+				chirps, err := s.ListChirps(ctx, filter)
+				if err != nil {
+					t.Fatalf("ListChirps returned error: %v", err)
+				}
+				if len(chirps) == 0 {
+					break
+				}
+				for _, c := range chirps {
+					got = append(got, c.ID)
+				}
+				last := chirps[len(chirps)-1]
+				filter.After = &ChirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+			}
+
+			expected := ascending
+			if descending {
+				expected = make([]uint, len(ascending))
+				for i, id := range ascending {
+					expected[len(ascending)-1-i] = id
+				}
+			}
+			if len(got) != len(expected) {
+				t.Fatalf("descending=%v: expected %v, got %v", descending, expected, got)
+			}
+			for i := range expected {
+				if got[i] != expected[i] {
+					t.Fatalf("descending=%v: expected %v, got %v", descending, expected, got)
+				}
+			}
+		}
+	})
+}
+
+func TestStoreSearchChirps(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		first := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		second := &models.User{Email: "b@example.com", HashedPassword: "hash"}
+		for _, u := range []*models.User{first, second} {
+			if err := s.CreateUser(ctx, u); err != nil {
+				t.Fatalf("CreateUser returned error: %v", err)
+			}
+		}
+		bodies := []struct {
+			author *models.User
+			body   string
+		}{
+			{first, "good morning coffee"},
+			{second, "coffee all day"},
+			{first, "tea time"},
+		}
+		ids := make([]uint, len(bodies))
+		for i, b := range bodies {
+			chirp := &models.Chirp{Body: b.body, UserID: b.author.ID}
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+			ids[i] = chirp.ID
+		}
+
+		find := func(q string, authorID uint) []uint {
+			t.Helper()
+			query, err := search.Parse(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			matches, err := s.SearchChirps(ctx, ChirpSearch{Query: query, AuthorID: authorID})
+			if err != nil {
+				t.Fatalf("SearchChirps returned error: %v", err)
+			}
+			var got []uint
+			for _, m := range matches {
+				got = append(got, m.Chirp.ID)
+			}
+			return got
+		}
+
+		if got := find("coffee", 0); len(got) != 2 {
+			t.Errorf("expected 2 coffee chirps, got %v", got)
+		}
+		if got := find("coffee", second.ID); len(got) != 1 || got[0] != ids[1] {
+			t.Errorf("expected only the second author's chirp, got %v", got)
+		}
+
+		if err := s.DeleteChirp(ctx, ids[1]); err != nil {
+			t.Fatal(err)
+		}
+		if got := find("coffee", 0); len(got) != 1 || got[0] != ids[0] {
+			t.Errorf("expected deleted chirp to drop out of results, got %v", got)
+		}
+
+		chirp := &models.Chirp{Body: "more coffee", UserID: second.ID}
+		if err := s.CreateChirp(ctx, chirp); err != nil {
+			t.Fatal(err)
+		}
+		if got := find("coffee", 0); len(got) != 2 {
+			t.Errorf("expected new chirp to be searchable, got %v", got)
+		}
+	})
+}
+
+func TestStoreEditChirp(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		chirp := &models.Chirp{Body: "first", UserID: user.ID}
+		if err := s.CreateChirp(ctx, chirp); err != nil {
+			t.Fatalf("CreateChirp returned error: %v", err)
+		}
+
+		stale, err := s.GetChirpByID(ctx, chirp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, body := range []string{"second", "third"} {
+			current, err := s.GetChirpByID(ctx, chirp.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.EditChirp(ctx, current, body); err != nil {
+				t.Fatalf("EditChirp returned error: %v", err)
+			}
+			if current.Body != body || current.EditedAt == nil {
+				t.Errorf("expected chirp to be updated in place, got %+v", current)
+			}
+		}
+
+		if err := s.EditChirp(ctx, stale, "lost update"); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected ErrConflict editing a stale copy, got %v", err)
+		}
+
+		reloaded, err := s.GetChirpByID(ctx, chirp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloaded.Body != "third" || reloaded.EditedAt == nil {
+			t.Errorf("expected edited body to be persisted, got %+v", reloaded)
+		}
+
+		revisions, err := s.ListChirpRevisions(ctx, chirp.ID)
+		if err != nil {
+			t.Fatalf("ListChirpRevisions returned error: %v", err)
+		}
+		if len(revisions) != 2 || revisions[0].Body != "first" || revisions[1].Body != "second" {
+			t.Errorf("expected revisions [first second], got %+v", revisions)
+		}
+	})
+}
+
+func TestStoreConversations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		root := &models.Chirp{Body: "root", UserID: user.ID}
+		if err := s.CreateChirp(ctx, root); err != nil {
+			t.Fatalf("CreateChirp returned error: %v", err)
+		}
+		if root.ConversationID != root.ID {
+			t.Errorf("expected a new chirp to start its own conversation, got %d for chirp %d", root.ConversationID, root.ID)
+		}
+
+		reply := func(parent *models.Chirp, body string) *models.Chirp {
+			chirp := &models.Chirp{Body: body, UserID: user.ID, InReplyToID: &parent.ID, ConversationID: parent.ConversationID}
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+			return chirp
+		}
+		first := reply(root, "first")
+		second := reply(root, "second")
+		nested := reply(first, "nested")
+		if err := s.CreateChirp(ctx, &models.Chirp{Body: "elsewhere", UserID: user.ID}); err != nil {
+			t.Fatal(err)
+		}
+
+		stale, err := s.GetChirpByID(ctx, root.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stale.ReplyCount != 2 {
+			t.Errorf("expected 2 replies on root, got %d", stale.ReplyCount)
+		}
+		// Counting replies must not look like an edit of the parent.
+		if err := s.EditChirp(ctx, stale, "root edited"); err != nil {
+			t.Errorf("expected EditChirp to succeed after replies, got %v", err)
+		}
+
+		bodies := func(chirps []models.Chirp) string {
+			var out []string
+			for _, chirp := range chirps {
+				out = append(out, chirp.Body)
+			}
+			return strings.Join(out, ",")
+		}
+
+		ancestors, err := s.ListAncestors(ctx, nested.ID)
+		if err != nil {
+			t.Fatalf("ListAncestors returned error: %v", err)
+		}
+		if got := bodies(ancestors); got != "root edited,first" {
+			t.Errorf("expected the ancestors root first, got %q", got)
+		}
+
+		replies, err := s.ListReplies(ctx, ReplyFilter{ParentIDs: []uint{root.ID, first.ID}, PerParent: 1})
+		if err != nil {
+			t.Fatalf("ListReplies returned error: %v", err)
+		}
+		if got := bodies(replies); got != "first,nested" {
+			t.Errorf("expected one reply per parent, got %q", got)
+		}
+		replies, err = s.ListReplies(ctx, ReplyFilter{
+			ParentIDs: []uint{root.ID},
+			After:     &ChirpCursor{CreatedAt: first.CreatedAt, ID: first.ID},
+		})
+		if err != nil {
+			t.Fatalf("ListReplies returned error: %v", err)
+		}
+		if got := bodies(replies); got != "second" {
+			t.Errorf("expected the replies after the cursor, got %q", got)
+		}
+		replies, err = s.ListReplies(ctx, ReplyFilter{ParentIDs: []uint{root.ID, first.ID}, Limit: 2})
+		if err != nil {
+			t.Fatalf("ListReplies returned error: %v", err)
+		}
+		if got := bodies(replies); got != "first,second" {
+			t.Errorf("expected the limit to cap the whole level, got %q", got)
+		}
+
+		if err := s.DeleteChirp(ctx, second.ID); err != nil {
+			t.Fatalf("DeleteChirp returned error: %v", err)
+		}
+		reloaded, err := s.GetChirpByID(ctx, root.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloaded.ReplyCount != 1 {
+			t.Errorf("expected 1 reply on root after a delete, got %d", reloaded.ReplyCount)
+		}
+	})
+}
+
+func TestStoreLikes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		var chirps []*models.Chirp
+		for range 3 {
+			chirp := &models.Chirp{Body: "chirp", UserID: user.ID}
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+			chirps = append(chirps, chirp)
+		}
+
+		for _, chirp := range []*models.Chirp{chirps[0], chirps[2], chirps[2]} {
+			if err := s.LikeChirp(ctx, user.ID, chirp.ID); err != nil {
+				t.Fatalf("LikeChirp returned error: %v", err)
+			}
+		}
+		if err := s.LikeChirp(ctx, user.ID, 999); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound liking a missing chirp, got %v", err)
+		}
+
+		liked, err := s.GetChirpByID(ctx, chirps[2].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if liked.LikeCount != 1 {
+			t.Errorf("expected a repeated like to count once, got %d", liked.LikeCount)
+		}
+		// Likes must not look like an edit of the chirp.
+		if err := s.EditChirp(ctx, liked, "edited"); err != nil {
+			t.Errorf("expected EditChirp to succeed after a like, got %v", err)
+		}
+
+		ids, err := s.LikedChirpIDs(ctx, user.ID, []uint{chirps[0].ID, chirps[1].ID, chirps[2].ID})
+		if err != nil {
+			t.Fatalf("LikedChirpIDs returned error: %v", err)
+		}
+		if !ids[chirps[0].ID] || ids[chirps[1].ID] || !ids[chirps[2].ID] {
+			t.Errorf("expected chirps 0 and 2 liked, got %v", ids)
+		}
+
+		likes, err := s.ListLikedChirps(ctx, LikeFilter{UserID: user.ID, Limit: 1})
+		if err != nil {
+			t.Fatalf("ListLikedChirps returned error: %v", err)
+		}
+		if len(likes) != 1 {
+			t.Fatalf("expected one like on the first page, got %d", len(likes))
+		}
+		after := &ChirpCursor{CreatedAt: likes[0].LikedAt, ID: likes[0].Chirp.ID}
+		rest, err := s.ListLikedChirps(ctx, LikeFilter{UserID: user.ID, After: after})
+		if err != nil {
+			t.Fatalf("ListLikedChirps returned error: %v", err)
+		}
+		if len(rest) != 1 || rest[0].Chirp.ID == likes[0].Chirp.ID {
+			t.Errorf("expected the other like on the next page, got %+v", rest)
+		}
+
+		for range 2 {
+			if err := s.UnlikeChirp(ctx, user.ID, chirps[0].ID); err != nil {
+				t.Fatalf("UnlikeChirp returned error: %v", err)
+			}
+		}
+		unliked, err := s.GetChirpByID(ctx, chirps[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unliked.LikeCount != 0 {
+			t.Errorf("expected like count 0 after unliking, got %d", unliked.LikeCount)
+		}
+
+		if err := s.DeleteChirp(ctx, chirps[2].ID); err != nil {
+			t.Fatal(err)
+		}
+		if likes, err := s.ListLikedChirps(ctx, LikeFilter{UserID: user.ID}); err != nil || len(likes) != 0 {
+			t.Errorf("expected deleted chirps to drop out of likes, got %+v, %v", likes, err)
+		}
+	})
+}
+
+func TestStoreShares(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		original := &models.Chirp{Body: "original", UserID: user.ID}
+		if err := s.CreateChirp(ctx, original); err != nil {
+			t.Fatalf("CreateChirp returned error: %v", err)
+		}
+		rechirp := &models.Chirp{UserID: user.ID, RechirpOfID: &original.ID}
+		quote := &models.Chirp{Body: "look", UserID: user.ID, QuoteOfID: &original.ID}
+		for _, chirp := range []*models.Chirp{rechirp, quote} {
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+		}
+
+		again := &models.Chirp{UserID: user.ID, RechirpOfID: &original.ID}
+		if err := s.CreateChirp(ctx, again); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("expected ErrDuplicate for a second rechirp, got %v", err)
+		}
+
+		reloaded, err := s.GetChirpByID(ctx, original.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloaded.ShareCount != 2 {
+			t.Errorf("expected 2 shares, got %d", reloaded.ShareCount)
+		}
+
+		found, err := s.GetRechirp(ctx, user.ID, original.ID)
+		if err != nil || found.ID != rechirp.ID {
+			t.Errorf("expected rechirp %d, got %+v, %v", rechirp.ID, found, err)
+		}
+		if _, err := s.GetRechirp(ctx, user.ID, quote.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a chirp that was not rechirped, got %v", err)
+		}
+
+		if err := s.DeleteChirp(ctx, rechirp.ID); err != nil {
+			t.Fatal(err)
+		}
+		reloaded, err = s.GetChirpByID(ctx, original.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloaded.ShareCount != 1 {
+			t.Errorf("expected 1 share after deleting the rechirp, got %d", reloaded.ShareCount)
+		}
+		if err := s.CreateChirp(ctx, &models.Chirp{UserID: user.ID, RechirpOfID: &original.ID}); err != nil {
+			t.Errorf("expected rechirping again after a delete to succeed, got %v", err)
+		}
+
+		if err := s.DeleteChirp(ctx, original.ID); err != nil {
+			t.Fatal(err)
+		}
+		chirps, err := s.GetChirpsByIDs(ctx, []uint{original.ID, quote.ID})
+		if err != nil {
+			t.Fatalf("GetChirpsByIDs returned error: %v", err)
+		}
+		if len(chirps) != 1 || chirps[0].ID != quote.ID || chirps[0].QuoteOfID == nil || *chirps[0].QuoteOfID != original.ID {
+			t.Errorf("expected only the quote, still naming its deleted original, got %+v", chirps)
+		}
+	})
+}
+
+func TestStoreFollowsAndTimelines(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		var users []models.User
+		for _, name := range []string{"alice", "bob", "carol"} {
+			user := models.User{Email: name + "@example.com", HashedPassword: "hash"}
+			if err := s.CreateUser(ctx, &user); err != nil {
+				t.Fatalf("CreateUser returned error: %v", err)
+			}
+			users = append(users, user)
+		}
+		alice, bob, carol := users[0], users[1], users[2]
+		post := func(author models.User, body string) *models.Chirp {
+			chirp := &models.Chirp{Body: body, UserID: author.ID}
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+			if err := s.DeliverChirp(ctx, chirp, 0); err != nil {
+				t.Fatalf("DeliverChirp returned error: %v", err)
+			}
+			return chirp
+		}
+		bodies := func(filter TimelineFilter) string {
+			t.Helper()
+			chirps, err := s.ListTimeline(ctx, filter)
+			if err != nil {
+				t.Fatalf("ListTimeline returned error: %v", err)
+			}
+			var out []string
+			for _, chirp := range chirps {
+				out = append(out, chirp.Body)
+			}
+			return strings.Join(out, ",")
+		}
+
+		post(bob, "bob before")
+		for range 2 {
+			if err := s.Follow(ctx, alice.ID, bob.ID); err != nil {
+				t.Fatalf("Follow returned error: %v", err)
+			}
+		}
+		if err := s.Follow(ctx, alice.ID, carol.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Follow(ctx, carol.ID, 999); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound following a missing user, got %v", err)
+		}
+		if err := s.BackfillTimeline(ctx, alice.ID, bob.ID, 10); err != nil {
+			t.Fatalf("BackfillTimeline returned error: %v", err)
+		}
+		post(alice, "alice")
+		post(bob, "bob after")
+		post(carol, "carol")
+
+		following, err := s.ListFollowing(ctx, FollowFilter{UserID: alice.ID})
+		if err != nil {
+			t.Fatalf("ListFollowing returned error: %v", err)
+		}
+		if len(following) != 2 || following[0].User.ID != carol.ID || following[1].User.ID != bob.ID {
+			t.Errorf("expected alice to follow carol then bob, newest first, got %+v", following)
+		}
+		followers, err := s.ListFollowers(ctx, FollowFilter{UserID: bob.ID, Limit: 1})
+		if err != nil {
+			t.Fatalf("ListFollowers returned error: %v", err)
+		}
+		if len(followers) != 1 || followers[0].User.ID != alice.ID {
+			t.Errorf("expected alice as bob's only follower, got %+v", followers)
+		}
+
+		expected := "carol,bob after,alice,bob before"
+		for _, precomputed := range []bool{false, true} {
+			if got := bodies(TimelineFilter{UserID: alice.ID, Precomputed: precomputed}); got != expected {
+				t.Errorf("precomputed=%v: expected timeline %q, got %q", precomputed, expected, got)
+			}
+		}
+
+		page, err := s.ListTimeline(ctx, TimelineFilter{UserID: alice.ID, Precomputed: true, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		after := &ChirpCursor{CreatedAt: page[1].CreatedAt, ID: page[1].ID}
+		if got := bodies(TimelineFilter{UserID: alice.ID, Precomputed: true, After: after}); got != "alice,bob before" {
+			t.Errorf("expected the second page to continue the timeline, got %q", got)
+		}
+
+		if _, err := s.Unfollow(ctx, alice.ID, bob.ID); err != nil {
+			t.Fatalf("Unfollow returned error: %v", err)
+		}
+		if _, err := s.Unfollow(ctx, alice.ID, bob.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound unfollowing twice, got %v", err)
+		}
+		if err := s.PruneTimeline(ctx, alice.ID, bob.ID); err != nil {
+			t.Fatalf("PruneTimeline returned error: %v", err)
+		}
+		for _, precomputed := range []bool{false, true} {
+			if got := bodies(TimelineFilter{UserID: alice.ID, Precomputed: precomputed}); got != "carol,alice" {
+				t.Errorf("precomputed=%v: expected bob gone after unfollowing, got %q", precomputed, got)
+			}
+		}
+
+		if err := s.DeleteAllUsers(ctx); err != nil {
+			t.Fatalf("DeleteAllUsers returned error: %v", err)
+		}
+		if chirps, err := s.ListChirps(ctx, ChirpFilter{}); err != nil || len(chirps) != 0 {
+			t.Errorf("expected DeleteAllUsers to remove every chirp, got %d, %v", len(chirps), err)
+		}
+	})
+}
+
+func TestStoreTimelineFanoutCap(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		var users []models.User
+		for _, name := range []string{"alice", "bob", "carol", "dave"} {
+			user := models.User{Email: name + "@example.com", HashedPassword: "hash"}
+			if err := s.CreateUser(ctx, &user); err != nil {
+				t.Fatalf("CreateUser returned error: %v", err)
+			}
+			users = append(users, user)
+		}
+		alice, bob, carol, dave := users[0], users[1], users[2], users[3]
+		for _, f := range [][2]models.User{{alice, bob}, {carol, bob}, {alice, dave}} {
+			if err := s.Follow(ctx, f[0].ID, f[1].ID); err != nil {
+				t.Fatalf("Follow returned error: %v", err)
+			}
+		}
+		post := func(author models.User, body string, deliver bool) {
+			chirp := &models.Chirp{Body: body, UserID: author.ID}
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+			if !deliver {
+				return
+			}
+			if err := s.DeliverChirp(ctx, chirp, 1); err != nil {
+				t.Fatalf("DeliverChirp returned error: %v", err)
+			}
+		}
+		bodies := func(maxFollowers int) string {
+			t.Helper()
+			chirps, err := s.ListTimeline(ctx, TimelineFilter{UserID: alice.ID, Precomputed: true, FanoutMaxFollowers: maxFollowers})
+			if err != nil {
+				t.Fatalf("ListTimeline returned error: %v", err)
+			}
+			var out []string
+			for _, chirp := range chirps {
+				out = append(out, chirp.Body)
+			}
+			return strings.Join(out, ",")
+		}
+
+		// Posted before timelines fanned out on write.
+		post(alice, "alice early", false)
+		post(bob, "bob early", false)
+		post(dave, "dave early", false)
+		for range 2 {
+			if err := s.BackfillTimelines(ctx, 10, 1); err != nil {
+				t.Fatalf("BackfillTimelines returned error: %v", err)
+			}
+		}
+		if got := bodies(0); got != "dave early,alice early" {
+			t.Errorf("expected the backfill to skip bob, who has two followers, got %q", got)
+		}
+
+		post(bob, "bob late", true)
+		post(dave, "dave late", true)
+		if got := bodies(0); got != "dave late,dave early,alice early" {
+			t.Errorf("expected bob's chirps left out of the stored timeline, got %q", got)
+		}
+		if got := bodies(1); got != "dave late,bob late,dave early,bob early,alice early" {
+			t.Errorf("expected bob's chirps merged in on read, got %q", got)
+		}
+
+		// Back under the cap, bob's chirps are no longer merged in, so the
+		// ones posted while he was over it have to be copied over.
+		followers, err := s.Unfollow(ctx, carol.ID, bob.ID)
+		if err != nil {
+			t.Fatalf("Unfollow returned error: %v", err)
+		}
+		if followers != 1 {
+			t.Errorf("expected bob to have 1 follower left, got %d", followers)
+		}
+		if got := bodies(1); got != "dave late,dave early,alice early" {
+			t.Errorf("expected bob's chirps gone until the backfill, got %q", got)
+		}
+		for range 2 {
+			if err := s.BackfillFollowerTimelines(ctx, bob.ID, 10); err != nil {
+				t.Fatalf("BackfillFollowerTimelines returned error: %v", err)
+			}
+		}
+		if got := bodies(1); got != "dave late,bob late,dave early,bob early,alice early" {
+			t.Errorf("expected bob's chirps back in the stored timeline, got %q", got)
+		}
+		post(bob, "bob last", true)
+		if got := bodies(0); !strings.HasPrefix(got, "bob last,") {
+			t.Errorf("expected bob's chirps delivered once bob is back under the cap, got %q", got)
+		}
+	})
+}
+
+func TestStoreHashtagsAndMentions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := &models.User{Email: "tagger@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		post := func(body string, createdAt time.Time) *models.Chirp {
+			chirp := &models.Chirp{Body: body, UserID: user.ID}
+			chirp.CreatedAt = createdAt
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+			return chirp
+		}
+		now := time.Now()
+		old := post("#Go was trending", now.Add(-48*time.Hour))
+		first := post("#go #Go with @Alice", now.Add(-2*time.Hour))
+		second := post("#go and #rust", now.Add(-time.Hour))
+		third := post("#rust", now)
+
+		found, err := s.ListChirpEntities(ctx, []uint{first.ID, third.ID, 999})
+		if err != nil {
+			t.Fatalf("ListChirpEntities returned error: %v", err)
+		}
+		e := found[first.ID]
+		if len(e.Hashtags) != 2 || e.Hashtags[1].Tag != "go" || e.Hashtags[1].StartOffset != 4 || e.Hashtags[1].EndOffset != 7 {
+			t.Errorf("expected two go hashtags with offsets, got %+v", e.Hashtags)
+		}
+		if len(e.Mentions) != 1 || e.Mentions[0].Username != "alice" || e.Mentions[0].StartOffset != 13 {
+			t.Errorf("expected a mention of alice, got %+v", e.Mentions)
+		}
+		if len(found) != 2 {
+			t.Errorf("expected entities for two chirps, got %+v", found)
+		}
+
+		chirps, err := s.ListHashtagChirps(ctx, HashtagFilter{Tag: "go", Limit: 2})
+		if err != nil {
+			t.Fatalf("ListHashtagChirps returned error: %v", err)
+		}
+		if len(chirps) != 2 || chirps[0].ID != second.ID || chirps[1].ID != first.ID {
+			t.Fatalf("expected the newest two go chirps once each, got %+v", chirps)
+		}
+		after := &ChirpCursor{CreatedAt: chirps[1].CreatedAt, ID: chirps[1].ID}
+		chirps, err = s.ListHashtagChirps(ctx, HashtagFilter{Tag: "go", After: after})
+		if err != nil || len(chirps) != 1 || chirps[0].ID != old.ID {
+			t.Errorf("expected the oldest go chirp on the next page, got %+v, %v", chirps, err)
+		}
+
+		trending, err := s.TrendingHashtags(ctx, now.Add(-24*time.Hour), 10)
+		if err != nil {
+			t.Fatalf("TrendingHashtags returned error: %v", err)
+		}
+		expected := []TrendingHashtag{{"go", 2}, {"rust", 2}}
+		if !reflect.DeepEqual(trending, expected) {
+			t.Errorf("expected %+v, got %+v", expected, trending)
+		}
+
+		if err := s.EditChirp(ctx, second, "now just #zig"); err != nil {
+			t.Fatalf("EditChirp returned error: %v", err)
+		}
+		if err := s.DeleteChirp(ctx, third.ID); err != nil {
+			t.Fatalf("DeleteChirp returned error: %v", err)
+		}
+		trending, err = s.TrendingHashtags(ctx, now.Add(-24*time.Hour), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = []TrendingHashtag{{"go", 1}}
+		if !reflect.DeepEqual(trending, expected) {
+			t.Errorf("expected edits and deletes to update trending tags, got %+v", trending)
+		}
+	})
+}
+
+func TestStoreProfanityReview(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		for _, word := range []models.ProfanityWord{{Word: "gloop", Action: "flag"}, {Word: "blarg", Action: "mask"}, {Word: "gloop", Action: "reject"}} {
+			if err := s.SaveProfanityWord(ctx, &word); err != nil {
+				t.Fatalf("SaveProfanityWord returned error: %v", err)
+			}
+		}
+		if err := s.DeleteProfanityWord(ctx, "blarg"); err != nil {
+			t.Fatalf("DeleteProfanityWord returned error: %v", err)
+		}
+		if err := s.DeleteProfanityWord(ctx, "missing"); err != nil {
+			t.Errorf("expected deleting a missing word to succeed, got %v", err)
+		}
+		words, err := s.ListProfanityWords(ctx)
+		if err != nil {
+			t.Fatalf("ListProfanityWords returned error: %v", err)
+		}
+		if len(words) != 1 || words[0].Word != "gloop" || words[0].Action != "reject" {
+			t.Errorf("expected gloop to be rejected, got %+v", words)
+		}
+
+		user := &models.User{Email: "reviewed@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		clean := &models.Chirp{Body: "clean", UserID: user.ID}
+		flagged := &models.Chirp{Body: "gloop", UserID: user.ID, Flagged: true}
+		for _, chirp := range []*models.Chirp{clean, flagged} {
+			if err := s.CreateChirp(ctx, chirp); err != nil {
+				t.Fatalf("CreateChirp returned error: %v", err)
+			}
+		}
+		chirps, err := s.ListChirps(ctx, ChirpFilter{Flagged: true})
+		if err != nil || len(chirps) != 1 || chirps[0].ID != flagged.ID {
+			t.Fatalf("expected only the flagged chirp, got %+v, %v", chirps, err)
+		}
+
+		if err := s.SetChirpFlagged(ctx, flagged.ID, false); err != nil {
+			t.Fatalf("SetChirpFlagged returned error: %v", err)
+		}
+		reloaded, err := s.GetChirpByID(ctx, flagged.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloaded.Flagged || !reloaded.UpdatedAt.Equal(flagged.UpdatedAt) {
+			t.Errorf("expected the flag cleared without touching updated_at, got %+v", reloaded)
+		}
+		if err := s.SetChirpFlagged(ctx, 999, true); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound flagging a missing chirp, got %v", err)
+		}
+	})
+}
+
+func TestFullTextQueryRendering(t *testing.T) {
+	q, err := search.Parse(`coffee "good morning" caf*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := mysqlBooleanQuery(q), `+coffee +caf* +"good morning"`; got != expected {
+		t.Errorf("expected MySQL query %q, got %q", expected, got)
+	}
+	if got, expected := postgresTSQuery(q), `'coffee' & 'caf':* & ('good' <-> 'morning')`; got != expected {
+		t.Errorf("expected tsquery %q, got %q", expected, got)
+	}
+}
+
+func TestStoreRefreshTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+
+		token := &models.RefreshToken{Token: "abc", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := s.CreateRefreshToken(ctx, token); err != nil {
+			t.Fatalf("CreateRefreshToken returned error: %v", err)
+		}
+
+		now := time.Now()
+		token.RevokedAt = &now
+		if err := s.UpdateRefreshToken(ctx, token); err != nil {
+			t.Fatalf("UpdateRefreshToken returned error: %v", err)
+		}
+
+		found, err := s.GetRefreshToken(ctx, "abc")
+		if err != nil {
+			t.Fatalf("GetRefreshToken returned error: %v", err)
+		}
+		if found.RevokedAt == nil {
+			t.Error("expected revocation to be persisted")
+		}
+
+		if err := s.DeleteAllUsers(ctx); err != nil {
+			t.Fatalf("DeleteAllUsers returned error: %v", err)
+		}
+		if _, err := s.GetRefreshToken(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected tokens to be removed with their users, got %v", err)
+		}
+	})
+}
+
+func TestStoreRotateRefreshToken(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := &models.User{Email: "a@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+
+		expires := time.Now().Add(time.Hour)
+		first := &models.RefreshToken{Token: "first", UserID: user.ID, FamilyID: "fam", ExpiresAt: expires}
+		if err := s.CreateRefreshToken(ctx, first); err != nil {
+			t.Fatalf("CreateRefreshToken returned error: %v", err)
+		}
+		other := &models.RefreshToken{Token: "other", UserID: user.ID, FamilyID: "other-fam", ExpiresAt: expires}
+		if err := s.CreateRefreshToken(ctx, other); err != nil {
+			t.Fatalf("CreateRefreshToken returned error: %v", err)
+		}
+
+		second := &models.RefreshToken{Token: "second", UserID: user.ID, FamilyID: "fam", ExpiresAt: expires}
+		if err := s.RotateRefreshToken(ctx, first, second); err != nil {
+			t.Fatalf("RotateRefreshToken returned error: %v", err)
+		}
+		rotated, err := s.GetRefreshToken(ctx, "first")
+		if err != nil {
+			t.Fatalf("GetRefreshToken returned error: %v", err)
+		}
+		if rotated.RevokedAt == nil || rotated.ReplacedBy == nil || *rotated.ReplacedBy != "second" {
+			t.Errorf("expected first token to be revoked and replaced by second, got %+v", rotated)
+		}
+
+		stale := &models.RefreshToken{Token: "first"}
+		if err := s.RotateRefreshToken(ctx, stale, &models.RefreshToken{Token: "third", UserID: user.ID, FamilyID: "fam", ExpiresAt: expires}); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected ErrConflict rotating a revoked token, got %v", err)
+		}
+
+		if err := s.RevokeRefreshTokenFamily(ctx, "fam"); err != nil {
+			t.Fatalf("RevokeRefreshTokenFamily returned error: %v", err)
+		}
+		if latest, _ := s.GetRefreshToken(ctx, "second"); latest == nil || latest.RevokedAt == nil {
+			t.Error("expected every token in the family to be revoked")
+		}
+		if unrelated, _ := s.GetRefreshToken(ctx, "other"); unrelated == nil || unrelated.RevokedAt != nil {
+			t.Error("expected tokens in other families to stay live")
+		}
+	})
+}
+
+func TestStoreResetPassword(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := &models.User{Email: "forgetful@example.com", HashedPassword: "old"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+		refresh := &models.RefreshToken{Token: "live", UserID: user.ID, FamilyID: "fam", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := s.CreateRefreshToken(ctx, refresh); err != nil {
+			t.Fatalf("CreateRefreshToken returned error: %v", err)
+		}
+
+		expires := time.Now().Add(time.Hour)
+		for _, hash := range []string{"first", "second"} {
+			if err := s.CreatePasswordResetToken(ctx, &models.PasswordResetToken{TokenHash: hash, UserID: user.ID, ExpiresAt: expires}); err != nil {
+				t.Fatalf("CreatePasswordResetToken returned error: %v", err)
+			}
+		}
+		expired := &models.PasswordResetToken{TokenHash: "expired", UserID: user.ID, ExpiresAt: time.Now().Add(-time.Minute)}
+		if err := s.CreatePasswordResetToken(ctx, expired); err != nil {
+			t.Fatalf("CreatePasswordResetToken returned error: %v", err)
+		}
+		if err := s.CreatePasswordResetToken(ctx, &models.PasswordResetToken{TokenHash: "orphan", UserID: user.ID + 100, ExpiresAt: expires}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a token of a missing user, got %v", err)
+		}
+
+		if _, err := s.GetPasswordResetUser(ctx, "expired"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound looking up an expired token, got %v", err)
+		}
+		if found, err := s.GetPasswordResetUser(ctx, "first"); err != nil || found.ID != user.ID || found.Email != user.Email {
+			t.Errorf("expected the token's user, got %+v, %v", found, err)
+		}
+		if _, err := s.ResetPassword(ctx, "expired", "new"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound for an expired token, got %v", err)
+		}
+		userID, err := s.ResetPassword(ctx, "first", "new")
+		if err != nil {
+			t.Fatalf("ResetPassword returned error: %v", err)
+		}
+		if userID != user.ID {
+			t.Errorf("expected user %d, got %d", user.ID, userID)
+		}
+		if found, _ := s.GetUserByID(ctx, user.ID); found == nil || found.HashedPassword != "new" {
+			t.Errorf("expected the password to be changed, got %+v", found)
+		}
+		if found, _ := s.GetRefreshToken(ctx, "live"); found == nil || found.RevokedAt == nil {
+			t.Error("expected refresh tokens to be revoked")
+		}
+
+		for _, hash := range []string{"first", "second"} {
+			if _, err := s.ResetPassword(ctx, hash, "again"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected %s to be unusable after a reset, got %v", hash, err)
+			}
+		}
+	})
+}
+
+func TestStoreVerifyEmail(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := &models.User{Email: "new@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+
+		expires := time.Now().Add(time.Hour)
+		tokens := []models.EmailVerificationToken{
+			{TokenHash: "old-address", UserID: user.ID, Email: "old@example.com", ExpiresAt: expires},
+			{TokenHash: "expired", UserID: user.ID, Email: user.Email, ExpiresAt: time.Now().Add(-time.Minute)},
+			{TokenHash: "first", UserID: user.ID, Email: user.Email, ExpiresAt: expires},
+			{TokenHash: "second", UserID: user.ID, Email: user.Email, ExpiresAt: expires},
+		}
+		for _, token := range tokens {
+			if err := s.CreateEmailVerificationToken(ctx, &token); err != nil {
+				t.Fatalf("CreateEmailVerificationToken returned error: %v", err)
+			}
+		}
+
+		for _, hash := range []string{"old-address", "expired", "missing"} {
+			if _, err := s.VerifyEmail(ctx, hash); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound verifying with %s, got %v", hash, err)
+			}
+		}
+		if found, _ := s.GetUserByID(ctx, user.ID); found == nil || found.EmailVerifiedAt != nil {
+			t.Fatalf("expected the user to be unverified, got %+v", found)
+		}
+
+		userID, err := s.VerifyEmail(ctx, "first")
+		if err != nil {
+			t.Fatalf("VerifyEmail returned error: %v", err)
+		}
+		if userID != user.ID {
+			t.Errorf("expected user %d, got %d", user.ID, userID)
+		}
+		verified, err := s.GetUserByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID returned error: %v", err)
+		}
+		if verified.EmailVerifiedAt == nil {
+			t.Error("expected the user to be verified")
+		}
+		if _, err := s.VerifyEmail(ctx, "second"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the user's other tokens to be removed, got %v", err)
+		}
+
+		verified.Email = "changed@example.com"
+		verified.EmailVerifiedAt = nil
+		if err := s.UpdateUser(ctx, verified); err != nil {
+			t.Fatalf("UpdateUser returned error: %v", err)
+		}
+		if found, _ := s.GetUserByID(ctx, user.ID); found == nil || found.EmailVerifiedAt != nil {
+			t.Errorf("expected changing the address to clear verification, got %+v", found)
+		}
+	})
+}
+
+func TestStoreTOTP(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := &models.User{Email: "careful@example.com", HashedPassword: "hash"}
+		if err := s.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser returned error: %v", err)
+		}
+
+		if _, err := s.GetTOTPCredential(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound before enrolling, got %v", err)
+		}
+		if err := s.EnableTOTP(ctx, user.ID, 1, nil); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound enabling without a secret, got %v", err)
+		}
+		for _, secret := range []string{"FIRST", "SECOND"} {
+			if err := s.SaveTOTPCredential(ctx, &models.TOTPCredential{UserID: user.ID, Secret: secret}); err != nil {
+				t.Fatalf("SaveTOTPCredential returned error: %v", err)
+			}
+		}
+		if err := s.UseTOTPStep(ctx, user.ID, 5); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected codes to be refused before enabling, got %v", err)
+		}
+
+		if err := s.EnableTOTP(ctx, user.ID, 10, []string{"code-a", "code-b"}); err != nil {
+			t.Fatalf("EnableTOTP returned error: %v", err)
+		}
+		credential, err := s.GetTOTPCredential(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetTOTPCredential returned error: %v", err)
+		}
+		if credential.Secret != "SECOND" || credential.EnabledAt == nil || credential.LastUsedStep != 10 {
+			t.Errorf("expected the second secret to be enabled at step 10, got %+v", credential)
+		}
+		if err := s.EnableTOTP(ctx, user.ID, 11, nil); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected ErrConflict enabling twice, got %v", err)
+		}
+		if err := s.SaveTOTPCredential(ctx, &models.TOTPCredential{UserID: user.ID, Secret: "THIRD"}); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected ErrConflict replacing an enabled secret, got %v", err)
+		}
+
+		if err := s.UseTOTPStep(ctx, user.ID, 10); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected a used step to be refused, got %v", err)
+		}
+		if err := s.UseTOTPStep(ctx, user.ID, 11); err != nil {
+			t.Errorf("UseTOTPStep returned error: %v", err)
+		}
+
+		if err := s.UseRecoveryCode(ctx, user.ID, "code-a"); err != nil {
+			t.Errorf("UseRecoveryCode returned error: %v", err)
+		}
+		if err := s.UseRecoveryCode(ctx, user.ID, "code-a"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected a used recovery code to be refused, got %v", err)
+		}
+
+		if err := s.DeleteTOTP(ctx, user.ID); err != nil {
+			t.Fatalf("DeleteTOTP returned error: %v", err)
+		}
+		if _, err := s.GetTOTPCredential(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the credential to be removed, got %v", err)
+		}
+		if err := s.UseRecoveryCode(ctx, user.ID, "code-b"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected recovery codes to be removed, got %v", err)
+		}
+	})
+}
+
+func TestStoreLoginAttempts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Millisecond)
+		subject := "walt@example.com"
+
+		if _, err := s.GetLoginAttempt(ctx, models.LoginScopeAccount, subject); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound before any failure, got %v", err)
+		}
+		for i := 1; i <= 3; i++ {
+			attempt, err := s.RecordLoginFailure(ctx, models.LoginScopeAccount, subject, now, now.Add(-time.Hour))
+			if err != nil {
+				t.Fatalf("RecordLoginFailure returned error: %v", err)
+			}
+			if attempt.Failures != i {
+				t.Errorf("expected %d failures, got %d", i, attempt.Failures)
+			}
+		}
+		if _, err := s.RecordLoginFailure(ctx, models.LoginScopeIP, "192.0.2.1", now, now.Add(-time.Hour)); err != nil {
+			t.Fatalf("RecordLoginFailure returned error: %v", err)
+		}
+		if err := s.ForgiveLoginFailures(ctx, models.LoginScopeAccount, subject, 2); err != nil {
+			t.Fatalf("ForgiveLoginFailures returned error: %v", err)
+		}
+		if attempt, err := s.GetLoginAttempt(ctx, models.LoginScopeAccount, subject); err != nil || attempt.Failures != 1 {
+			t.Errorf("expected 1 failure left, got %+v, %v", attempt, err)
+		}
+		if err := s.ForgiveLoginFailures(ctx, models.LoginScopeAccount, subject, 2); err != nil {
+			t.Fatalf("ForgiveLoginFailures returned error: %v", err)
+		}
+		if attempt, err := s.GetLoginAttempt(ctx, models.LoginScopeAccount, subject); err != nil || attempt.Failures != 0 {
+			t.Errorf("expected the count to stop at zero, got %+v, %v", attempt, err)
+		}
+		if err := s.ForgiveLoginFailures(ctx, models.LoginScopeAccount, "nobody@example.com", 1); err != nil {
+			t.Errorf("expected forgiving an unknown subject to do nothing, got %v", err)
+		}
+
+		if err := s.LockLogin(ctx, models.LoginScopeAccount, subject, now.Add(time.Hour)); err != nil {
+			t.Fatalf("LockLogin returned error: %v", err)
+		}
+		if err := s.LockLogin(ctx, models.LoginScopeAccount, subject, now.Add(time.Minute)); err != nil {
+			t.Fatalf("LockLogin returned error: %v", err)
+		}
+		if err := s.LockLogin(ctx, models.LoginScopeIP, "192.0.2.1", now.Add(time.Minute)); err != nil {
+			t.Fatalf("LockLogin returned error: %v", err)
+		}
+		lockouts, err := s.ListLoginLockouts(ctx, now)
+		if err != nil {
+			t.Fatalf("ListLoginLockouts returned error: %v", err)
+		}
+		if len(lockouts) != 2 || lockouts[0].Subject != subject || !lockouts[0].LockedUntil.Equal(now.Add(time.Hour)) || lockouts[1].Scope != models.LoginScopeIP {
+			t.Errorf("expected the longer lockout to stand and be listed first, got %+v", lockouts)
+		}
+		if lockouts, _ := s.ListLoginLockouts(ctx, now.Add(2*time.Minute)); len(lockouts) != 1 {
+			t.Errorf("expected expired lockouts to be left out, got %+v", lockouts)
+		}
+
+		// A failure long after the last one starts the count over.
+		later := now.Add(2 * time.Hour)
+		attempt, err := s.RecordLoginFailure(ctx, models.LoginScopeAccount, subject, later, later.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("RecordLoginFailure returned error: %v", err)
+		}
+		if attempt.Failures != 1 || attempt.LockedUntil != nil {
+			t.Errorf("expected a fresh record, got %+v", attempt)
+		}
+
+		if err := s.ClearLoginAttempts(ctx, models.LoginScopeAccount, subject); err != nil {
+			t.Fatalf("ClearLoginAttempts returned error: %v", err)
+		}
+		if err := s.ClearLoginAttempts(ctx, models.LoginScopeAccount, subject); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound clearing twice, got %v", err)
+		}
+		if _, err := s.GetLoginAttempt(ctx, models.LoginScopeIP, "192.0.2.1"); err != nil {
+			t.Errorf("expected other subjects to be kept, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/G0SU19O2/Chirpy/internal/models"
+	"gorm.io/gorm"
+)
+
+func (s *GormStore) GetTOTPCredential(ctx context.Context, userID uint) (*models.TOTPCredential, error) {
+	var credential models.TOTPCredential
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &credential, nil
+}
+
+func (s *GormStore) SaveTOTPCredential(ctx context.Context, credential *models.TOTPCredential) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var enabled int64
+		if err := tx.Model(&models.TOTPCredential{}).
+			Where("user_id = ? AND enabled_at IS NOT NULL", credential.UserID).
+			Count(&enabled).Error; err != nil {
+			return err
+		}
+		if enabled > 0 {
+			return ErrConflict
+		}
+		if err := tx.Where("user_id = ?", credential.UserID).Delete(&models.TOTPCredential{}).Error; err != nil {
+			return err
+		}
+		return translateError(tx.Create(credential).Error)
+	})
+}
+
+func (s *GormStore) EnableTOTP(ctx context.Context, userID uint, step int64, codeHashes []string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.TOTPCredential{}).
+			Where("user_id = ? AND enabled_at IS NULL", userID).
+			Updates(map[string]interface{}{"enabled_at": now, "last_used_step": step, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var credential models.TOTPCredential
+			if err := tx.Where("user_id = ?", userID).First(&credential).Error; err != nil {
+				return translateError(err)
+			}
+			return ErrConflict
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: now}
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (s *GormStore) UseTOTPStep(ctx context.Context, userID uint, step int64) error {
+	// Only moving last_used_step forward lets the database settle two
+	// logins racing with the same code.
+	result := s.db.WithContext(ctx).Model(&models.TOTPCredential{}).
+		Where("user_id = ? AND enabled_at IS NOT NULL AND last_used_step < ?", userID, step).
+		UpdateColumn("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *GormStore) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error {
+	result := s.db.WithContext(ctx).Where("user_id = ? AND code_hash = ?", userID, codeHash).Delete(&models.RecoveryCode{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *GormStore) DeleteTOTP(ctx context.Context, userID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error
+	})
+}
@@ -0,0 +1,115 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists eight digits; six-digit codes are their last six.
+	tests := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("Code returned error: %v", err)
+		}
+		if got != expected {
+			t.Errorf("at %d expected %s, got %s", unix, expected, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current, _ := Code(rfcSecret, Step(now))
+	previous, _ := Code(rfcSecret, Step(now)-1)
+	stale, _ := Code(rfcSecret, Step(now)-2)
+
+	if step, ok := Validate(rfcSecret, current, now, 1); !ok || step != Step(now) {
+		t.Errorf("expected the current code to be accepted at step %d, got %d, %v", Step(now), step, ok)
+	}
+	if step, ok := Validate(rfcSecret, previous, now, 1); !ok || step != Step(now)-1 {
+		t.Errorf("expected the previous code to be accepted within the skew, got %d, %v", step, ok)
+	}
+	if _, ok := Validate(rfcSecret, stale, now, 1); ok {
+		t.Error("expected a code outside the skew to be refused")
+	}
+	for _, code := range []string{"", "12345", "abcdef", current + "0"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("expected %q to be refused", code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret returned error: %v", err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("expected a usable secret, got %v", err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("expected secrets to differ")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Chirpy", "walt@example.com", "JBSWY3DPEHPK3PXP")
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", uri, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Chirpy:walt@example.com" {
+		t.Errorf("unexpected URI %s", uri)
+	}
+	q := u.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Chirpy" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected parameters %v", q)
+	}
+
+	png, err := QRCode(uri)
+	if err != nil {
+		t.Fatalf("QRCode returned error: %v", err)
+	}
+	if !strings.HasPrefix(png, "data:image/png;base64,") {
+		t.Errorf("expected a PNG data URL, got %.40s", png)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes returned error: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if NormalizeRecoveryCode(code) != code {
+			t.Errorf("expected %q to be normalized already", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("expected 10 distinct codes, got %v", codes)
+	}
+
+	if got := NormalizeRecoveryCode(" ABCDE fghjk "); got != "abcde-fghjk" {
+		t.Errorf("expected abcde-fghjk, got %q", got)
+	}
+	if got := NormalizeRecoveryCode("abc"); got != "" {
+		t.Errorf("expected a short code to be refused, got %q", got)
+	}
+}
@@ -8,7 +8,7 @@ echo "🐦 Setting up Chirpy development environment..."
 
 # Check if Go is installed
 if ! command -v go &> /dev/null; then
-    echo "❌ Go is not installed. Please install Go 1.21 or later."
+    echo "❌ Go is not installed. Please install Go 1.24 or later."
     exit 1
 fi
 
@@ -30,6 +30,12 @@ DB_URL=chirpy_user:chirpy_password@tcp(localhost:3306)/chirpy?charset=utf8mb4&pa
 
 # Platform (DEV or PROD)
 PLATFORM=DEV
+
+# Secret used to sign access tokens (at least 32 bytes)
+JWT_SECRET=$(openssl rand -hex 32 2>/dev/null || head -c 32 /dev/urandom | od -An -tx1 | tr -d ' \n')
+
+# API key expected on Polka webhooks
+POLKA_API_KEY=change-me
 EOF
     echo "⚠️  Please update .env with your actual database configuration"
 fi
@@ -0,0 +1,14 @@
+-- name: GetChirpByID :one
+SELECT * FROM chirps WHERE id = ? AND deleted_at IS NULL;
+
+-- name: ListChirpsByAuthor :many
+SELECT * FROM chirps WHERE user_id = ? AND deleted_at IS NULL ORDER BY created_at, id;
+
+-- name: ListChirpsAfter :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND (created_at > ? OR (created_at = ? AND id > ?))
+ORDER BY created_at, id
+LIMIT ?;
+
+-- name: ListConversation :many
+SELECT * FROM chirps WHERE conversation_id = ? AND deleted_at IS NULL ORDER BY created_at, id;
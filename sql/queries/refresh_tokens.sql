@@ -0,0 +1,2 @@
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens WHERE token = ?;
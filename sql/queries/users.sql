@@ -0,0 +1,5 @@
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = ? AND deleted_at IS NULL;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users WHERE email = ? AND deleted_at IS NULL;